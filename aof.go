@@ -0,0 +1,453 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// when the append only log is fsynced
+type AOFFsyncPolicy int8
+
+const (
+	AOFFsyncEverySecond AOFFsyncPolicy = iota // at most one second of writes is lost on a crash
+	AOFFsyncAlways                            // before every write returns
+	AOFFsyncNever                             // left to the os, the log is still flushed every second
+)
+
+const (
+	aof_op_set         byte = 1
+	aof_op_delete      byte = 2
+	aof_op_expire      byte = 3
+	aof_op_set_tags    byte = 4
+	aof_op_set_sliding byte = 5
+)
+
+// entry:   uvarint payload length, uint32 big endian crc32 (IEEE) of payload, payload
+// payload: op byte, uvarint key length, key, then
+// for a set: varint expire (unix millis), value encoded by the codec
+// for a set with tags: varint expire (unix millis), uvarint tag count, uvarint length and bytes of every tag, value
+// for a sliding set: varint expire (unix millis), uvarint sliding millis, then the tags and value of a set with tags
+// for an expire: varint expire (unix millis)
+const aof_max_entry = 1 << 30
+
+var errAOFCorrupt = errors.New("aof: corrupted entry")
+
+// the append only log of the writes of a cache
+type aof_log struct {
+	lock        sync.Mutex
+	path        string
+	codec       Codec
+	fsync       AOFFsyncPolicy
+	file        *os.File
+	w           *bufio.Writer
+	size        int64 //bytes of the log
+	base_size   int64 //bytes of the log after the last rewrite or replay
+	dirty       bool  //written since the last fsync
+	rewriting   bool
+	rewrite_buf []byte //entries appended while rewriting
+	closed      bool
+}
+
+// a set entry, a set with tags entry if key has tags, or a sliding set entry if its expire time slides
+func aofSetEntry(key string, expire int64, sliding int64, tags []string, value []byte) []byte {
+	payload := make([]byte, 0, 1+binary.MaxVarintLen64*3+len(key)+len(value))
+	switch {
+	case sliding > 0:
+		payload = append(payload, aof_op_set_sliding)
+	case len(tags) > 0:
+		payload = append(payload, aof_op_set_tags)
+	default:
+		payload = append(payload, aof_op_set)
+	}
+	payload = binary.AppendUvarint(payload, uint64(len(key)))
+	payload = append(payload, key...)
+	payload = binary.AppendVarint(payload, expire)
+	if sliding > 0 {
+		payload = binary.AppendUvarint(payload, uint64(sliding))
+	}
+	if sliding > 0 || len(tags) > 0 {
+		payload = binary.AppendUvarint(payload, uint64(len(tags)))
+		for _, tag := range tags {
+			payload = binary.AppendUvarint(payload, uint64(len(tag)))
+			payload = append(payload, tag...)
+		}
+	}
+	payload = append(payload, value...)
+	return aofFrame(payload)
+}
+
+func aofDeleteEntry(key string) []byte {
+	payload := make([]byte, 0, 1+binary.MaxVarintLen64+len(key))
+	payload = append(payload, aof_op_delete)
+	payload = binary.AppendUvarint(payload, uint64(len(key)))
+	payload = append(payload, key...)
+	return aofFrame(payload)
+}
+
+func aofExpireEntry(key string, expire int64) []byte {
+	payload := make([]byte, 0, 1+binary.MaxVarintLen64*2+len(key))
+	payload = append(payload, aof_op_expire)
+	payload = binary.AppendUvarint(payload, uint64(len(key)))
+	payload = append(payload, key...)
+	payload = binary.AppendVarint(payload, expire)
+	return aofFrame(payload)
+}
+
+func aofFrame(payload []byte) []byte {
+	entry := make([]byte, 0, binary.MaxVarintLen64+4+len(payload))
+	entry = binary.AppendUvarint(entry, uint64(len(payload)))
+	entry = binary.BigEndian.AppendUint32(entry, crc32.ChecksumIEEE(payload))
+	return append(entry, payload...)
+}
+
+// read the next entry of r and its size in bytes, io.EOF at the clean end of the log
+func aofReadEntry(r *bufio.Reader) (op byte, key string, expire int64, sliding int64, tags []string, value []byte, size int64, err error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		if err != io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+	if length > aof_max_entry {
+		err = errAOFCorrupt
+		return
+	}
+	head := make([]byte, 4+length)
+	if _, err = io.ReadFull(r, head); err != nil {
+		err = io.ErrUnexpectedEOF
+		return
+	}
+	size = int64(len(binary.AppendUvarint(nil, length))) + 4 + int64(length)
+
+	payload := head[4:]
+	if binary.BigEndian.Uint32(head[:4]) != crc32.ChecksumIEEE(payload) || len(payload) == 0 {
+		err = errAOFCorrupt
+		return
+	}
+	op = payload[0]
+	key_len, n := binary.Uvarint(payload[1:])
+	if n <= 0 || key_len > uint64(len(payload)-1-n) {
+		err = errAOFCorrupt
+		return
+	}
+	rest := payload[1+n:]
+	key = string(rest[:key_len])
+	rest = rest[key_len:]
+
+	switch op {
+	case aof_op_delete:
+	case aof_op_set, aof_op_expire, aof_op_set_tags, aof_op_set_sliding:
+		expire, n = binary.Varint(rest)
+		if n <= 0 {
+			err = errAOFCorrupt
+			return
+		}
+		value = rest[n:]
+	default:
+		err = errAOFCorrupt
+		return
+	}
+
+	if op == aof_op_set_sliding {
+		op = aof_op_set_tags
+		var sliding_millis uint64
+		sliding_millis, n = binary.Uvarint(value)
+		if n <= 0 || sliding_millis == 0 || sliding_millis > math.MaxInt64 {
+			err = errAOFCorrupt
+			return
+		}
+		sliding = int64(sliding_millis)
+		value = value[n:]
+	}
+	if op == aof_op_set_tags {
+		op = aof_op_set
+		var count uint64
+		count, n = binary.Uvarint(value)
+		if n <= 0 || count > uint64(len(value)) {
+			err = errAOFCorrupt
+			return
+		}
+		value = value[n:]
+		if count > 0 {
+			tags = make([]string, count)
+		}
+		for i := range tags {
+			var tag_len uint64
+			tag_len, n = binary.Uvarint(value)
+			if n <= 0 || tag_len > uint64(len(value)-n) {
+				err = errAOFCorrupt
+				return
+			}
+			tags[i] = string(value[n : n+int(tag_len)])
+			value = value[n+int(tag_len):]
+		}
+	}
+	return
+}
+
+// replay the log at AOFPath into the cache and keep it open for appending.
+// A torn entry at the end of the log, left by a crash during a write, is truncated.
+func (cache *Cache) openAOF() error {
+	config := cache.cache_config
+	file, err := os.OpenFile(config.AOFPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	offset, err := cache.replayAOF(file)
+	if err == nil {
+		err = file.Truncate(offset)
+	}
+	if err == nil {
+		_, err = file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	cache.aof = &aof_log{
+		path:      config.AOFPath,
+		codec:     config.AOFCodec,
+		fsync:     config.AOFFsync,
+		file:      file,
+		w:         bufio.NewWriter(file),
+		size:      offset,
+		base_size: offset,
+	}
+	return nil
+}
+
+// apply the entries of file without logging them again, the offset after the last complete entry is returned
+func (cache *Cache) replayAOF(file *os.File) (int64, error) {
+	r := bufio.NewReader(file)
+	var offset int64
+	//values set with an expire time which has passed since, a later expire entry may still extend them
+	type expired_set struct {
+		sliding int64
+		tags    []string
+		data    []byte
+	}
+	expired := make(map[string]expired_set)
+
+	store := func(key string, sliding int64, tags []string, data []byte, ttl int64) error {
+		value, err := cache.cache_config.AOFCodec.Decode(data)
+		if err != nil {
+			return err
+		}
+		shard := cache.shard(key)
+		shard.lock.Lock()
+		cache.store(shard, key, value, ttl, cache.capTtl(sliding), tags, nil)
+		shard.lock.Unlock()
+		return nil
+	}
+	remove := func(key string) {
+		shard := cache.shard(key)
+		shard.lock.Lock()
+		cache.remove(shard, key, math.MaxInt64, nil)
+		shard.lock.Unlock()
+	}
+
+	for {
+		op, key, expire, sliding, tags, data, size, err := aofReadEntry(r)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+
+		ttl := cache.capTtl(expire - cache.now())
+
+		switch {
+		case op == aof_op_set && ttl > 0:
+			delete(expired, key)
+			if err := store(key, sliding, tags, data, ttl); err != nil {
+				return offset, err
+			}
+		case op == aof_op_set:
+			expired[key] = expired_set{sliding, tags, data}
+			remove(key)
+		case op == aof_op_expire && ttl > 0:
+			if set, exist := expired[key]; exist {
+				delete(expired, key)
+				if err := store(key, set.sliding, set.tags, set.data, ttl); err != nil {
+					return offset, err
+				}
+				break
+			}
+			shard := cache.shard(key)
+			shard.lock.Lock()
+			if ele_, exist := shard.sync_map.Load(key); exist {
+				cache.moveExpire(shard, key, ele_.(*cache_element), cache.now()+ttl, nil)
+			}
+			shard.lock.Unlock()
+		default:
+			//deleted, or expired since
+			delete(expired, key)
+			remove(key)
+		}
+		offset += size
+	}
+}
+
+// append entry to the log, it is fsynced before returning with AOFFsyncAlways
+func (log *aof_log) append(entry []byte) error {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+
+	if log.closed {
+		return ErrClosed
+	}
+	if _, err := log.w.Write(entry); err != nil {
+		return err
+	}
+	log.size += int64(len(entry))
+	if log.rewriting {
+		log.rewrite_buf = append(log.rewrite_buf, entry...)
+	}
+
+	if log.fsync == AOFFsyncAlways {
+		if err := log.w.Flush(); err != nil {
+			return err
+		}
+		return log.file.Sync()
+	}
+	log.dirty = true
+	return nil
+}
+
+// flush the buffered entries and fsync them unless the policy is AOFFsyncNever, called every second
+func (log *aof_log) flush() error {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+
+	if log.closed || !log.dirty {
+		return nil
+	}
+	if err := log.w.Flush(); err != nil {
+		return err
+	}
+	log.dirty = false
+	if log.fsync == AOFFsyncNever {
+		return nil
+	}
+	return log.file.Sync()
+}
+
+func (log *aof_log) close() error {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+
+	if log.closed {
+		return nil
+	}
+	log.closed = true
+	err := log.w.Flush()
+	if sync_err := log.file.Sync(); err == nil {
+		err = sync_err
+	}
+	if close_err := log.file.Close(); err == nil {
+		err = close_err
+	}
+	return err
+}
+
+// whether the log has grown enough since the last rewrite to be worth rewriting
+func (log *aof_log) needRewrite(min_bytes int64) bool {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+	return !log.closed && !log.rewriting && log.size >= min_bytes && log.size >= 2*log.base_size
+}
+
+// rewrite the log into one set entry per live key.
+// Writes keep being appended to the old log meanwhile, they are copied to the new one before it replaces the old one.
+func (cache *Cache) rewriteAOF() error {
+	log := cache.aof
+	log.lock.Lock()
+	if log.closed || log.rewriting {
+		log.lock.Unlock()
+		return nil
+	}
+	log.rewriting = true
+	log.rewrite_buf = nil
+	log.lock.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(log.path), filepath.Base(log.path)+".rewrite-*")
+	if err == nil {
+		err = cache.dumpAOF(tmp)
+	}
+
+	log.lock.Lock()
+	defer log.lock.Unlock()
+	log.rewriting = false
+	rewrite_buf := log.rewrite_buf
+	log.rewrite_buf = nil
+
+	if err == nil && log.closed {
+		err = ErrClosed
+	}
+	if err == nil {
+		_, err = tmp.Write(rewrite_buf)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), log.path)
+	}
+	if err != nil {
+		if tmp != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+		return err
+	}
+
+	//the entries buffered in the old log are in rewrite_buf already
+	log.file.Close()
+	size, _ := tmp.Seek(0, io.SeekEnd)
+	log.file = tmp
+	log.w = bufio.NewWriter(tmp)
+	log.size = size
+	log.base_size = size
+	log.dirty = false
+	if dir, err := os.Open(filepath.Dir(log.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// write a set entry for every live key to file
+func (cache *Cache) dumpAOF(file *os.File) error {
+	w := bufio.NewWriter(file)
+	now := cache.now()
+	var err error
+	for _, shard := range cache.shards {
+		shard.sync_map.Range(func(key, value interface{}) bool {
+			ele := value.(*cache_element)
+			if ele.expire() <= now {
+				return true
+			}
+			var data []byte
+			data, err = cache.aof.codec.Encode(ele.Value.(CacheItem))
+			if err == nil {
+				_, err = w.Write(aofSetEntry(key.(string), ele.expire(), ele.Sliding, ele.Tags, data))
+			}
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newAOFCache(t *testing.T, clock *FakeClock, path string, fsync AOFFsyncPolicy) *Cache {
+	cache, err := New(&CacheConfig{
+		Clock:    clock,
+		AOFPath:  path,
+		AOFCodec: NewJSONCodec(func() CacheItem { return &Person{} }),
+		AOFFsync: fsync,
+	})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	return cache
+}
+
+func Test_Cache_AOFReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+
+	cache := newAOFCache(t, clock, path, AOFFsyncEverySecond)
+	cache.SetTTL("a", &Person{"Jack", 18, "London"}, 10)
+	cache.SetTTL("b", &Person{"Tom", 20, "Paris"}, 100)
+	cache.Keep("b", &Person{"Tom", 21, "Paris"})
+	cache.Keep("missing", &Person{"Bob", 30, "Rome"})
+	cache.SetTTL("c", &Person{"Ann", 40, "Oslo"}, 100)
+	cache.Delete("c")
+	cache.Close()
+
+	// restarted 50s later, 'a' has expired meanwhile
+	clock.Advance(50 * time.Second)
+	cache = newAOFCache(t, clock, path, AOFFsyncEverySecond)
+	defer cache.Close()
+
+	if v, _ := cache.Get("a"); v != nil {
+		t.Fatalf("expired 'a' expect nil, but %v", v)
+	}
+	if v, ttl := cache.Get("b"); v == nil || *v.(*Person) != (Person{"Tom", 21, "Paris"}) || ttl != 50 {
+		t.Fatalf("get 'b' expect Tom 21 with ttl 50, but %v %d", v, ttl)
+	}
+	if v, _ := cache.Get("missing"); v != nil {
+		t.Fatalf("kept 'missing' expect nil, but %v", v)
+	}
+	if v, _ := cache.Get("c"); v != nil {
+		t.Fatalf("deleted 'c' expect nil, but %v", v)
+	}
+}
+
+func Test_Cache_AOFFsyncAlways(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+
+	// not closed, like a crashed process
+	crashed := newAOFCache(t, clock, path, AOFFsyncAlways)
+	crashed.SetTTL("a", &Person{"Jack", 18, "London"}, 100)
+
+	// a torn entry at the end of the log
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	file.Write([]byte{200, 1, 0})
+	file.Close()
+
+	cache := newAOFCache(t, clock, path, AOFFsyncAlways)
+	defer cache.Close()
+	if v, ttl := cache.Get("a"); v == nil || v.(*Person).Name != "Jack" || ttl != 100 {
+		t.Fatalf("get 'a' expect Jack 100, but %v %d", v, ttl)
+	}
+	cache.SetTTL("b", &Person{"Tom", 20, "Paris"}, 100)
+
+	// the torn entry is truncated so the new writes can be replayed
+	replayed := newAOFCache(t, clock, path, AOFFsyncAlways)
+	defer replayed.Close()
+	if v, _ := replayed.Get("b"); v == nil || v.(*Person).Name != "Tom" {
+		t.Fatalf("get 'b' expect Tom, but %v", v)
+	}
+	crashed.Close()
+}
+
+func Test_Cache_AOFRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+
+	cache := newAOFCache(t, clock, path, AOFFsyncEverySecond)
+	for i := 0; i < 1000; i++ {
+		cache.SetTTL("a", &Person{"Jack", i, "London"}, 100)
+	}
+	cache.Delete("a")
+	cache.SetTTL("b", &Person{"Tom", 20, "Paris"}, 100)
+	clock.Advance(time.Second)
+
+	before, _ := os.Stat(path)
+	if err := cache.rewriteAOF(); err != nil {
+		t.Fatalf("rewriteAOF expect nil, but %v", err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size()*10 > before.Size() {
+		t.Fatalf("rewritten log expect much smaller than %d bytes, but %d", before.Size(), after.Size())
+	}
+
+	// writes after the rewrite go to the new log
+	cache.SetTTL("c", &Person{"Bob", 30, "Rome"}, 100)
+	cache.Close()
+
+	cache = newAOFCache(t, clock, path, AOFFsyncEverySecond)
+	defer cache.Close()
+	if cache.Items() != 2 {
+		t.Fatalf("items expect 2, but %d", cache.Items())
+	}
+	if v, _ := cache.Get("b"); v == nil || v.(*Person).Name != "Tom" {
+		t.Fatalf("get 'b' expect Tom, but %v", v)
+	}
+	if v, _ := cache.Get("c"); v == nil || v.(*Person).Name != "Bob" {
+		t.Fatalf("get 'c' expect Bob, but %v", v)
+	}
+}
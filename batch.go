@@ -0,0 +1,179 @@
+package cache
+
+import (
+	"errors"
+	"math"
+	"sync/atomic"
+)
+
+// MGet returns the values of keys in the same order, nil for a missing or expired key
+func (cache *Cache) MGet(keys []string) []CacheItem {
+	values := make([]CacheItem, len(keys))
+	for i, key := range keys {
+		values[i], _ = cache.Get(key)
+	}
+	return values
+}
+
+// MSet sets all the items with the same ttl, ttlSecond <= 0 for the default ttl. Live keys keep their tags.
+// The lock of each shard is taken once and its skiplist gets one command for the whole batch.
+func (cache *Cache) MSet(items map[string]CacheItem, ttlSecond int64) error {
+	if ttlSecond <= 0 {
+		ttlSecond = cache.cache_config.DefaultTtlSecs
+	}
+	ttl := cache.capTtl(secsToMillis(ttlSecond))
+
+	//check and encode out of the locks
+	shard_keys := make(map[*cache_shard][]string)
+	var encoded map[string][]byte
+	if cache.aof != nil {
+		encoded = make(map[string][]byte, len(items))
+	}
+	for key, value := range items {
+		if value == nil {
+			return errors.New("value can not be nil")
+		}
+		if cache.aof != nil {
+			data, err := cache.aof.codec.Encode(value)
+			if err != nil {
+				return err
+			}
+			encoded[key] = data
+		}
+		shard := cache.shard(key)
+		shard_keys[shard] = append(shard_keys[shard], key)
+	}
+
+	type replaced_item struct {
+		key    string
+		value  CacheItem
+		reason EvictReason
+	}
+
+	var aof_err error
+	for shard, keys := range shard_keys {
+		var replaced []replaced_item
+		batch := make([]sl_op, 0, len(keys))
+
+		shard.lock.Lock()
+		if cache.Closed() {
+			shard.lock.Unlock()
+			return ErrClosed
+		}
+		for _, key := range keys {
+			value := items[key]
+			tags := cache.liveTags(shard, key)
+			now := cache.now()
+			pre_ele := cache.store(shard, key, value, ttl, 0, tags, &batch)
+			if pre_ele != nil {
+				if reason, ok := overwriteReason(pre_ele, value, now); ok {
+					replaced = append(replaced, replaced_item{key, pre_ele.Value.(CacheItem), reason})
+				}
+			}
+			if cache.aof != nil && aof_err == nil {
+				//logged with the expire time and the sliding of the stored element
+				if ele_, exist := shard.sync_map.Load(key); exist {
+					ele := ele_.(*cache_element)
+					aof_err = cache.aof.append(aofSetEntry(key, ele.Score, ele.Sliding, tags, encoded[key]))
+				}
+			}
+		}
+		shard.dispatchBatch(batch)
+		shard.lock.Unlock()
+
+		for _, item := range replaced {
+			cache.evicted(item.key, item.value, item.reason)
+		}
+	}
+	return aof_err
+}
+
+// MDelete deletes keys and returns how many of them existed.
+// The lock of each shard is taken once and its skiplist gets one command for the whole batch.
+func (cache *Cache) MDelete(keys []string) (int, error) {
+	shard_keys := make(map[*cache_shard][]string)
+	for _, key := range keys {
+		shard := cache.shard(key)
+		shard_keys[shard] = append(shard_keys[shard], key)
+	}
+
+	deleted := 0
+	var aof_err error
+	for shard, keys := range shard_keys {
+		keys := keys
+		count, err := cache.deleteInShard(shard, EvictDeleted, func() []string { return keys })
+		deleted += count
+		if err == ErrClosed {
+			return deleted, err
+		}
+		if err != nil && aof_err == nil {
+			aof_err = err
+		}
+	}
+	return deleted, aof_err
+}
+
+// Flush deletes every key and returns how many were deleted.
+// The lock of each shard is taken once, a key set meanwhile in another shard may or may not be deleted.
+func (cache *Cache) Flush() (int, error) {
+	deleted := 0
+	var aof_err error
+	for _, shard := range cache.shards {
+		shard := shard
+		count, err := cache.deleteInShard(shard, EvictDeleted, func() []string {
+			keys := make([]string, 0, atomic.LoadInt32(&shard.element_count))
+			shard.sync_map.Range(func(key, value interface{}) bool {
+				keys = append(keys, key.(string))
+				return true
+			})
+			return keys
+		})
+		deleted += count
+		if err == ErrClosed {
+			return deleted, err
+		}
+		if err != nil && aof_err == nil {
+			aof_err = err
+		}
+	}
+	return deleted, aof_err
+}
+
+// remove the keys returned by pick, which runs with the shard lock held, and notify OnEvict with reason.
+// The skiplist gets one command for all of them. Like delete_, only deletes are logged and counted as Deletes.
+func (cache *Cache) deleteInShard(shard *cache_shard, reason EvictReason, pick func() []string) (int, error) {
+	type removed_item struct {
+		key   string
+		value CacheItem
+	}
+
+	shard.lock.Lock()
+	if cache.Closed() {
+		shard.lock.Unlock()
+		return 0, ErrClosed
+	}
+	keys := pick()
+	removed := make([]removed_item, 0, len(keys))
+	batch := make([]sl_op, 0, len(keys))
+	var aof_err error
+	for _, key := range keys {
+		pre_ele := cache.remove(shard, key, math.MaxInt64, &batch)
+		if pre_ele == nil {
+			continue
+		}
+		removed = append(removed, removed_item{key, pre_ele.Value.(CacheItem)})
+		if reason == EvictDeleted && cache.aof != nil && aof_err == nil {
+			aof_err = cache.aof.append(aofDeleteEntry(key))
+		}
+	}
+	shard.dispatchBatch(batch)
+	shard.lock.Unlock()
+
+	if reason == EvictDeleted {
+		atomic.AddInt64(&shard.stats.deletes, int64(len(removed)))
+	}
+	for _, item := range removed {
+		cache.evicted(item.key, item.value, reason)
+	}
+	return len(removed), aof_err
+}
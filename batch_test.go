@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_Cache_MSetMGetMDelete(t *testing.T) {
+	var replaced, deleted int32
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	cache, err := New(&CacheConfig{Clock: clock, ShardCount: 4, OnEvict: func(key string, value CacheItem, reason EvictReason) {
+		switch reason {
+		case EvictReplaced:
+			atomic.AddInt32(&replaced, 1)
+		case EvictDeleted:
+			atomic.AddInt32(&deleted, 1)
+		}
+	}})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+
+	items := map[string]CacheItem{}
+	keys := []string{}
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		items[key] = &Person{"Jack", i, "London"}
+		keys = append(keys, key)
+	}
+	if err := cache.MSet(items, 100); err != nil {
+		t.Fatalf("MSet expect nil, but %v", err)
+	}
+	if cache.Items() != 100 {
+		t.Fatalf("items expect 100, but %d", cache.Items())
+	}
+
+	values := cache.MGet(append(keys, "missing"))
+	for i := 0; i < 100; i++ {
+		if values[i] == nil || values[i].(*Person).Age != i {
+			t.Fatalf("MGet value %d expect age %d, but %v", i, i, values[i])
+		}
+	}
+	if values[100] != nil {
+		t.Fatalf("MGet missing key expect nil, but %v", values[100])
+	}
+	if _, ttl := cache.Get("7"); ttl != 100 {
+		t.Fatalf("ttl expect 100, but %d", ttl)
+	}
+
+	// default ttl and replaced items
+	cache.MSet(map[string]CacheItem{"1": &Person{"Tom", 1, "Paris"}}, 0)
+	if v, ttl := cache.Get("1"); v.(*Person).Name != "Tom" || ttl != 30 {
+		t.Fatalf("get '1' expect Tom 30, but %v %d", v, ttl)
+	}
+	if replaced != 1 {
+		t.Fatalf("replaced expect 1, but %d", replaced)
+	}
+
+	n, err := cache.MDelete(append(keys[:50], "missing"))
+	if err != nil || n != 50 {
+		t.Fatalf("MDelete expect 50 nil, but %d %v", n, err)
+	}
+	if cache.Items() != 50 || deleted != 50 || cache.Stats().Deletes != 50 {
+		t.Fatalf("items, deleted, deletes expect 50, but %d %d %d", cache.Items(), deleted, cache.Stats().Deletes)
+	}
+
+	cache.Close()
+	var length int32
+	for _, shard := range cache.shards {
+		length += shard.skip_list.length
+	}
+	if length != 50 {
+		t.Fatalf("skiplist length expect 50 after drain, but %d", length)
+	}
+}
+
+func Test_Cache_MSetNil(t *testing.T) {
+	cache, err := New(nil)
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	if err := cache.MSet(map[string]CacheItem{"a": &Person{}, "b": nil}, 10); err == nil {
+		t.Fatalf("MSet with nil value expect error, but nil")
+	}
+	if cache.Items() != 0 {
+		t.Fatalf("MSet with nil value expect nothing set, but %d items", cache.Items())
+	}
+}
+
+func BenchmarkLocalReference_MSetPointer(b *testing.B) {
+	cache, _ := New(nil)
+	jack := &Person{"Jack", 18, "America"}
+
+	items := map[string]CacheItem{}
+	for i := 0; i < 100; i++ {
+		items[strconv.Itoa(i)] = jack
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.MSet(items, 300)
+	}
+}
+
+func BenchmarkLocalReference_SetPointerBatchOf100(b *testing.B) {
+	cache, _ := New(nil)
+	jack := &Person{"Jack", 18, "America"}
+
+	items := map[string]CacheItem{}
+	for i := 0; i < 100; i++ {
+		items[strconv.Itoa(i)] = jack
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for key, value := range items {
+			cache.SetTTL(key, value, 300)
+		}
+	}
+}
+
+func Test_Cache_Flush(t *testing.T) {
+	var deleted int32
+	cache, err := New(&CacheConfig{ShardCount: 4, OnEvict: func(key string, value CacheItem, reason EvictReason) {
+		if reason == EvictDeleted {
+			atomic.AddInt32(&deleted, 1)
+		}
+	}})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	for i := 0; i < 100; i++ {
+		cache.SetWithTags(strconv.Itoa(i), &Person{"Jack", i, "London"}, 100, "all")
+	}
+	if count, err := cache.Flush(); count != 100 || err != nil {
+		t.Fatalf("Flush expect 100 nil, but %d %v", count, err)
+	}
+	if cache.Items() != 0 || cache.Bytes() != 0 || atomic.LoadInt32(&deleted) != 100 {
+		t.Fatalf("flushed cache expect empty with 100 deletes, but %d %d %d", cache.Items(), cache.Bytes(), deleted)
+	}
+	if count, _ := cache.InvalidateTag("all"); count != 0 {
+		t.Fatalf("InvalidateTag after Flush expect 0, but %d", count)
+	}
+}
+
+func Test_Cache_MSetSlidingReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	open := func() *Cache {
+		cache, err := New(&CacheConfig{
+			Clock:      clock,
+			SlidingTTL: true,
+			AOFPath:    path,
+			AOFCodec:   NewJSONCodec(func() CacheItem { return &Person{} }),
+		})
+		if nil != err {
+			t.Fatalf("New cache instance failed! err=%v", err)
+		}
+		return cache
+	}
+
+	cache := open()
+	if err := cache.MSet(map[string]CacheItem{"a": &Person{"Jack", 18, "London"}}, 100); err != nil {
+		t.Fatalf("MSet expect nil, but %v", err)
+	}
+	cache.Close()
+
+	// restarted 50s later, a Get pushes the expire time by the sliding ttl again
+	clock.Advance(50 * time.Second)
+	cache = open()
+	defer cache.Close()
+	if v, ttl := cache.Get("a"); v == nil || ttl != 100 {
+		t.Fatalf("get 'a' after the replay expect ttl 100, but %v %d", v, ttl)
+	}
+}
@@ -1,28 +1,99 @@
 package cache
 
 import (
+	"context"
 	"errors"
+	"hash/maphash"
+	"math"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// ErrClosed is returned by operations on a cache which has been closed
+var ErrClosed = errors.New("cache closed")
+
 type CacheItem interface {
 	CacheBytes() int
 }
 
+// Equaler is implemented by items which compare by value, CompareAndSwap compares items with Equal if
+// they implement it and with == otherwise, so items of uncomparable types without Equal never match
+type Equaler interface {
+	Equal(other CacheItem) bool
+}
+
+// why an item left the cache
+type EvictReason int
+
+const (
+	EvictExpired  EvictReason = iota + 1 // ttl reached, recycled or overwritten
+	EvictCapacity                        // recycled by the eviction policy once RecycleRatioThreshold is reached
+	EvictDeleted                         // explicitly deleted
+	EvictReplaced                        // overwritten by a different value
+	EvictQuota                           // recycled from a namespace over its BytesQuota
+)
+
+func (reason EvictReason) String() string {
+	switch reason {
+	case EvictExpired:
+		return "expired"
+	case EvictCapacity:
+		return "capacity"
+	case EvictDeleted:
+		return "deleted"
+	case EvictReplaced:
+		return "replaced"
+	case EvictQuota:
+		return "quota"
+	default:
+		return "unknown"
+	}
+}
+
 type cache_element struct {
-	Score int64
-	Value interface{}
+	Score    int64 //expire time in unix millis, the position in the skiplist
+	Value    interface{}
+	Version  uint64     //unique in the cache, changed by every store
+	Sliding  int64      //ttl millis the expire time is pushed to by a Get, 0 for a fixed expire time
+	Tags     []string   //tags of the key in the tag index of its shard, never modified once stored
+	ns       *Namespace //namespace owning the key, nil if none
+	accessed int64      //unix millis of the last Get of a sliding element, atomic
+}
+
+// the expire time of the element, later than Score if a sliding element has been read since it was positioned
+func (ele *cache_element) expire() int64 {
+	if ele.Sliding == 0 {
+		return ele.Score
+	}
+	if expire := atomic.LoadInt64(&ele.accessed) + ele.Sliding; expire > ele.Score {
+		return expire
+	}
+	return ele.Score
 }
 
 type CacheConfig struct {
-	CacheBytesLimit          int64 // max cache size in bytes
-	MaxTtlSecs               int64 // max cache item duration in secs
-	DefaultTtlSecs           int64 // default set ttl
-	RecycleCheckIntervalSecs int   // recycle process cycle in secs
-	RecycleRatioThreshold    int   // 1-100, old items are recycled once cache reach limit, e.g: 30 for 30% percentage
-	RecycleBatchSize         int   // number of items to be recycled in a batch
-	SkipListBufferSize       int   // chan buffer between internal map and skiplist
+	CacheBytesLimit          int64          // max cache size in bytes
+	MaxTtlSecs               int64          // max cache item duration in secs
+	DefaultTtlSecs           int64          // default set ttl
+	RecycleCheckIntervalSecs int            // recycle process cycle in secs
+	RecycleRatioThreshold    int            // 1-100, old items are recycled once cache reach limit, e.g: 30 for 30% percentage
+	RecycleBatchSize         int            // number of items to be recycled in a batch
+	SkipListBufferSize       int            // chan buffer between internal map and skiplist
+	Clock                    Clock          // time source, nil for SystemClock
+	EvictionPolicy           EvictionPolicy // which items are recycled first once RecycleRatioThreshold is reached, nil for ExpiryPolicy
+	ShardCount               int            // keys are split by hash into shards each with its own lock and skiplist routine
+	LoadErrorTtlSecs         int64          // secs GetOrLoad keeps returning a loader error for, 0 for not caching errors
+	AOFPath                  string         // append only log of the writes replayed by New, "" for no log
+	AOFCodec                 Codec          // encodes the values in the append only log, required with AOFPath
+	AOFFsync                 AOFFsyncPolicy // when the append only log is fsynced
+	AOFRewriteMinBytes       int64          // the log is rewritten once it reaches this size and twice its size after the last rewrite
+	SlidingTTL               bool           // every Get of a key pushes its expire time to now + the ttl it was set with
+	ClockResolution          time.Duration  // how often the cached clock is refreshed, which is the precision of the ttls
+	// called once an item left the cache, never with a lock of the cache held.
+	// It runs in the go-routine removing the item: the recycler, or the caller of Delete and Set.
+	OnEvict func(key string, value CacheItem, reason EvictReason)
 }
 
 type Cache struct {
@@ -30,14 +101,22 @@ type Cache struct {
 	cache_config            *CacheConfig
 	recycle_bytes_threshold int64
 	//
-	sync_map   sync.Map
-	skip_list  *skiplist
-	lock       sync.Mutex
-	sl_channel chan func()
+	shards          []*cache_shard
+	shard_seed      maphash.Seed
+	eviction        EvictionPolicy //nil for ExpiryPolicy which uses the skiplists of the shards
+	loads           load_group     //in-flight loads and cached loader errors of GetOrLoad
+	stats           cache_stats
+	aof             *aof_log     //nil if AOFPath is empty
+	namespaces      atomic.Value //map[string]*Namespace by name, copied on write
+	namespaces_lock sync.Mutex   //serializes the writers of namespaces
 	//
-	element_count int32 //total element number
-	element_bytes int64 //total element bytes
-	now_unixtime  int64
+	now_millis  int64  //cached unix millis of the clock
+	version_seq uint64 //last version given to a stored element
+	//lifecycle
+	closed     int32         //set to 1 once Close is called
+	close_chan chan struct{} //closed to stop the skiplist routine
+	loop_stops []func()      //stop the clock and recycle loops
+	routines   sync.WaitGroup
 }
 
 // if passed user_config is nil, then use the default cache_config.
@@ -51,6 +130,15 @@ func New(user_config *CacheConfig) (*Cache, error) {
 		RecycleRatioThreshold:    80,               // 80% usage will trigger recycling
 		RecycleBatchSize:         100,              // 100 items recycled in a batch
 		SkipListBufferSize:       20000,            // 20000 commands for chan buffer between internal map and skiplist
+		Clock:                    SystemClock,      // real time
+		EvictionPolicy:           ExpiryPolicy,     // items expiring soonest are recycled first
+		ShardCount:               1,                // a single lock and skiplist routine
+		LoadErrorTtlSecs:         0,                // loader errors are not cached
+		AOFPath:                  "",               // no append only log
+		AOFFsync:                 AOFFsyncEverySecond,
+		AOFRewriteMinBytes:       1024 * 1024 * 64, // 64M bytes
+		SlidingTTL:               false,            // Get does not change the expire time
+		ClockResolution:          10 * time.Millisecond,
 	}
 
 	//new a cache with default config
@@ -123,6 +211,73 @@ func New(user_config *CacheConfig) (*Cache, error) {
 			cache_config.SkipListBufferSize = user_config.SkipListBufferSize
 		}
 
+		//
+		if user_config.Clock != nil {
+			cache_config.Clock = user_config.Clock
+		}
+
+		//
+		if user_config.EvictionPolicy != nil {
+			cache_config.EvictionPolicy = user_config.EvictionPolicy
+		}
+
+		//
+		if user_config.ShardCount < 0 {
+			return nil, errors.New("config ShardCount error: val < 0")
+		} else if user_config.ShardCount == 0 {
+			//bypass using default value
+		} else {
+			cache_config.ShardCount = user_config.ShardCount
+		}
+
+		//
+		if user_config.LoadErrorTtlSecs < 0 {
+			return nil, errors.New("config LoadErrorTtlSecs error: val < 0")
+		} else if user_config.LoadErrorTtlSecs > cache_config.MaxTtlSecs {
+			return nil, errors.New("config LoadErrorTtlSecs error: val > MaxTtlSecs")
+		} else {
+			cache_config.LoadErrorTtlSecs = user_config.LoadErrorTtlSecs
+		}
+
+		//
+		cache_config.OnEvict = user_config.OnEvict
+
+		//
+		cache_config.SlidingTTL = user_config.SlidingTTL
+
+		//
+		if user_config.ClockResolution < 0 || user_config.ClockResolution > time.Second {
+			return nil, errors.New("config ClockResolution error: val between [1ms,1s]")
+		} else if user_config.ClockResolution == 0 {
+			//bypass using default value
+		} else if user_config.ClockResolution < time.Millisecond {
+			return nil, errors.New("config ClockResolution error: val between [1ms,1s]")
+		} else {
+			cache_config.ClockResolution = user_config.ClockResolution
+		}
+
+		//
+		if user_config.AOFPath != "" && user_config.AOFCodec == nil {
+			return nil, errors.New("config AOFCodec error: nil with AOFPath")
+		}
+		cache_config.AOFPath = user_config.AOFPath
+		cache_config.AOFCodec = user_config.AOFCodec
+
+		//
+		if user_config.AOFFsync < AOFFsyncEverySecond || user_config.AOFFsync > AOFFsyncNever {
+			return nil, errors.New("config AOFFsync error: unknown policy")
+		}
+		cache_config.AOFFsync = user_config.AOFFsync
+
+		//
+		if user_config.AOFRewriteMinBytes < 0 {
+			return nil, errors.New("config AOFRewriteMinBytes error: val < 0")
+		} else if user_config.AOFRewriteMinBytes == 0 {
+			//bypass using default value
+		} else {
+			cache_config.AOFRewriteMinBytes = user_config.AOFRewriteMinBytes
+		}
+
 	}
 
 	var config_recycle_bytes_threshold int64 = (cache_config.CacheBytesLimit * int64(cache_config.RecycleRatioThreshold) / 100)
@@ -133,52 +288,118 @@ func New(user_config *CacheConfig) (*Cache, error) {
 	cache := &Cache{
 		cache_config:            cache_config,
 		recycle_bytes_threshold: config_recycle_bytes_threshold,
-		now_unixtime:            time.Now().Unix(),
-		skip_list:               makeSkiplist(),
-		element_count:           0,
-		element_bytes:           0,
-		sl_channel:              make(chan func(), cache_config.SkipListBufferSize),
+		now_millis:              cache_config.Clock.Now().UnixMilli(),
+		shards:                  make([]*cache_shard, cache_config.ShardCount),
+		shard_seed:              maphash.MakeSeed(),
+		close_chan:              make(chan struct{}),
 	}
 
-	//for efficiency update the unixtime using a go-routine
-	go func() {
-		for {
-			time.Sleep(1 * time.Second)
-			cache.now_unixtime = time.Now().Unix()
-		}
-	}()
+	for i := range cache.shards {
+		cache.shards[i] = makeShard(cache_config.SkipListBufferSize)
+	}
 
-	// routine for processing commands which transfered from sl_channel for skiplist
-	go func() {
-		for {
-			f := <-cache.sl_channel
-			f()
-		}
-	}()
+	//the expiry policy is served by the skiplist directly
+	if _, is_expiry := cache_config.EvictionPolicy.(expiry_policy); !is_expiry {
+		cache.eviction = cache_config.EvictionPolicy
+	}
 
-	//start the recycle go routine
-	safeInfiLoop(func() {
+	//for efficiency update the unix millis using a loop on the clock
+	cache.loop_stops = append(cache.loop_stops, safeInfiLoop(cache_config.Clock, func() {
+		atomic.StoreInt64(&cache.now_millis, cache_config.Clock.Now().UnixMilli())
+	}, nil, cache_config.ClockResolution, cache_config.ClockResolution, &cache.routines))
 
-		// remove expired keys
-		keys := cache.skip_list.GetRangeByScore(0, cache.now_unixtime)
-		for _, key := range keys {
-			cache.Delete(key)
-		}
+	// routines for processing commands which transfered from sl_channel for skiplist
+	for _, shard := range cache.shards {
+		shard := shard
+		cache.routines.Add(1)
+		go func() {
+			defer cache.routines.Done()
+			shard.run(cache.close_chan)
+		}()
+	}
 
-		// check overlimit
-		for int64(cache.Bytes()) >= cache.recycle_bytes_threshold {
-			keys := cache.skip_list.GetRangeByRank(0, int64(cache.cache_config.RecycleBatchSize))
-			for _, key := range keys {
-				cache.Delete(key)
-			}
+	//replay the append only log, then flush it every second and rewrite it once it has grown
+	if cache_config.AOFPath != "" {
+		if err := cache.openAOF(); err != nil {
+			cache.Close()
+			return nil, err
 		}
+		cache.loop_stops = append(cache.loop_stops, safeInfiLoop(cache_config.Clock, func() {
+			cache.aof.flush()
+		}, nil, 1*time.Second, 1*time.Second, &cache.routines))
+		cache.loop_stops = append(cache.loop_stops, safeInfiLoop(cache_config.Clock, func() {
+			if cache.aof.needRewrite(cache_config.AOFRewriteMinBytes) {
+				cache.rewriteAOF()
+			}
+		}, nil, time.Duration(cache_config.RecycleCheckIntervalSecs)*time.Second, 30*time.Second, &cache.routines))
+	}
 
-	}, nil, int64(cache.cache_config.RecycleCheckIntervalSecs), 30)
+	//start the recycle loop
+	cache.loop_stops = append(cache.loop_stops, safeInfiLoop(cache_config.Clock, cache.recycle, nil,
+		time.Duration(cache_config.RecycleCheckIntervalSecs)*time.Second, 30*time.Second, &cache.routines))
 
 	//
 	return cache, nil
 }
 
+// Close stops all the background routines of the cache and waits for the pending skiplist commands to be drained.
+// The append only log is flushed, fsynced and closed once the routines are done.
+// Any later Set/SetTTL/Keep/Delete returns ErrClosed and Get always misses.
+// Closing an already closed cache returns ErrClosed.
+func (cache *Cache) Close() error {
+	return cache.CloseContext(context.Background())
+}
+
+// CloseContext is like Close but gives up waiting for the background routines once ctx is done,
+// in which case ctx.Err() is returned. The cache is closed anyway.
+func (cache *Cache) CloseContext(ctx context.Context) error {
+	cache.lockShards()
+	if cache.Closed() {
+		cache.unlockShards()
+		return ErrClosed
+	}
+	//no writer can dispatch skiplist commands from now on
+	atomic.StoreInt32(&cache.closed, 1)
+	cache.unlockShards()
+
+	for _, stop := range cache.loop_stops {
+		stop()
+	}
+	close(cache.close_chan)
+
+	if ctx.Done() == nil {
+		cache.routines.Wait()
+		return cache.closeAOF()
+	}
+
+	done := make(chan struct{})
+	var aof_err error
+	go func() {
+		cache.routines.Wait()
+		aof_err = cache.closeAOF()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return aof_err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (cache *Cache) closeAOF() error {
+	if cache.aof == nil {
+		return nil
+	}
+	return cache.aof.close()
+}
+
+// whether Close has been called on the cache
+func (cache *Cache) Closed() bool {
+	return atomic.LoadInt32(&cache.closed) == 1
+}
+
 // get the config of this cache
 func (cache *Cache) GetConfig() *CacheConfig {
 	return &CacheConfig{
@@ -189,164 +410,617 @@ func (cache *Cache) GetConfig() *CacheConfig {
 		RecycleRatioThreshold:    cache.cache_config.RecycleRatioThreshold,
 		RecycleBatchSize:         cache.cache_config.RecycleBatchSize,
 		SkipListBufferSize:       cache.cache_config.SkipListBufferSize,
+		Clock:                    cache.cache_config.Clock,
+		EvictionPolicy:           cache.cache_config.EvictionPolicy,
+		ShardCount:               cache.cache_config.ShardCount,
+		LoadErrorTtlSecs:         cache.cache_config.LoadErrorTtlSecs,
+		SlidingTTL:               cache.cache_config.SlidingTTL,
+		OnEvict:                  cache.cache_config.OnEvict,
+		AOFPath:                  cache.cache_config.AOFPath,
+		AOFCodec:                 cache.cache_config.AOFCodec,
+		AOFFsync:                 cache.cache_config.AOFFsync,
+		AOFRewriteMinBytes:       cache.cache_config.AOFRewriteMinBytes,
+		ClockResolution:          cache.cache_config.ClockResolution,
 	}
 }
 
 // get current unix time in the cache
 func (cache *Cache) GetUnixTime() int64 {
-	return cache.now_unixtime
+	return cache.now() / 1000
+}
+
+// get current unix millis in the cache, refreshed every ClockResolution
+func (cache *Cache) GetUnixMilli() int64 {
+	return cache.now()
 }
 
-// todo write docs
+func (cache *Cache) now() int64 {
+	return atomic.LoadInt64(&cache.now_millis)
+}
+
+// ttl secs in millis
+func secsToMillis(secs int64) int64 {
+	return secs * 1000
+}
+
+// remaining millis in ttl secs, rounded up so that a live key never has a ttl of 0
+func millisToSecs(millis int64) int64 {
+	if millis <= 0 {
+		return 0
+	}
+	return (millis + 999) / 1000
+}
+
+// the ttl is in secs rounded up, GetDuration gives the precise one
 func (cache *Cache) Get(key string) (value CacheItem, ttl int64) {
-	prev_ele_, pre_ele_exist_ := cache.sync_map.Load(key)
+	ele, ttl := cache.get(key)
+	if ele == nil {
+		return nil, 0
+	}
+	return ele.Value.(CacheItem), millisToSecs(ttl)
+}
+
+// like Get with the ttl in the precision of ClockResolution
+func (cache *Cache) GetDuration(key string) (value CacheItem, ttl time.Duration) {
+	ele, ttl_millis := cache.get(key)
+	if ele == nil {
+		return nil, 0
+	}
+	return ele.Value.(CacheItem), time.Duration(ttl_millis) * time.Millisecond
+}
+
+// Peek is like GetWithVersion for inspecting the cache: it is not counted as a hit or a miss,
+// does not slide the expire time and is not an access for the eviction policy
+func (cache *Cache) Peek(key string) (value CacheItem, ttl int64, version uint64) {
+	ele, ttl := cache.peek(key)
+	if ele == nil {
+		return nil, 0, 0
+	}
+	return ele.Value.(CacheItem), millisToSecs(ttl), ele.Version
+}
+
+// the live element of key and its ttl in millis, without side effects
+func (cache *Cache) peek(key string) (*cache_element, int64) {
+	if cache.Closed() {
+		return nil, 0
+	}
+	ele_, exist := cache.shard(key).sync_map.Load(key)
+	if !exist {
+		return nil, 0
+	}
+	ele := ele_.(*cache_element)
+	ttl := ele.expire() - cache.now()
+	if ttl <= 0 {
+		return nil, 0
+	}
+	return ele, ttl
+}
+
+// the live element of key and its ttl in millis, counted as a hit or a miss
+func (cache *Cache) get(key string) (*cache_element, int64) {
+	if cache.Closed() {
+		return nil, 0
+	}
+	shard := cache.shard(key)
+	prev_ele_, pre_ele_exist_ := shard.sync_map.Load(key)
 	if !pre_ele_exist_ {
+		atomic.AddInt64(&shard.stats.misses, 1)
 		return nil, 0
 	} else {
 		pre_ele := prev_ele_.(*cache_element)
-		if pre_ele.Score <= cache.now_unixtime {
+		now := cache.now()
+		if pre_ele.expire() <= now {
+			atomic.AddInt64(&shard.stats.misses, 1)
+			atomic.AddInt64(&shard.stats.expired_on_read, 1)
 			return nil, 0
 		} else {
-			return pre_ele.Value.(CacheItem), pre_ele.Score - cache.now_unixtime
+			atomic.AddInt64(&shard.stats.hits, 1)
+			if cache.eviction != nil {
+				cache.eviction.OnAccess(key)
+			}
+			//only the access time is recorded, the skiplist entry is moved later by the recycler
+			if pre_ele.Sliding > 0 && atomic.LoadInt64(&pre_ele.accessed) != now {
+				atomic.StoreInt64(&pre_ele.accessed, now)
+			}
+			return pre_ele, pre_ele.expire() - now
 		}
 	}
 }
 
 func (cache *Cache) Set(key string, value CacheItem) error {
-	return cache.set_(key, value, cache.cache_config.DefaultTtlSecs)
+	return cache.set_(key, value, secsToMillis(cache.cache_config.DefaultTtlSecs))
 }
 
 func (cache *Cache) SetTTL(key string, value CacheItem, ttlSecond int64) error {
 	if ttlSecond <= 0 {
 		return errors.New("ttl <=0 err")
 	}
-	return cache.set_(key, value, ttlSecond)
+	return cache.set_(key, value, secsToMillis(ttlSecond))
+}
+
+// like SetTTL with a ttl in millis precision, the expire time is checked every ClockResolution
+func (cache *Cache) SetTTLDuration(key string, value CacheItem, ttl time.Duration) error {
+	if ttl.Milliseconds() <= 0 {
+		return errors.New("ttl < 1ms err")
+	}
+	return cache.set_(key, value, ttl.Milliseconds())
+}
+
+// like SetTTL, and every Get pushes the expire time to now + ttlSecond whatever SlidingTTL is
+func (cache *Cache) SetSliding(key string, value CacheItem, ttlSecond int64) error {
+	if ttlSecond <= 0 {
+		return errors.New("ttl <=0 err")
+	}
+	_, _, err := cache.setIf(key, value, secsToMillis(ttlSecond), secsToMillis(ttlSecond), nil, false, nil)
+	return err
 }
 
+// Keep replaces the value of key keeping its ttl and tags, nothing is set if key does not exist
 func (cache *Cache) Keep(key string, value CacheItem) error {
-	return cache.set_(key, value, 0)
+	_, _, err := cache.setIf(key, value, 0, 0, nil, true, nil)
+	return err
 }
 
-// for ttlSecond < 0 not allowed
-// for ttlSecond == 0
+// ttl is in millis
+// for ttl < 0 not allowed
+// for ttl == 0
 // -----1. keep the ttl of previous val if previous value exist
 // -----2. nothing will be set if previous value not exist
-// for ttlSecond > MaxTtlSecs, ttl will be adjusted to MaxTtlSecs
-func (cache *Cache) set_(key string, value CacheItem, ttlSecond int64) error {
+// for ttl > MaxTtlSecs, ttl will be adjusted to MaxTtlSecs
+func (cache *Cache) set_(key string, value CacheItem, ttl int64) error {
+	_, _, err := cache.setIf(key, value, ttl, 0, nil, false, nil)
+	return err
+}
+
+// ttl millis capped by MaxTtlSecs
+func (cache *Cache) capTtl(ttl int64) int64 {
+	if max := secsToMillis(cache.cache_config.MaxTtlSecs); ttl > max {
+		return max
+	}
+	return ttl
+}
 
+// like set_, value is only set if cond accepts the live element of key, nil if key is missing or expired.
+// nil cond accepts any element. the stored element is returned, or the live element as cond saw it if nothing is stored.
+// sliding > 0 forces a sliding expire time by these millis, otherwise it is decided by SlidingTTL.
+// tags replace the tags of key, or the tags of the live element are kept if keep_tags is true
+func (cache *Cache) setIf(key string, value CacheItem, ttl int64, sliding int64, tags []string, keep_tags bool, cond func(live *cache_element) bool) (ele *cache_element, stored bool, err error) {
 	if value == nil {
-		return errors.New("value can not be nil")
+		return nil, false, errors.New("value can not be nil")
 	}
+	if ttl < 0 {
+		return nil, false, errors.New("ttl < 0 error")
+	}
+	ttl = cache.capTtl(ttl)
+	sliding = cache.capTtl(sliding)
 
-	if ttlSecond < 0 {
-		return errors.New("ttl < 0 error")
+	//encoded out of the lock
+	var data []byte
+	if cache.aof != nil {
+		if data, err = cache.aof.codec.Encode(value); err != nil {
+			return nil, false, err
+		}
 	}
 
-	if ttlSecond > cache.cache_config.MaxTtlSecs {
-		ttlSecond = cache.cache_config.MaxTtlSecs
+	shard := cache.shard(key)
+	shard.lock.Lock()
+	if cache.Closed() {
+		shard.lock.Unlock()
+		return nil, false, ErrClosed
+	}
+	if cond != nil {
+		var live *cache_element
+		if ele_, exist := shard.sync_map.Load(key); exist {
+			if ele := ele_.(*cache_element); ele.expire() > cache.now() {
+				live = ele
+			}
+		}
+		if !cond(live) {
+			shard.lock.Unlock()
+			return live, false, nil
+		}
 	}
 
-	cache.lock.Lock()
-	defer cache.lock.Unlock()
+	if keep_tags {
+		tags = cache.liveTags(shard, key)
+	}
+	now := cache.now()
+	pre_ele := cache.store(shard, key, value, ttl, sliding, tags, nil)
+	//nothing is stored by Keep of a missing key
+	if ele_, exist := shard.sync_map.Load(key); exist {
+		ele = ele_.(*cache_element)
+	}
+	var aof_err error
+	if cache.aof != nil && ele != nil {
+		//logged with the resulting expire time
+		aof_err = cache.aof.append(aofSetEntry(key, ele.Score, ele.Sliding, tags, data))
+	}
+	shard.lock.Unlock()
+
+	if pre_ele != nil {
+		if reason, ok := overwriteReason(pre_ele, value, now); ok {
+			cache.evicted(key, pre_ele.Value.(CacheItem), reason)
+		}
+	}
+	return ele, true, aof_err
+}
+
+// the tags of the live element of key, with the shard lock held
+func (cache *Cache) liveTags(shard *cache_shard, key string) []string {
+	if ele_, exist := shard.sync_map.Load(key); exist {
+		if ele := ele_.(*cache_element); ele.expire() > cache.now() {
+			return ele.Tags
+		}
+	}
+	return nil
+}
+
+// set key in shard with the shard lock held, ttl must be in [0, MaxTtlSecs] in millis, it is capped by the namespace of key.
+// the previous element of key is returned if it exists.
+// the expire time slides by sliding millis if it is > 0, or by ttl if SlidingTTL is set, ttl == 0 keeps both the ttl and the sliding.
+// tags replace the previous tags of key in the tag index, nil clears them.
+// the skiplist update is appended to batch, or dispatched right away if batch is nil
+func (cache *Cache) store(shard *cache_shard, key string, value CacheItem, ttl int64, sliding int64, tags []string, batch *[]sl_op) *cache_element {
+
+	//whichever way the key is set, the MaxTtlSecs of its namespace applies
+	ns := cache.namespaceOf(key)
+	ttl = ns.capTtl(ttl)
+	sliding = ns.capTtl(sliding)
 
 	//default expire time
-	expire_time := cache.now_unixtime + ttlSecond
+	expire_time := cache.now() + ttl
 
 	//
 	var pre_ele *cache_element = nil
-	prev_ele_, pre_ele_exist_ := cache.sync_map.Load(key)
+	prev_ele_, pre_ele_exist_ := shard.sync_map.Load(key)
 	if pre_ele_exist_ {
 		pre_ele = prev_ele_.(*cache_element)
 	}
 
 	//not meaningful
-	if !pre_ele_exist_ && ttlSecond == 0 {
+	if !pre_ele_exist_ && ttl == 0 {
 		return nil
 	}
 
+	sliding_ttl := sliding
+	if sliding_ttl == 0 && cache.cache_config.SlidingTTL {
+		sliding_ttl = ttl
+	}
+
 	//keep old ttl
-	if pre_ele_exist_ && ttlSecond == 0 {
-		expire_time = pre_ele.Score
+	if pre_ele_exist_ && ttl == 0 {
+		expire_time = pre_ele.expire()
+		sliding_ttl = pre_ele.Sliding
 	}
 
 	//set to map
-	cache.sync_map.Store(key, &cache_element{
-		Score: expire_time,
-		Value: value,
+	shard.sync_map.Store(key, &cache_element{
+		Score:   expire_time,
+		Value:   value,
+		Version: atomic.AddUint64(&cache.version_seq, 1),
+		Sliding: sliding_ttl,
+		Tags:    tags,
+		ns:      ns,
 	})
+	atomic.AddInt64(&shard.stats.sets, 1)
+	if pre_ele_exist_ {
+		pre_ele.ns.removed(pre_ele)
+	}
+	ns.added(value)
+
+	if pre_ele_exist_ {
+		shard.untag(key, pre_ele.Tags)
+		shard.unindexNamespace(pre_ele.ns, key, pre_ele.Score)
+	}
+	shard.tag(key, tags)
+	shard.indexNamespace(ns, key, expire_time)
+
+	if cache.eviction != nil {
+		cache.eviction.OnSet(key, pre_ele_exist_)
+	}
 
 	//statistics
 	if pre_ele_exist_ {
 		//cache.element_count--
 		//cache.element_count++
-		cache.element_bytes -= int64(pre_ele.Value.(CacheItem).CacheBytes())
-		cache.element_bytes += int64(value.CacheBytes())
+		atomic.AddInt64(&shard.element_bytes, int64(value.CacheBytes()-pre_ele.Value.(CacheItem).CacheBytes()))
 	} else {
-		cache.element_count++
-		cache.element_bytes += int64(value.CacheBytes())
+		atomic.AddInt32(&shard.element_count, 1)
+		atomic.AddInt64(&shard.element_bytes, int64(value.CacheBytes()))
 	}
 
 	//dispatch update msg to chan
-	cache.sl_channel <- func() {
-		if pre_ele_exist_ {
-			cache.skip_list.remove(key, pre_ele.Score)
-		}
-		cache.skip_list.insert(key, expire_time)
+	op := sl_op{key: key, insert: true, insert_score: expire_time}
+	if pre_ele_exist_ {
+		op.remove, op.remove_score = true, pre_ele.Score
 	}
+	shard.dispatch(op, batch)
 
-	return nil
+	return pre_ele
 }
 
-func (cache *Cache) Delete(key string) {
-	cache.lock.Lock()
-	defer cache.lock.Unlock()
+func (cache *Cache) Delete(key string) error {
+	return cache.delete_(key, math.MaxInt64, EvictDeleted)
+}
 
-	prev_ele_, pre_ele_exist_ := cache.sync_map.Load(key)
-	if pre_ele_exist_ {
-		//
-		pre_ele := prev_ele_.(*cache_element)
-		cache.sync_map.Delete(key)
+// delete key if its expire time is <= max_score, OnEvict is notified with reason
+func (cache *Cache) delete_(key string, max_score int64, reason EvictReason) error {
+	shard := cache.shard(key)
+	shard.lock.Lock()
+	if cache.Closed() {
+		shard.lock.Unlock()
+		return ErrClosed
+	}
+	pre_ele := cache.remove(shard, key, max_score, nil)
+	var aof_err error
+	if pre_ele != nil && reason == EvictDeleted && cache.aof != nil {
+		//expired keys are dropped by replay and over capacity ones are recycled again, only deletes are logged
+		aof_err = cache.aof.append(aofDeleteEntry(key))
+	}
+	shard.lock.Unlock()
+
+	if pre_ele != nil {
+		if reason == EvictDeleted {
+			atomic.AddInt64(&shard.stats.deletes, 1)
+		}
+		cache.evicted(key, pre_ele.Value.(CacheItem), reason)
+	}
+	return aof_err
+}
 
-		//statistics
-		cache.element_count--
-		cache.element_bytes -= int64(pre_ele.Value.(CacheItem).CacheBytes())
+// remove key from shard with the shard lock held if its expire time is <= max_score.
+// the removed element is returned, nil if nothing is removed.
+// the skiplist update is appended to batch, or dispatched right away if batch is nil
+func (cache *Cache) remove(shard *cache_shard, key string, max_score int64, batch *[]sl_op) *cache_element {
+	prev_ele_, pre_ele_exist_ := shard.sync_map.Load(key)
+	if !pre_ele_exist_ {
+		return nil
+	}
 
-		//dispatch update msg to chan
-		cache.sl_channel <- func() {
-			cache.skip_list.remove(key, pre_ele.Score)
+	//
+	pre_ele := prev_ele_.(*cache_element)
+	if expire := pre_ele.expire(); expire > max_score {
+		//read since it was positioned, the skiplist entry catches up with the sliding expire time
+		if pre_ele.Score <= max_score {
+			cache.moveExpire(shard, key, pre_ele, expire, batch)
 		}
+		return nil
+	}
+	shard.sync_map.Delete(key)
+	shard.untag(key, pre_ele.Tags)
+	shard.unindexNamespace(pre_ele.ns, key, pre_ele.Score)
+	pre_ele.ns.removed(pre_ele)
+
+	if cache.eviction != nil {
+		cache.eviction.OnDelete(key)
+	}
+
+	//statistics
+	atomic.AddInt32(&shard.element_count, -1)
+	atomic.AddInt64(&shard.element_bytes, -int64(pre_ele.Value.(CacheItem).CacheBytes()))
+
+	//dispatch update msg to chan
+	shard.dispatch(sl_op{key: key, remove: true, remove_score: pre_ele.Score}, batch)
+	return pre_ele
+}
+
+// count the eviction and notify OnEvict, must not be called with a shard lock held
+func (cache *Cache) evicted(key string, value CacheItem, reason EvictReason) {
+	atomic.AddInt64(&cache.stats.evictions[reason], 1)
+	if cache.cache_config.OnEvict != nil {
+		cache.cache_config.OnEvict(key, value, reason)
+	}
+}
+
+// why pre_ele left the cache when it was overwritten by value at now, ok is false if it did not leave.
+// an element expired but not recycled yet has expired, a live one is replaced unless value is the same item
+func overwriteReason(pre_ele *cache_element, value CacheItem, now int64) (reason EvictReason, ok bool) {
+	if pre_ele.expire() <= now {
+		return EvictExpired, true
+	}
+	return EvictReplaced, !sameItem(pre_ele.Value.(CacheItem), value)
+}
+
+// whether a and b are the same item, by Equal if a implements Equaler.
+// Otherwise items of uncomparable types are never the same
+func sameItem(a CacheItem, b CacheItem) bool {
+	if equaler, ok := a.(Equaler); ok {
+		return equaler.Equal(b)
+	}
+	type_a := reflect.TypeOf(a)
+	if type_a != reflect.TypeOf(b) || !type_a.Comparable() {
+		return false
 	}
+	return a == b
 }
 
+// total items of all the shards
 func (cache *Cache) Items() int32 {
-	return cache.element_count
+	var count int32
+	for _, shard := range cache.shards {
+		count += atomic.LoadInt32(&shard.element_count)
+	}
+	return count
 }
 
+// total bytes of all the shards
 func (cache *Cache) Bytes() int32 {
-	return int32(cache.element_bytes)
+	var bytes int64
+	for _, shard := range cache.shards {
+		bytes += atomic.LoadInt64(&shard.element_bytes)
+	}
+	return int32(bytes)
 }
 
-func safeInfiLoop(todo func(), onPanic func(err interface{}), interval int64, redoDelaySec int64) {
-	runChannel := make(chan struct{})
-	go func() {
-		for {
-			<-runChannel
-			go func() {
-				defer func() {
-					if err := recover(); err != nil {
-						if onPanic != nil {
-							onPanic(err)
-						}
-						time.Sleep(time.Duration(redoDelaySec) * time.Second)
-						runChannel <- struct{}{}
-					}
-				}()
-				for {
-					todo()
-					time.Sleep(time.Duration(interval) * time.Second)
+// remove the expired keys of every shard,
+// then evict keys by the eviction policy until the total bytes are under recycle_bytes_threshold
+func (cache *Cache) recycle() {
+	start := time.Now()
+	defer func() {
+		cache.stats.recycled(time.Since(start))
+	}()
+
+	// remove expired keys
+	now := cache.cache_config.Clock.Now().UnixMilli()
+	for _, shard := range cache.shards {
+		var keys []string
+		if !cache.sl_sync(shard, func() {
+			keys = shard.skip_list.GetRangeByScore(0, now)
+		}) {
+			return
+		}
+		for _, key := range keys {
+			//the key may have been set again since
+			cache.delete_(key, now-1, EvictExpired)
+		}
+	}
+	cache.loads.purge(now)
+
+	// namespaces over their quota first
+	cache.recycleNamespaces()
+
+	// check overlimit
+	batch_size := cache.cache_config.RecycleBatchSize
+	shard_batch_size := batch_size / len(cache.shards)
+	if shard_batch_size < 1 {
+		shard_batch_size = 1
+	}
+	for int64(cache.Bytes()) >= cache.recycle_bytes_threshold {
+		var keys []string
+		if cache.eviction != nil {
+			keys = cache.eviction.Victims(batch_size)
+		} else {
+			// the soonest expiring keys of every shard
+			for _, shard := range cache.shards {
+				var shard_keys []string
+				if !cache.sl_sync(shard, func() {
+					shard_keys = shard.skip_list.GetRangeByRank(1, int64(shard_batch_size)+1)
+				}) {
+					return
 				}
-			}()
+				keys = append(keys, shard_keys...)
+			}
 		}
-	}()
-	runChannel <- struct{}{}
+		if len(keys) == 0 || cache.Closed() {
+			return
+		}
+		for _, key := range keys {
+			if cache.eviction != nil {
+				cache.delete_(key, math.MaxInt64, EvictCapacity)
+				continue
+			}
+			//the skiplist position of a sliding key read since it was positioned is stale,
+			//it is moved to its expire time instead and deleted by a later round only if it is still the soonest
+			if ele_, exist := cache.shard(key).sync_map.Load(key); exist {
+				cache.delete_(key, ele_.(*cache_element).Score, EvictCapacity)
+			}
+		}
+	}
+}
+
+// the shard owning key
+func (cache *Cache) shard(key string) *cache_shard {
+	if len(cache.shards) == 1 {
+		return cache.shards[0]
+	}
+	return cache.shards[maphash.String(cache.shard_seed, key)%uint64(len(cache.shards))]
+}
+
+// lock all the shards in order
+func (cache *Cache) lockShards() {
+	for _, shard := range cache.shards {
+		shard.lock.Lock()
+	}
+}
+
+func (cache *Cache) unlockShards() {
+	for i := len(cache.shards) - 1; i >= 0; i-- {
+		cache.shards[i].lock.Unlock()
+	}
+}
+
+// run f on the skiplist routine of shard after all the pending commands and wait for it to finish.
+// false is returned without running f if the cache is closed.
+func (cache *Cache) sl_sync(shard *cache_shard, f func()) bool {
+	done := make(chan struct{})
+
+	shard.lock.Lock()
+	if cache.Closed() {
+		shard.lock.Unlock()
+		return false
+	}
+	//commands dispatched before close are always drained, so done will be closed
+	shard.sl_channel <- func() {
+		f()
+		close(done)
+	}
+	shard.lock.Unlock()
+
+	<-done
+	return true
+}
+
+// run todo every interval on the clock until the returned stop is called,
+// a panic in todo delays the next run by redoDelay
+func safeInfiLoop(clock Clock, todo func(), onPanic func(err interface{}), interval time.Duration, redoDelay time.Duration, wg *sync.WaitGroup) (stop func()) {
+	run := func() (ok bool) {
+		defer func() {
+			if err := recover(); err != nil {
+				if onPanic != nil {
+					onPanic(err)
+				}
+				ok = false
+			}
+		}()
+		todo()
+		return true
+	}
+
+	var lock sync.Mutex
+	var timer Timer
+	stopped := false
+
+	//must be called with lock held
+	var schedule func(delay time.Duration)
+	schedule = func(delay time.Duration) {
+		wg.Add(1)
+		timer = clock.AfterFunc(delay, func() {
+			defer wg.Done()
+
+			lock.Lock()
+			if stopped {
+				lock.Unlock()
+				return
+			}
+			lock.Unlock()
+
+			next := interval
+			if !run() {
+				next = redoDelay
+			}
+
+			lock.Lock()
+			if !stopped {
+				schedule(next)
+			}
+			lock.Unlock()
+		})
+	}
+
+	lock.Lock()
+	schedule(interval)
+	lock.Unlock()
+
+	return func() {
+		lock.Lock()
+		defer lock.Unlock()
+		if stopped {
+			return
+		}
+		stopped = true
+		//the pending run will never happen
+		if timer.Stop() {
+			wg.Done()
+		}
+	}
 }
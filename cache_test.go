@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	"log"
 	"math/rand"
 	"runtime"
@@ -56,8 +57,8 @@ func EqualWithEps(a, b, eps int64) bool {
 }
 
 func Test_Cache_Simple(t *testing.T) {
-
-	cache, err := New(nil)
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	cache, err := New(&CacheConfig{Clock: clock})
 
 	if nil != err {
 		t.Fatalf("New cache instance failed! err=%v", err)
@@ -123,8 +124,8 @@ func Test_Cache_Simple(t *testing.T) {
 	log.Println("origin a")
 	log.Println(*jack)
 
-	log.Println("To simulate TTLs to timeout, waiting for 10 seconds ...")
-	time.Sleep(10 * time.Second) // wait timeout for all ttls
+	log.Println("To simulate TTLs to timeout, advancing 10 seconds ...")
+	clock.Advance(10 * time.Second) // wait timeout for all ttls
 
 	if int32(0) != cache.Items() {
 		t.Fatalf("count of cache's total items should be 0 now, but %d", cache.Items())
@@ -158,8 +159,46 @@ func Test_Cache_Simple(t *testing.T) {
 	}
 }
 
+func Test_Cache_Peek(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	lru := NewLRUPolicy()
+	cache, err := New(&CacheConfig{Clock: clock, EvictionPolicy: lru, RecycleCheckIntervalSecs: 1})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	jack := &Person{"Jack", 18, "London"}
+	cache.SetSliding("a", jack, 10)
+	cache.SetTTL("b", jack, 10)
+	_, _, version := cache.GetWithVersion("a")
+	before := *cache.Stats()
+
+	clock.Advance(5 * time.Second)
+	if v, ttl, ver := cache.Peek("a"); v != jack || ttl != 5 || ver != version {
+		t.Fatalf("Peek 'a' expect %v with ttl 5 and version %d, but %v %d %d", jack, version, v, ttl, ver)
+	}
+	if v, _, _ := cache.Peek("missing"); v != nil {
+		t.Fatalf("Peek 'missing' expect nil, but %v", v)
+	}
+	if after := *cache.Stats(); after.Hits != before.Hits || after.Misses != before.Misses {
+		t.Fatalf("Peek expect no hit or miss, but %+v before %+v", after, before)
+	}
+	// not an access for the lru, a was accessed last by GetWithVersion
+	cache.Peek("b")
+	if victims := lru.Victims(1); len(victims) != 1 || victims[0] != "b" {
+		t.Fatalf("lru victims expect [b], but %v", victims)
+	}
+	// the sliding expire time is not pushed
+	clock.Advance(6 * time.Second)
+	if v, _, _ := cache.Peek("a"); v != nil {
+		t.Fatalf("Peek 'a' expect expired, but %v", v)
+	}
+}
+
 func Test_Cache_Expire(t *testing.T) {
-	cache, err := New(nil)
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	cache, err := New(&CacheConfig{Clock: clock})
 
 	if nil != err {
 		t.Fatalf("New cache instance failed! err=%v", err)
@@ -419,17 +458,19 @@ func Test_Cache_Expire(t *testing.T) {
 		if count > 45 {
 			return
 		}
-		time.Sleep(time.Second)
+		clock.Advance(time.Second)
 	}
 }
 
 func Test_Cache_SetAndRemove(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
 	jack := &Person{"Jack", 18, "America"}
-	cache, err := New(nil)
+	cache, err := New(&CacheConfig{Clock: clock})
 
 	if nil != err {
 		t.Fatalf("New cache instance failed! err=%v", err)
 	}
+	defer cache.Close()
 
 	log.Println("start")
 	printMemStats()
@@ -452,7 +493,10 @@ func Test_Cache_SetAndRemove(t *testing.T) {
 		log.Println("finish set")
 		printMemStats()
 
-		time.Sleep(2 * time.Second)
+		clock.Advance(2 * time.Second)
+		if v, _ := cache.Get("0"); v != nil {
+			t.Fatalf("get '0' after the ttl should be nil, but %v", v)
+		}
 	}
 
 	log.Println("finish")
@@ -460,37 +504,47 @@ func Test_Cache_SetAndRemove(t *testing.T) {
 }
 
 func Test_Cache_FastRecycling(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
 	jack := &Person{"Jack", 18, "America"}
 
+	// the limit fits exactly the items set, as at the full 1000*10000 scale
+	const items = 10 * 10000
 	cache, err := New(&CacheConfig{
-		CacheBytesLimit: 1000 * 10000 * 40,
+		CacheBytesLimit: items * 40,
+		Clock:           clock,
 	})
 
 	if nil != err {
 		t.Fatalf("New cache instance failed! err=%v", err)
 	}
+	defer cache.Close()
 
-	for j := 0; j < 1000*10000; j++ {
+	for j := 0; j < items; j++ {
 		cache.SetTTL(strconv.Itoa(j), jack, int64(60))
 	}
 
 	for i := 0; i < 50; i++ {
 		log.Println("total items:", cache.Items())
 		log.Println("total bytes:", cache.Bytes())
-		time.Sleep(1 * time.Second)
+		clock.Advance(time.Second)
 	}
-
 }
+
 func Test_Cache_BigAmountKey(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
 	jack := &Person{"Jack", 18, "America"}
 
+	// a hundredth of the 100*10000 keys and of the limit they were set under
+	const items = 1 * 10000
 	cache, err := New(&CacheConfig{
-		CacheBytesLimit: 1024 * 1024 * 50 * 4,
+		CacheBytesLimit: 1024 * 1024 * 50 * 4 / 100,
+		Clock:           clock,
 	})
 
 	if nil != err {
 		t.Fatalf("New cache instance failed! err=%v", err)
 	}
+	defer cache.Close()
 
 	log.Println("start")
 	printMemStats()
@@ -505,7 +559,7 @@ func Test_Cache_BigAmountKey(t *testing.T) {
 		log.Println("mem start set")
 		printMemStats()
 
-		for j := 0; j < 100*10000; j++ {
+		for j := 0; j < items; j++ {
 			cache.SetTTL(strconv.Itoa(j), jack, int64(rand.Intn(10)+10))
 		}
 
@@ -515,18 +569,18 @@ func Test_Cache_BigAmountKey(t *testing.T) {
 			t.Fatalf("total bytes expect %d*%d, but %d", jack.CacheBytes(), cache.Items(), cache.Bytes())
 		}
 
-		if int32(100*10000) != cache.Items() {
-			t.Fatalf("expect total items: 100*10000, but %d", cache.Items())
+		if int32(items) != cache.Items() {
+			t.Fatalf("expect total items: %d, but %d", items, cache.Items())
 		}
 
-		if 100*10000*jack.CacheBytes() != int(cache.Bytes()) {
-			t.Fatalf("expect total bytes: 100*10000*%d, but %d", jack.CacheBytes(), cache.Bytes())
+		if items*jack.CacheBytes() != int(cache.Bytes()) {
+			t.Fatalf("expect total bytes: %d*%d, but %d", items, jack.CacheBytes(), cache.Bytes())
 		}
 
 		log.Println("mem after set")
-		log.Printf("unix time now: %d\n", time.Now().Unix())
+		log.Printf("unix time now: %d\n", clock.Now().Unix())
 		printMemStats()
-		time.Sleep(time.Second)
+		clock.Advance(time.Second)
 	}
 
 	log.Println("~~~~~~")
@@ -541,7 +595,7 @@ func Test_Cache_BigAmountKey(t *testing.T) {
 
 	count := 0
 	for {
-		time.Sleep(1 * time.Second)
+		clock.Advance(time.Second)
 		log.Println("---job finished---")
 		printMemStats()
 		count++
@@ -553,7 +607,9 @@ func Test_Cache_BigAmountKey(t *testing.T) {
 }
 
 func Test_Cache_RandomSet(t *testing.T) {
-	cache, _ := New(nil)
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	cache, _ := New(&CacheConfig{Clock: clock})
+	defer cache.Close()
 	jack := &Person{"Jack", 18, "America"}
 
 	cache.SetTTL("a", jack, 15)
@@ -575,8 +631,9 @@ func Test_Cache_RandomSet(t *testing.T) {
 	log.Printf("e==>%v %v", v, ttl)
 
 	log.Println("start amount set")
+	// 200 rounds of a hundredth of the 10000 random keys
 	for i := 0; i < 200; i++ {
-		for j := 0; j < 10000; j++ {
+		for j := 0; j < 100; j++ {
 			num := rand.Intn(9999999999999)
 			key := strconv.Itoa(num)
 			cache.SetTTL(key, jack, int64(rand.Intn(30)+20))
@@ -592,7 +649,7 @@ func Test_Cache_RandomSet(t *testing.T) {
 	}
 
 	for i := 0; i < 70; i++ {
-		time.Sleep(time.Second)
+		clock.Advance(time.Second)
 		log.Println("--------------")
 		v, ttl = cache.Get("a")
 		log.Printf("a==>%v %v", v, ttl)
@@ -613,7 +670,8 @@ func Test_Cache_RandomSet(t *testing.T) {
 }
 
 func Test_Cache_KeepTTL(t *testing.T) {
-	cache, _ := New(nil)
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	cache, _ := New(&CacheConfig{Clock: clock})
 	mayun := &Person{"Ma Yun", 58, "China"}
 	jack := &Person{"Jack Ma", 18, "America"}
 
@@ -658,7 +716,7 @@ func Test_Cache_KeepTTL(t *testing.T) {
 		}
 	}
 
-	time.Sleep(5 * time.Second)
+	clock.Advance(5 * time.Second)
 
 	cache.SetTTL("a", jack, 300) // update ttl to 300 for key 'a'
 	cache.Keep("b", jack)        // do nothing
@@ -682,7 +740,7 @@ func Test_Cache_KeepTTL(t *testing.T) {
 		if v != jack {
 			t.Fatalf("item of key 'b' expect %v, but %v", jack, v)
 		}
-		if !EqualWithEps(40-5, ttl, 1) {
+		if ttl != 40-5 {
 			t.Fatalf("ttl of key 'b' expect %d-5, but %d", 40, ttl)
 		}
 	}
@@ -694,7 +752,7 @@ func Test_Cache_KeepTTL(t *testing.T) {
 		if v != mayun {
 			t.Fatalf("item of key 'c' expect %v, but %v", mayun, v)
 		}
-		if !EqualWithEps(50-5, ttl, 1) {
+		if ttl != 50-5 {
 			t.Fatalf("ttl of key 'c' expect %d-5, but %d", 50, ttl)
 		}
 	}
@@ -708,13 +766,14 @@ func Test_Cache_KeepTTL(t *testing.T) {
 		log.Printf("b==>%v %v", v, ttl)
 		v, ttl = cache.Get("c")
 		log.Printf("c==>%v %v", v, ttl)
-		time.Sleep(time.Second)
+		clock.Advance(time.Second)
 	}
 
 }
 
 func Test_Cache_SetTTL(t *testing.T) {
-	cache, _ := New(nil)
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	cache, _ := New(&CacheConfig{Clock: clock})
 	mayun := &Person{"Ma Yun", 58, "China"}
 
 	TTLs := []int64{1, 20000, 0, -100, 200, 45, 346547457457457, -20000, 434, 9}
@@ -735,12 +794,333 @@ func Test_Cache_SetTTL(t *testing.T) {
 			// }
 
 			TTL := Max(Clamp(TTLs[j], 0, 7200)-int64(i), 0)
-			if !EqualWithEps(TTL, ttl, 1) {
+			if TTL != ttl {
 				t.Fatalf("input %d, expect %d, but %v", TTLs[j], TTL, ttl)
 			}
 		}
 		log.Println("total key", cache.Items())
-		time.Sleep(time.Second)
+		clock.Advance(time.Second)
+	}
+}
+
+func Test_Cache_SetTTLDuration(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	cache, err := New(&CacheConfig{Clock: clock})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	jack := &Person{"Jack", 18, "London"}
+	if err := cache.SetTTLDuration("a", jack, 1500*time.Millisecond); err != nil {
+		t.Fatalf("SetTTLDuration expect nil, but %v", err)
+	}
+	if err := cache.SetTTLDuration("b", jack, 500*time.Microsecond); err == nil {
+		t.Fatalf("SetTTLDuration under 1ms expect error, but nil")
+	}
+
+	if v, ttl := cache.GetDuration("a"); v != jack || ttl != 1500*time.Millisecond {
+		t.Fatalf("get 'a' expect %v 1.5s, but %v %v", jack, v, ttl)
+	}
+	// the secs ttl is rounded up
+	if _, ttl := cache.Get("a"); ttl != 2 {
+		t.Fatalf("get 'a' ttl expect 2, but %d", ttl)
+	}
+
+	clock.Advance(1200 * time.Millisecond)
+	if v, ttl := cache.GetDuration("a"); v != jack || ttl != 300*time.Millisecond {
+		t.Fatalf("get 'a' expect %v 300ms, but %v %v", jack, v, ttl)
+	}
+	if _, ttl := cache.Get("a"); ttl != 1 {
+		t.Fatalf("get 'a' ttl expect 1, but %d", ttl)
+	}
+
+	clock.Advance(300 * time.Millisecond)
+	if v, ttl := cache.GetDuration("a"); v != nil || ttl != 0 {
+		t.Fatalf("get 'a' expect nil 0 once expired, but %v %v", v, ttl)
+	}
+}
+
+func Test_Cache_ClockResolution(t *testing.T) {
+	for _, resolution := range []time.Duration{-time.Millisecond, time.Microsecond, 2 * time.Second} {
+		if _, err := New(&CacheConfig{ClockResolution: resolution}); err == nil {
+			t.Fatalf("ClockResolution %v expect error, but nil", resolution)
+		}
+	}
+
+	cache, err := New(&CacheConfig{ClockResolution: 5 * time.Millisecond})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+	if resolution := cache.GetConfig().ClockResolution; resolution != 5*time.Millisecond {
+		t.Fatalf("ClockResolution expect 5ms, but %v", resolution)
+	}
+}
+
+func Test_Cache_Close(t *testing.T) {
+	routines := runtime.NumGoroutine()
+
+	cache, err := New(nil)
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+
+	jack := &Person{"Jack", 18, "London"}
+	for i := 0; i < 1000; i++ {
+		cache.SetTTL(strconv.Itoa(i), jack, 60)
+	}
+
+	if err := cache.Close(); err != nil {
+		t.Fatalf("close cache expect nil error, but %v", err)
+	}
+
+	//pending skiplist commands must be drained before close returns
+	if int32(1000) != cache.shards[0].skip_list.length {
+		t.Fatalf("skiplist length expect 1000 after drain, but %d", cache.shards[0].skip_list.length)
+	}
+
+	if err := cache.Close(); err != ErrClosed {
+		t.Fatalf("close a closed cache expect ErrClosed, but %v", err)
+	}
+	if err := cache.SetTTL("a", jack, 5); err != ErrClosed {
+		t.Fatalf("SetTTL on a closed cache expect ErrClosed, but %v", err)
+	}
+	if err := cache.Set("a", jack); err != ErrClosed {
+		t.Fatalf("Set on a closed cache expect ErrClosed, but %v", err)
+	}
+	if err := cache.Delete("1"); err != ErrClosed {
+		t.Fatalf("Delete on a closed cache expect ErrClosed, but %v", err)
+	}
+	if v, ttl := cache.Get("1"); v != nil || ttl != 0 {
+		t.Fatalf("Get on a closed cache expect nil 0, but %v %d", v, ttl)
+	}
+
+	if routines != runtime.NumGoroutine() {
+		t.Fatalf("goroutines expect %d after close, but %d", routines, runtime.NumGoroutine())
+	}
+}
+
+func Test_Cache_CloseContext(t *testing.T) {
+	cache, err := New(nil)
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := cache.CloseContext(ctx); err != nil {
+		t.Fatalf("close cache expect nil error, but %v", err)
+	}
+	if !cache.Closed() {
+		t.Fatalf("cache expect closed")
+	}
+}
+
+func Test_Cache_FakeClockRecycling(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	jack := &Person{"Jack", 18, "America"}
+
+	cache, err := New(&CacheConfig{
+		CacheBytesLimit: int64(jack.CacheBytes()) * 1000,
+		Clock:           clock,
+	})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	for j := 0; j < 1000; j++ {
+		cache.SetTTL(strconv.Itoa(j), jack, int64(j%100+10))
+	}
+
+	// recycler runs once every RecycleCheckIntervalSecs
+	clock.Advance(4 * time.Second)
+	if int32(1000) != cache.Items() {
+		t.Fatalf("count of cache's total items should be 1000, but %d", cache.Items())
+	}
+
+	clock.Advance(1 * time.Second)
+	if int64(cache.Bytes()) >= cache.recycle_bytes_threshold {
+		t.Fatalf("total bytes expect < %d after recycling, but %d", cache.recycle_bytes_threshold, cache.Bytes())
+	}
+
+	// the soonest expiring items are recycled first
+	if v, _ := cache.Get("0"); v != nil {
+		t.Fatalf("get '0' from cache should be nil, but %v", v)
+	}
+	if v, _ := cache.Get("99"); v != jack {
+		t.Fatalf("get '99' from cache should be %v, but %v", jack, v)
+	}
+}
+
+func Test_Cache_Shards(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	jack := &Person{"Jack", 18, "America"}
+
+	cache, err := New(&CacheConfig{
+		CacheBytesLimit: int64(jack.CacheBytes()) * 10000,
+		ShardCount:      8,
+		Clock:           clock,
+	})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for j := g * 1000; j < (g+1)*1000; j++ {
+				cache.SetTTL(strconv.Itoa(j), jack, int64(j%2*100+10))
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if int32(8000) != cache.Items() {
+		t.Fatalf("count of cache's total items should be 8000, but %d", cache.Items())
+	}
+	if int32(8000*jack.CacheBytes()) != cache.Bytes() {
+		t.Fatalf("count of cache's total bytes should be 8000*%d, but %d", jack.CacheBytes(), cache.Bytes())
+	}
+	for i, shard := range cache.shards {
+		if shard.element_count == 0 {
+			t.Fatalf("shard %d expect some keys", i)
+		}
+	}
+
+	// half of the keys expire
+	clock.Advance(15 * time.Second)
+	if int32(4000) != cache.Items() {
+		t.Fatalf("count of cache's total items should be 4000, but %d", cache.Items())
+	}
+
+	// over the limit, the recycler of every shard evicts
+	for j := 8000; j < 12000; j++ {
+		cache.SetTTL(strconv.Itoa(j), jack, 60)
+	}
+	clock.Advance(5 * time.Second)
+	if int64(cache.Bytes()) >= cache.recycle_bytes_threshold {
+		t.Fatalf("total bytes expect < %d after recycling, but %d", cache.recycle_bytes_threshold, cache.Bytes())
+	}
+	if cache.Items()*int32(jack.CacheBytes()) != cache.Bytes() {
+		t.Fatalf("total bytes expect %d*%d, but %d", jack.CacheBytes(), cache.Items(), cache.Bytes())
+	}
+
+	if _, err := New(&CacheConfig{ShardCount: -1}); err == nil {
+		t.Fatalf("negative ShardCount expect error")
+	}
+}
+
+func Test_Cache_OnEvict(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	jack := &Person{"Jack", 18, "America"}
+	rose := &Person{"Rose", 17, "Paris"}
+
+	type eviction struct {
+		key    string
+		value  CacheItem
+		reason EvictReason
+	}
+	var lock sync.Mutex
+	evictions := []eviction{}
+
+	var cache *Cache
+	cache, err := New(&CacheConfig{
+		CacheBytesLimit:  int64(jack.CacheBytes()) * 100,
+		RecycleBatchSize: 10,
+		Clock:            clock,
+		OnEvict: func(key string, value CacheItem, reason EvictReason) {
+			if key == "evicted" {
+				return
+			}
+
+			// no lock of the cache is held
+			cache.Get(key)
+			cache.SetTTL("evicted", rose, 1)
+			cache.Delete("evicted")
+			lock.Lock()
+			evictions = append(evictions, eviction{key, value, reason})
+			lock.Unlock()
+		},
+	})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	cache.SetTTL("a", jack, 3)
+	cache.SetTTL("a", jack, 3) // same value, nothing evicted
+	cache.SetTTL("a", rose, 3)
+	cache.Keep("a", rose)
+	cache.SetTTL("b", jack, 100)
+	cache.Delete("b")
+	cache.Delete("b")
+
+	expect := []eviction{{"a", jack, EvictReplaced}, {"b", jack, EvictDeleted}}
+	if len(evictions) != len(expect) || evictions[0] != expect[0] || evictions[1] != expect[1] {
+		t.Fatalf("evictions expect %v, but %v", expect, evictions)
+	}
+
+	clock.Advance(5 * time.Second)
+	if len(evictions) != 3 || evictions[2] != (eviction{"a", rose, EvictExpired}) {
+		t.Fatalf("expired eviction of 'a' expect, but %v", evictions)
+	}
+
+	for j := 0; j < 100; j++ {
+		cache.SetTTL(strconv.Itoa(j), jack, 3600)
+	}
+	clock.Advance(5 * time.Second)
+	capacity := 0
+	for _, e := range evictions[3:] {
+		if e.reason != EvictCapacity {
+			t.Fatalf("eviction reason expect %v, but %v", EvictCapacity, e.reason)
+		}
+		capacity++
+	}
+	if int32(100-capacity) != cache.Items() || capacity == 0 {
+		t.Fatalf("capacity evictions expect %d, but %d", 100-cache.Items(), capacity)
+	}
+}
+
+func Test_Cache_OverwriteExpired(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	jack := &Person{"Jack", 18, "America"}
+	rose := &Person{"Rose", 17, "Paris"}
+
+	var reasons []EvictReason
+	cache, err := New(&CacheConfig{Clock: clock, RecycleCheckIntervalSecs: 60, OnEvict: func(key string, value CacheItem, reason EvictReason) {
+		reasons = append(reasons, reason)
+	}})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	// expired but not recycled yet
+	overwrites := map[string]func(key string){
+		"Set":         func(key string) { cache.SetTTL(key, rose, 10) },
+		"Keep":        func(key string) { cache.Keep(key, rose) },
+		"SetIfAbsent": func(key string) { cache.SetIfAbsent(key, rose, 10) },
+		"MSet":        func(key string) { cache.MSet(map[string]CacheItem{key: rose}, 10) },
+		"Update": func(key string) {
+			cache.Update(key, func(old CacheItem, exists bool) (CacheItem, int64, UpdateAction) {
+				return rose, 10, UpdateReplace
+			})
+		},
+	}
+	for name, overwrite := range overwrites {
+		reasons = nil
+		cache.SetTTL(name, jack, 1)
+		clock.Advance(2 * time.Second)
+		overwrite(name)
+		if len(reasons) != 1 || reasons[0] != EvictExpired {
+			t.Fatalf("%s of an expired key expect eviction %v, but %v", name, EvictExpired, reasons)
+		}
 	}
 }
 
@@ -803,6 +1183,32 @@ func BenchmarkLocalReference_SetPointer(b *testing.B) {
 	}
 }
 
+// run with -cpu 1,4,16: with a single shard the parallel sets wait for one lock, more shards spread them
+func BenchmarkLocalReference_SetPointerParallel(b *testing.B) {
+	for _, shard_count := range []int{1, 4, 16} {
+		b.Run("shards="+strconv.Itoa(shard_count), func(b *testing.B) {
+			cache, _ := New(&CacheConfig{ShardCount: shard_count})
+			defer cache.Close()
+			jack := &Person{"Jack", 18, "America"}
+
+			keyArray := []string{}
+			for i := 0; i < 100000; i++ {
+				keyArray = append(keyArray, strconv.Itoa(i))
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := rand.Intn(len(keyArray))
+				for pb.Next() {
+					cache.SetTTL(keyArray[i%len(keyArray)], jack, 300)
+					i++
+				}
+			})
+		})
+	}
+}
+
 func BenchmarkLocalReference_GetPointer(b *testing.B) {
 	cache, _ := New(nil)
 	jack := &Person{"Jack", 18, "America"}
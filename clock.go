@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the time source of a cache, it drives the cached unix time and the recycler
+type Clock interface {
+	Now() time.Time
+	// call f once d has elapsed
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is returned by Clock.AfterFunc
+type Timer interface {
+	// prevent the timer from firing, false if it has already fired or been stopped
+	Stop() bool
+}
+
+type systemClock struct{}
+
+// SystemClock is the default Clock backed by the time package
+var SystemClock Clock = systemClock{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// FakeClock is a manual Clock for deterministic tests, time only moves with Advance.
+// Timers due are fired in the go-routine calling Advance, in order of their due time.
+type FakeClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	seq    int64
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	when  time.Time
+	seq   int64
+	f     func()
+}
+
+// if now is zero, the fake clock starts at the current system time
+func NewFakeClock(now time.Time) *FakeClock {
+	if now.IsZero() {
+		now = time.Now()
+	}
+	return &FakeClock{now: now}
+}
+
+func (clock *FakeClock) Now() time.Time {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	return clock.now
+}
+
+func (clock *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	clock.seq++
+	timer := &fakeTimer{
+		clock: clock,
+		when:  clock.now.Add(d),
+		seq:   clock.seq,
+		f:     f,
+	}
+	clock.timers = append(clock.timers, timer)
+	sort.Slice(clock.timers, func(i, j int) bool {
+		if clock.timers[i].when.Equal(clock.timers[j].when) {
+			return clock.timers[i].seq < clock.timers[j].seq
+		}
+		return clock.timers[i].when.Before(clock.timers[j].when)
+	})
+	return timer
+}
+
+// move the clock forward by d, firing every timer which becomes due on the way.
+// Timers scheduled by the fired callbacks are fired as well if they are due before the end.
+func (clock *FakeClock) Advance(d time.Duration) {
+	clock.lock.Lock()
+	end := clock.now.Add(d)
+	for len(clock.timers) > 0 && !clock.timers[0].when.After(end) {
+		timer := clock.timers[0]
+		clock.timers = clock.timers[1:]
+		if timer.when.After(clock.now) {
+			clock.now = timer.when
+		}
+		clock.lock.Unlock()
+		timer.f()
+		clock.lock.Lock()
+	}
+	if end.After(clock.now) {
+		clock.now = end
+	}
+	clock.lock.Unlock()
+}
+
+func (timer *fakeTimer) Stop() bool {
+	clock := timer.clock
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	for i, t := range clock.timers {
+		if t == timer {
+			clock.timers = append(clock.timers[:i], clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_FakeClock_Advance(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	clock := NewFakeClock(start)
+
+	fired := []int{}
+	clock.AfterFunc(3*time.Second, func() { fired = append(fired, 3) })
+	clock.AfterFunc(1*time.Second, func() { fired = append(fired, 1) })
+	stopped := clock.AfterFunc(2*time.Second, func() { fired = append(fired, 2) })
+	clock.AfterFunc(1*time.Second, func() {
+		fired = append(fired, 11)
+		//rescheduled timer due before the end of Advance fires in the same Advance
+		clock.AfterFunc(1500*time.Millisecond, func() { fired = append(fired, 25) })
+	})
+
+	if !stopped.Stop() {
+		t.Fatalf("stop a pending timer expect true")
+	}
+	if stopped.Stop() {
+		t.Fatalf("stop a stopped timer expect false")
+	}
+
+	clock.Advance(2 * time.Second)
+	if len(fired) != 2 || fired[0] != 1 || fired[1] != 11 {
+		t.Fatalf("fired timers expect [1 11], but %v", fired)
+	}
+	if !clock.Now().Equal(start.Add(2 * time.Second)) {
+		t.Fatalf("now expect %v, but %v", start.Add(2*time.Second), clock.Now())
+	}
+
+	clock.Advance(2 * time.Second)
+	if len(fired) != 4 || fired[2] != 25 || fired[3] != 3 {
+		t.Fatalf("fired timers expect [1 11 25 3], but %v", fired)
+	}
+}
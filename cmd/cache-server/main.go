@@ -0,0 +1,156 @@
+// cache-server serves a cache to Redis clients over RESP2 on tcp and unix sockets,
+// optionally to memcached clients over the memcached text protocol, and to ops over an http/json api.
+//
+//	cache-server -addr 127.0.0.1:6380 -unix /tmp/cache.sock -memcache 127.0.0.1:11211 -max-bytes 104857600 -aof /var/lib/cache.aof
+//	CACHE_HTTP_TOKEN=secret cache-server -http 127.0.0.1:8080 -http-read-only
+//
+// It supports GET, SET with EX/PX/NX/XX, DEL, EXISTS, EXPIRE, PEXPIRE, TTL, PTTL, PERSIST, SCAN, INFO, DBSIZE,
+// FLUSHDB, PING, ECHO, SELECT 0 and QUIT. Every key has a ttl, the default one for a SET without EX or PX.
+// Both protocols share the keys, a value set by memcached with non zero flags is not visible to GET.
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/xlander-io/cache"
+	"github.com/xlander-io/cache/httpapi"
+	"github.com/xlander-io/cache/memcache"
+	"github.com/xlander-io/cache/resp"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:6380", "tcp address to listen on, empty for none")
+	unix := flag.String("unix", "", "unix socket path to listen on, empty for none")
+	memcache_addr := flag.String("memcache", "", "tcp address to serve the memcached text protocol on, empty for none")
+	http_addr := flag.String("http", "", "tcp address to serve the http api on, empty for none")
+	http_token := flag.String("http-token", os.Getenv("CACHE_HTTP_TOKEN"), "bearer token of the http api, $CACHE_HTTP_TOKEN by default, empty for no auth")
+	http_read_only := flag.Bool("http-read-only", false, "forbid writes through the http api")
+	max_bytes := flag.Int64("max-bytes", 0, "CacheBytesLimit of the cache, 0 for the default")
+	default_ttl := flag.Int64("default-ttl", 0, "DefaultTtlSecs of the cache, 0 for the default")
+	max_ttl := flag.Int64("max-ttl", 0, "MaxTtlSecs of the cache, 0 for the default")
+	shards := flag.Int("shards", 0, "ShardCount of the cache, 0 for the default")
+	aof := flag.String("aof", "", "append only log path, empty for none")
+	fsync := flag.String("aof-fsync", "everysec", "fsync policy of the append only log: everysec, always or no")
+	flag.Parse()
+
+	if *addr == "" && *unix == "" && *memcache_addr == "" && *http_addr == "" {
+		log.Fatal("nothing to listen on, set -addr, -unix, -memcache or -http")
+	}
+	fsync_policy, exist := map[string]cache.AOFFsyncPolicy{
+		"everysec": cache.AOFFsyncEverySecond,
+		"always":   cache.AOFFsyncAlways,
+		"no":       cache.AOFFsyncNever,
+	}[*fsync]
+	if !exist {
+		log.Fatalf("unknown -aof-fsync %q", *fsync)
+	}
+
+	config := &cache.CacheConfig{
+		CacheBytesLimit: *max_bytes,
+		DefaultTtlSecs:  *default_ttl,
+		MaxTtlSecs:      *max_ttl,
+		ShardCount:      *shards,
+		AOFPath:         *aof,
+		AOFFsync:        fsync_policy,
+	}
+	if *aof != "" {
+		//values of both protocols
+		config.AOFCodec = memcache.NewCodec()
+	}
+	c, err := cache.New(config)
+	if err != nil {
+		log.Fatalf("new cache: %v", err)
+	}
+
+	var listeners []net.Listener
+	if *addr != "" {
+		l, err := net.Listen("tcp", *addr)
+		if err != nil {
+			log.Fatalf("listen: %v", err)
+		}
+		listeners = append(listeners, l)
+	}
+	if *unix != "" {
+		//a socket left by a previous run
+		os.Remove(*unix)
+		l, err := net.Listen("unix", *unix)
+		if err != nil {
+			log.Fatalf("listen: %v", err)
+		}
+		listeners = append(listeners, l)
+	}
+
+	var memcache_listener net.Listener
+	if *memcache_addr != "" {
+		memcache_listener, err = net.Listen("tcp", *memcache_addr)
+		if err != nil {
+			log.Fatalf("listen: %v", err)
+		}
+	}
+
+	var http_listener net.Listener
+	if *http_addr != "" {
+		http_listener, err = net.Listen("tcp", *http_addr)
+		if err != nil {
+			log.Fatalf("listen: %v", err)
+		}
+	}
+
+	server := resp.NewServer(c)
+	var wg sync.WaitGroup
+	serve := func(protocol string, l net.Listener, serve func(net.Listener) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			log.Printf("%s listening on %s %s", protocol, l.Addr().Network(), l.Addr())
+			if err := serve(l); !errors.Is(err, resp.ErrServerClosed) && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("serve %s: %v", l.Addr(), err)
+			}
+		}()
+	}
+	for _, l := range listeners {
+		serve("resp", l, server.Serve)
+	}
+	var memcache_server *memcache.Server
+	if memcache_listener != nil {
+		memcache_server = memcache.NewServer(c)
+		serve("memcache", memcache_listener, memcache_server.Serve)
+	}
+	var http_server *http.Server
+	if http_listener != nil {
+		http_server = &http.Server{
+			Handler:           httpapi.NewHandler(c, &httpapi.Config{Token: *http_token, ReadOnly: *http_read_only}),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		serve("http", http_listener, http_server.Serve)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+	log.Print("shutting down")
+
+	server.Close()
+	if memcache_server != nil {
+		memcache_server.Close()
+	}
+	if http_server != nil {
+		http_server.Close()
+	}
+	wg.Wait()
+	if err := c.Close(); err != nil {
+		log.Printf("close cache: %v", err)
+	}
+	if *unix != "" {
+		os.Remove(*unix)
+	}
+}
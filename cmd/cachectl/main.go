@@ -0,0 +1,221 @@
+// cachectl works with a running cache-server over RESP2, and with snapshot files.
+//
+//	cachectl [-addr 127.0.0.1:6380 | -unix /tmp/cache.sock] <command> [args]
+//
+//	get <key>                                   print the value
+//	set [-ex secs | -px millis] [-nx | -xx] <key> <value>
+//	del <key>...                                print the number of keys deleted
+//	ttl [-ms] <key>                             print the remaining ttl, -2 if the key is missing
+//	scan [-match pattern] [-count n]            print every key matching the glob pattern
+//	stats                                       print the INFO of the server
+//	flush                                       delete every key
+//	snapshot save [-match pattern] <file>       save the keys of the server to a snapshot of the bytes codec
+//	snapshot inspect <file>                     counts, size and ttl histograms of a snapshot without loading it
+//	snapshot diff [-ttl] <file a> <file b>      keys only in a (-), only in b (+) and changed (~)
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/xlander-io/cache/resp"
+)
+
+// the server of the commands
+type target struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+func (target *target) dial() (*resp.Client, error) {
+	return resp.Dial(target.network, target.address, target.timeout)
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `usage: cachectl [-addr host:port | -unix path] <command> [args]
+
+commands:
+  get <key>
+  set [-ex secs | -px millis] [-nx | -xx] <key> <value>
+  del <key>...
+  ttl [-ms] <key>
+  scan [-match pattern] [-count n]
+  stats
+  flush
+  snapshot save [-match pattern] <file>
+  snapshot inspect <file>
+  snapshot diff [-ttl] <file a> <file b>
+
+flags:
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("cachectl: ")
+	addr := flag.String("addr", "127.0.0.1:6380", "tcp address of the server")
+	unix := flag.String("unix", "", "unix socket path of the server, instead of -addr")
+	timeout := flag.Duration("timeout", 5*time.Second, "dial timeout")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	server := &target{network: "tcp", address: *addr, timeout: *timeout}
+	if *unix != "" {
+		server.network, server.address = "unix", *unix
+	}
+
+	var err error
+	if flag.Arg(0) == "snapshot" {
+		err = snapshotCommand(os.Stdout, server, flag.Args()[1:])
+	} else {
+		err = serverCommand(os.Stdout, server, flag.Args())
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+var errUsage = errors.New("wrong arguments, see cachectl -h")
+
+// run a command against the server and print its result to out
+func serverCommand(out io.Writer, server *target, args []string) error {
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	var command []string
+	switch args[0] {
+	case "get":
+		if len(args) != 2 {
+			return errUsage
+		}
+		command = []string{"GET", args[1]}
+	case "set":
+		ex := flags.Int64("ex", 0, "ttl in secs")
+		px := flags.Int64("px", 0, "ttl in millis")
+		nx := flags.Bool("nx", false, "only if the key is missing")
+		xx := flags.Bool("xx", false, "only if the key exists")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() != 2 {
+			return errUsage
+		}
+		command = []string{"SET", flags.Arg(0), flags.Arg(1)}
+		if *ex > 0 {
+			command = append(command, "EX", strconv.FormatInt(*ex, 10))
+		}
+		if *px > 0 {
+			command = append(command, "PX", strconv.FormatInt(*px, 10))
+		}
+		if *nx {
+			command = append(command, "NX")
+		}
+		if *xx {
+			command = append(command, "XX")
+		}
+	case "del":
+		if len(args) < 2 {
+			return errUsage
+		}
+		command = append([]string{"DEL"}, args[1:]...)
+	case "ttl":
+		ms := flags.Bool("ms", false, "in millis")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return errUsage
+		}
+		command = []string{"TTL", flags.Arg(0)}
+		if *ms {
+			command[0] = "PTTL"
+		}
+	case "scan":
+		match := flags.String("match", "", "glob pattern of the keys, empty for all")
+		count := flags.Int("count", 100, "keys paged through by every SCAN")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() != 0 {
+			return errUsage
+		}
+		client, err := server.dial()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		return scanKeys(client, *match, *count, func(key string) error {
+			_, err := fmt.Fprintln(out, key)
+			return err
+		})
+	case "stats":
+		command = []string{"INFO"}
+	case "flush":
+		command = []string{"FLUSHDB"}
+	default:
+		return fmt.Errorf("unknown command %q, see cachectl -h", args[0])
+	}
+
+	client, err := server.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	reply, err := client.Do(command...)
+	if err != nil {
+		return err
+	}
+	switch {
+	case reply.Null && args[0] == "get":
+		return fmt.Errorf("%s: not found", command[1])
+	case reply.Null:
+		return errors.New("not set, NX or XX not met")
+	case reply.Kind == resp.Integer:
+		_, err = fmt.Fprintln(out, reply.Int)
+	case args[0] == "stats":
+		//INFO ends with its own line break
+		_, err = out.Write(reply.Str)
+	default:
+		_, err = fmt.Fprintf(out, "%s\n", reply.Str)
+	}
+	return err
+}
+
+// call f for every key matching match, SCAN by SCAN until the cursor is back to 0
+func scanKeys(client *resp.Client, match string, count int, f func(key string) error) error {
+	cursor := "0"
+	for {
+		args := []string{"SCAN", cursor, "COUNT", strconv.Itoa(count)}
+		if match != "" {
+			args = append(args, "MATCH", match)
+		}
+		reply, err := client.Do(args...)
+		if err != nil {
+			return err
+		}
+		if reply.Kind != resp.Array || len(reply.Array) != 2 {
+			return errors.New("unexpected SCAN reply")
+		}
+		for _, key := range reply.Array[1].Array {
+			if err := f(string(key.Str)); err != nil {
+				return err
+			}
+		}
+		if cursor = string(reply.Array[0].Str); cursor == "0" {
+			return nil
+		}
+	}
+}
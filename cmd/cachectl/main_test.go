@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xlander-io/cache"
+	"github.com/xlander-io/cache/resp"
+	"github.com/xlander-io/cache/snapshot"
+)
+
+// a resp server of a new cache on a loopback tcp listener, closed with the test
+func newTestServer(t *testing.T) (*cache.Cache, *target) {
+	c, err := cache.New(&cache.CacheConfig{ShardCount: 4})
+	if err != nil {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen expect nil, but %v", err)
+	}
+	server := resp.NewServer(c)
+	go server.Serve(l)
+	t.Cleanup(func() {
+		server.Close()
+		c.Close()
+	})
+	return c, &target{network: "tcp", address: l.Addr().String(), timeout: time.Second}
+}
+
+// run a server command and check its output
+func expectOutput(t *testing.T, server *target, expect string, args ...string) {
+	t.Helper()
+	var out bytes.Buffer
+	if err := serverCommand(&out, server, args); err != nil {
+		t.Fatalf("%q expect nil, but %v", args, err)
+	}
+	if out.String() != expect {
+		t.Fatalf("%q expect %q, but %q", args, expect, out.String())
+	}
+}
+
+func Test_Cachectl_ServerCommands(t *testing.T) {
+	c, server := newTestServer(t)
+
+	expectOutput(t, server, "OK\n", "set", "-ex", "100", "a", "hello")
+	expectOutput(t, server, "hello\n", "get", "a")
+	expectOutput(t, server, "100\n", "ttl", "a")
+	if err := serverCommand(&bytes.Buffer{}, server, []string{"set", "-nx", "a", "x"}); err == nil {
+		t.Fatalf("set -nx of an existing key expect an error, but nil")
+	}
+	if err := serverCommand(&bytes.Buffer{}, server, []string{"get", "missing"}); err == nil {
+		t.Fatalf("get of a missing key expect an error, but nil")
+	}
+
+	for _, key := range []string{"user:1", "user:2", "order:1"} {
+		c.Set(key, cache.Bytes("x"))
+	}
+	var out bytes.Buffer
+	if err := serverCommand(&out, server, []string{"scan", "-match", "user:*", "-count", "1"}); err != nil {
+		t.Fatalf("scan expect nil, but %v", err)
+	}
+	keys := strings.Fields(out.String())
+	sort.Strings(keys)
+	if strings.Join(keys, " ") != "user:1 user:2" {
+		t.Fatalf("scan expect user:1 user:2, but %v", keys)
+	}
+
+	expectOutput(t, server, "2\n", "del", "user:1", "user:2", "user:3")
+	expectOutput(t, server, "OK\n", "flush")
+	if items := c.Items(); items != 0 {
+		t.Fatalf("items after flush expect 0, but %d", items)
+	}
+	if err := serverCommand(&bytes.Buffer{}, server, []string{"bogus"}); err == nil {
+		t.Fatalf("an unknown command expect an error, but nil")
+	}
+}
+
+// a value which is not raw bytes
+type person struct{}
+
+func (p *person) CacheBytes() int { return 1 }
+
+func Test_Cachectl_Snapshot(t *testing.T) {
+	c, server := newTestServer(t)
+	dir := t.TempDir()
+	c.SetTTL("a", cache.Bytes("1"), 100)
+	c.SetTTL("b", cache.Bytes(strings.Repeat("x", 1000)), 1800)
+	c.Set("other", &person{})
+
+	client, err := server.dial()
+	if err != nil {
+		t.Fatalf("dial expect nil, but %v", err)
+	}
+	defer client.Close()
+	path_a := filepath.Join(dir, "a.snap")
+	saved, skipped, err := saveSnapshot(client, path_a, "")
+	if err != nil || saved != 2 || skipped != 1 {
+		t.Fatalf("save expect 2 saved and 1 skipped, but %d %d %v", saved, skipped, err)
+	}
+
+	//the saved snapshot is loadable by the cache
+	loaded, _ := cache.New(nil)
+	defer loaded.Close()
+	file, _ := os.Open(path_a)
+	count, err := loaded.LoadSnapshot(file, cache.NewBytesCodec())
+	file.Close()
+	if err != nil || count != 2 {
+		t.Fatalf("LoadSnapshot expect 2 keys, but %d %v", count, err)
+	}
+
+	var out bytes.Buffer
+	if err := inspectSnapshot(&out, path_a); err != nil {
+		t.Fatalf("inspect expect nil, but %v", err)
+	}
+	lines := map[string]bool{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		lines[strings.Join(strings.Fields(line), " ")] = true
+	}
+	for _, expect := range []string{"codec bytes", "keys 2", "value bytes 1001", "< 64B 1", "< 1K 1", "< 10m0s 1", "< 1h0m0s 1"} {
+		if !lines[expect] {
+			t.Fatalf("inspect expect %q, but\n%s", expect, out.String())
+		}
+	}
+
+	//b changed, a deleted, c added
+	c.SetTTL("b", cache.Bytes("changed"), 1800)
+	c.Delete("a")
+	c.SetTTL("c", cache.Bytes("3"), 100)
+	path_b := filepath.Join(dir, "b.snap")
+	if _, _, err := saveSnapshot(client, path_b, ""); err != nil {
+		t.Fatalf("save expect nil, but %v", err)
+	}
+	out.Reset()
+	if err := diffSnapshots(&out, path_a, path_b, false); err != nil {
+		t.Fatalf("diff expect nil, but %v", err)
+	}
+	expect := "- a\n~ b\n+ c\n1 only in " + path_a + ", 1 only in " + path_b + ", 1 changed, 0 same\n"
+	if out.String() != expect {
+		t.Fatalf("diff expect %q, but %q", expect, out.String())
+	}
+
+	//a snapshot of another codec
+	path_gob := filepath.Join(dir, "gob.snap")
+	file, _ = os.Create(path_gob)
+	writer, _ := snapshot.NewWriter(file, snapshot.Header{Codec: "gob"})
+	writer.Close()
+	file.Close()
+	if err := diffSnapshots(&out, path_a, path_gob, false); err == nil {
+		t.Fatalf("diff of different codecs expect an error, but nil")
+	}
+	if err := inspectSnapshot(&out, filepath.Join(dir, "missing")); err == nil {
+		t.Fatalf("inspect of a missing file expect an error, but nil")
+	}
+}
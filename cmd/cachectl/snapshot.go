@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/xlander-io/cache"
+	"github.com/xlander-io/cache/resp"
+	"github.com/xlander-io/cache/snapshot"
+)
+
+func snapshotCommand(out io.Writer, server *target, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	flags := flag.NewFlagSet("snapshot "+args[0], flag.ContinueOnError)
+	switch args[0] {
+	case "save":
+		match := flags.String("match", "", "glob pattern of the keys, empty for all")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return errUsage
+		}
+		client, err := server.dial()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		saved, skipped, err := saveSnapshot(client, flags.Arg(0), *match)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "saved %d keys to %s, skipped %d which are not raw bytes\n", saved, flags.Arg(0), skipped)
+		return err
+	case "inspect":
+		if len(args) != 2 {
+			return errUsage
+		}
+		return inspectSnapshot(out, args[1])
+	case "diff":
+		ttl := flags.Bool("ttl", false, "a key with a different expire time is changed as well")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() != 2 {
+			return errUsage
+		}
+		return diffSnapshots(out, flags.Arg(0), flags.Arg(1), *ttl)
+	}
+	return fmt.Errorf("unknown snapshot command %q, see cachectl -h", args[0])
+}
+
+// save the keys of the server matching match to path, values encoded by the bytes codec so that the snapshot
+// can be loaded by cache.LoadSnapshot with cache.NewBytesCodec(). Tags can't be read over RESP and are not saved.
+// Keys whose value is not raw bytes are skipped, keys which expire meanwhile are left out.
+func saveSnapshot(client *resp.Client, path string, match string) (saved int, skipped int, err error) {
+	codec := cache.NewBytesCodec()
+	tmp_path := path + ".tmp"
+	file, err := os.Create(tmp_path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(tmp_path)
+		}
+	}()
+
+	writer, err := snapshot.NewWriter(file, snapshot.Header{SavedAt: time.Now().UnixMilli(), Codec: codec.Name()})
+	if err != nil {
+		return 0, 0, err
+	}
+	err = scanKeys(client, match, 1000, func(key string) error {
+		value, err := client.Do("GET", key)
+		if _, wrong_type := err.(resp.ReplyError); wrong_type {
+			skipped++
+			return nil
+		}
+		if err != nil || value.Null {
+			return err
+		}
+		ttl, err := client.Do("PTTL", key)
+		if err != nil || ttl.Int < 0 {
+			return err
+		}
+		data, err := codec.Encode(cache.Bytes(value.Str))
+		if err != nil {
+			return err
+		}
+		saved++
+		return writer.Write(&snapshot.Record{Key: key, Expire: time.Now().UnixMilli() + ttl.Int, Value: data})
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if err = writer.Close(); err != nil {
+		return 0, 0, err
+	}
+	if err = file.Sync(); err != nil {
+		return 0, 0, err
+	}
+	if err = file.Close(); err != nil {
+		return 0, 0, err
+	}
+	return saved, skipped, os.Rename(tmp_path, path)
+}
+
+// the bounds of a histogram, a value falls in the first bucket whose bound is greater
+type histogram struct {
+	bounds []int64
+	labels []string
+	counts []int64
+}
+
+func newHistogram(bounds []int64, label func(bound int64) string) *histogram {
+	h := &histogram{bounds: bounds, counts: make([]int64, len(bounds)+1)}
+	for _, bound := range bounds {
+		h.labels = append(h.labels, "< "+label(bound))
+	}
+	h.labels = append(h.labels, ">= "+label(bounds[len(bounds)-1]))
+	return h
+}
+
+func (h *histogram) add(value int64) {
+	i := sort.Search(len(h.bounds), func(i int) bool { return value < h.bounds[i] })
+	h.counts[i]++
+}
+
+func (h *histogram) print(w io.Writer, title string) {
+	fmt.Fprintf(w, "%s\tkeys\n", title)
+	for i, count := range h.counts {
+		fmt.Fprintf(w, "%s\t%d\n", h.labels[i], count)
+	}
+}
+
+func byteSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%dM", n>>20)
+	case n >= 1<<10:
+		return fmt.Sprintf("%dK", n>>10)
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// print the counts, the value size histogram and the ttl histogram of the snapshot at path,
+// the ttls are the ones left when it was saved. Records are streamed, the values are not decoded.
+func inspectSnapshot(out io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader, err := snapshot.NewReader(file)
+	if err != nil {
+		return err
+	}
+
+	sizes := newHistogram([]int64{64, 256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20}, byteSize)
+	ttls := newHistogram([]int64{1, 1000, 10000, 60000, 600000, 3600000, 86400000}, func(bound int64) string {
+		if bound == 1 {
+			return "0s"
+		}
+		return (time.Duration(bound) * time.Millisecond).String()
+	})
+	var records, tagged, key_bytes, value_bytes int64
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("record %d: %w", records+1, err)
+		}
+		records++
+		if len(record.Tags) > 0 {
+			tagged++
+		}
+		key_bytes += int64(len(record.Key))
+		value_bytes += int64(len(record.Value))
+		sizes.add(int64(len(record.Value)))
+		ttls.add(record.Expire - reader.Header.SavedAt)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "codec\t%s\n", reader.Header.Codec)
+	fmt.Fprintf(w, "saved at\t%s\n", time.UnixMilli(reader.Header.SavedAt).UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(w, "keys\t%d\n", records)
+	fmt.Fprintf(w, "keys with tags\t%d\n", tagged)
+	fmt.Fprintf(w, "key bytes\t%d\n", key_bytes)
+	fmt.Fprintf(w, "value bytes\t%d\n", value_bytes)
+	fmt.Fprintln(w)
+	sizes.print(w, "value size")
+	fmt.Fprintln(w)
+	//"< 0s" are the keys already expired when saved
+	ttls.print(w, "ttl")
+	return w.Flush()
+}
+
+// what diff compares of a record, the value by a hash so that a snapshot does not have to fit in memory twice
+type diff_entry struct {
+	expire int64
+	value  uint64
+	tags   string
+}
+
+func diffEntryOf(record *snapshot.Record) diff_entry {
+	h := fnv.New64a()
+	h.Write(record.Value)
+	return diff_entry{expire: record.Expire, value: h.Sum64(), tags: strings.Join(record.Tags, "\x00")}
+}
+
+// print the keys only in a with -, only in b with +, and with a different value or tags with ~, sorted by key,
+// followed by a summary. The values are compared encoded, so both snapshots must be of the same codec
+func diffSnapshots(out io.Writer, path_a string, path_b string, compare_ttl bool) error {
+	entries := map[string]diff_entry{}
+	codec_a, err := readSnapshot(path_a, func(record *snapshot.Record) {
+		entries[record.Key] = diffEntryOf(record)
+	})
+	if err != nil {
+		return err
+	}
+
+	var only_a, only_b, changed []string
+	same := 0
+	codec_b, err := readSnapshot(path_b, func(record *snapshot.Record) {
+		entry_a, exist := entries[record.Key]
+		if !exist {
+			only_b = append(only_b, record.Key)
+			return
+		}
+		delete(entries, record.Key)
+		entry_b := diffEntryOf(record)
+		if entry_a.value != entry_b.value || entry_a.tags != entry_b.tags || (compare_ttl && entry_a.expire != entry_b.expire) {
+			changed = append(changed, record.Key)
+			return
+		}
+		same++
+	})
+	if err != nil {
+		return err
+	}
+	if codec_a != codec_b {
+		return fmt.Errorf("snapshots of different codecs %q and %q can't be compared", codec_a, codec_b)
+	}
+	for key := range entries {
+		only_a = append(only_a, key)
+	}
+
+	var lines []string
+	for _, keys := range []struct {
+		mark string
+		keys []string
+	}{{"-", only_a}, {"+", only_b}, {"~", changed}} {
+		for _, key := range keys.keys {
+			lines = append(lines, keys.mark+" "+key)
+		}
+	}
+	//by key, then by mark
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i][2:] != lines[j][2:] {
+			return lines[i][2:] < lines[j][2:]
+		}
+		return lines[i] < lines[j]
+	})
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	fmt.Fprintf(&buf, "%d only in %s, %d only in %s, %d changed, %d same\n", len(only_a), path_a, len(only_b), path_b, len(changed), same)
+	_, err = out.Write(buf.Bytes())
+	return err
+}
+
+// stream the records of the snapshot at path to f, the codec name is returned
+func readSnapshot(path string, f func(record *snapshot.Record)) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	reader, err := snapshot.NewReader(file)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return reader.Header.Codec, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", path, err)
+		}
+		f(record)
+	}
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+)
+
+// Codec encodes the values of a cache to bytes and back, used by snapshots
+type Codec interface {
+	// stored in the snapshot, a snapshot can only be loaded with a codec of the same name
+	Name() string
+	Encode(value CacheItem) ([]byte, error)
+	Decode(data []byte) (CacheItem, error)
+}
+
+type gob_codec struct {
+	new_item func() CacheItem
+}
+
+// values are encoded by encoding/gob and decoded into the pointer returned by newItem
+func NewGobCodec(newItem func() CacheItem) Codec {
+	return &gob_codec{new_item: newItem}
+}
+
+func (c *gob_codec) Name() string {
+	return "gob"
+}
+
+func (c *gob_codec) Encode(value CacheItem) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *gob_codec) Decode(data []byte) (CacheItem, error) {
+	item := c.new_item()
+	if item == nil {
+		return nil, errors.New("gob codec: newItem returned nil")
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+type json_codec struct {
+	new_item func() CacheItem
+}
+
+// values are encoded by encoding/json and decoded into the pointer returned by newItem
+func NewJSONCodec(newItem func() CacheItem) Codec {
+	return &json_codec{new_item: newItem}
+}
+
+func (c *json_codec) Name() string {
+	return "json"
+}
+
+func (c *json_codec) Encode(value CacheItem) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (c *json_codec) Decode(data []byte) (CacheItem, error) {
+	item := c.new_item()
+	if item == nil {
+		return nil, errors.New("json codec: newItem returned nil")
+	}
+	if err := json.Unmarshal(data, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// Bytes is a CacheItem of raw bytes, as stored by the servers of the protocol packages
+type Bytes []byte
+
+func (b Bytes) CacheBytes() int {
+	return len(b)
+}
+
+// Bytes are equal by content, so CompareAndSwap works on a copy of the value
+func (b Bytes) Equal(other CacheItem) bool {
+	other_bytes, ok := other.(Bytes)
+	return ok && bytes.Equal(b, other_bytes)
+}
+
+type bytes_codec struct{}
+
+// Bytes values are kept as they are, any other value can not be encoded
+func NewBytesCodec() Codec {
+	return bytes_codec{}
+}
+
+func (bytes_codec) Name() string {
+	return "bytes"
+}
+
+func (bytes_codec) Encode(value CacheItem) ([]byte, error) {
+	b, ok := value.(Bytes)
+	if !ok {
+		return nil, errors.New("bytes codec: value is not Bytes")
+	}
+	return b, nil
+}
+
+func (bytes_codec) Decode(data []byte) (CacheItem, error) {
+	return Bytes(data), nil
+}
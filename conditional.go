@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"time"
+)
+
+// SetIfAbsent sets key only if it is missing or expired, ttlSecond <= 0 for the default ttl.
+// stored is false if a live value exists.
+func (cache *Cache) SetIfAbsent(key string, value CacheItem, ttlSecond int64) (stored bool, err error) {
+	if ttlSecond <= 0 {
+		ttlSecond = cache.cache_config.DefaultTtlSecs
+	}
+	_, stored, err = cache.setIf(key, value, secsToMillis(ttlSecond), 0, nil, false, func(live *cache_element) bool {
+		return live == nil
+	})
+	return stored, err
+}
+
+// SetIfPresent replaces the live value of key keeping its tags, ttlSecond == 0 keeps its ttl.
+// stored is false if key is missing or expired.
+func (cache *Cache) SetIfPresent(key string, value CacheItem, ttlSecond int64) (stored bool, err error) {
+	_, stored, err = cache.setIf(key, value, secsToMillis(ttlSecond), 0, nil, true, func(live *cache_element) bool {
+		return live != nil
+	})
+	return stored, err
+}
+
+// like SetIfAbsent with a ttl in millis precision, ttl <= 0 for the default ttl
+func (cache *Cache) SetIfAbsentDuration(key string, value CacheItem, ttl time.Duration) (stored bool, err error) {
+	ttl_millis := ttl.Milliseconds()
+	if ttl_millis <= 0 {
+		ttl_millis = secsToMillis(cache.cache_config.DefaultTtlSecs)
+	}
+	_, stored, err = cache.setIf(key, value, ttl_millis, 0, nil, false, func(live *cache_element) bool {
+		return live == nil
+	})
+	return stored, err
+}
+
+// like SetIfPresent with a ttl in millis precision, ttl == 0 keeps the ttl
+func (cache *Cache) SetIfPresentDuration(key string, value CacheItem, ttl time.Duration) (stored bool, err error) {
+	_, stored, err = cache.setIf(key, value, ttl.Milliseconds(), 0, nil, true, func(live *cache_element) bool {
+		return live != nil
+	})
+	return stored, err
+}
+
+// CompareAndSwap replaces the live value of key with new only if it is old, compared by identity for pointers
+// and with Equal for items implementing Equaler such as Bytes. Other items of uncomparable types never match,
+// use CompareVersionAndSwap for them. The tags are kept, ttlSecond == 0 keeps the ttl.
+func (cache *Cache) CompareAndSwap(key string, old CacheItem, new CacheItem, ttlSecond int64) (swapped bool, err error) {
+	_, swapped, err = cache.setIf(key, new, secsToMillis(ttlSecond), 0, nil, true, func(live *cache_element) bool {
+		return live != nil && sameItem(live.Value.(CacheItem), old)
+	})
+	return swapped, err
+}
+
+// GetWithVersion is like Get and also returns the version of the value, which changes whenever key is set
+func (cache *Cache) GetWithVersion(key string) (value CacheItem, ttl int64, version uint64) {
+	ele, ttl := cache.get(key)
+	if ele == nil {
+		return nil, 0, 0
+	}
+	return ele.Value.(CacheItem), millisToSecs(ttl), ele.Version
+}
+
+// CompareVersionAndSwap replaces the live value of key only if its version is still version as returned by GetWithVersion.
+// The tags are kept, ttlSecond == 0 keeps the ttl.
+func (cache *Cache) CompareVersionAndSwap(key string, version uint64, value CacheItem, ttlSecond int64) (swapped bool, err error) {
+	_, swapped, err = cache.setIf(key, value, secsToMillis(ttlSecond), 0, nil, true, func(live *cache_element) bool {
+		return live != nil && live.Version == version
+	})
+	return swapped, err
+}
+
+// CompareVersionAndDelete deletes the live key only if its version is still version as returned by GetWithVersion
+func (cache *Cache) CompareVersionAndDelete(key string, version uint64) (deleted bool, err error) {
+	shard := cache.shard(key)
+	count, err := cache.deleteInShard(shard, EvictDeleted, func() []string {
+		if ele_, exist := shard.sync_map.Load(key); exist {
+			if ele := ele_.(*cache_element); ele.expire() > cache.now() && ele.Version == version {
+				return []string{key}
+			}
+		}
+		return nil
+	})
+	return count == 1, err
+}
+
+// GetOrSet returns the live value of key with loaded true, or sets value and returns it with loaded false.
+// ttlSecond <= 0 for the default ttl, the returned ttl is the one applied once capped by MaxTtlSecs and the namespace.
+func (cache *Cache) GetOrSet(key string, value CacheItem, ttlSecond int64) (actual CacheItem, ttl int64, loaded bool, err error) {
+	if ttlSecond <= 0 {
+		ttlSecond = cache.cache_config.DefaultTtlSecs
+	}
+	ele, stored, err := cache.setIf(key, value, secsToMillis(ttlSecond), 0, nil, false, func(live *cache_element) bool {
+		return live == nil
+	})
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if stored {
+		return value, millisToSecs(ele.Score - cache.now()), false, nil
+	}
+	return ele.Value.(CacheItem), millisToSecs(ele.expire() - cache.now()), true, nil
+}
@@ -0,0 +1,238 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_Cache_SetIfAbsentAndPresent(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	cache, err := New(&CacheConfig{Clock: clock})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	jack := &Person{"Jack", 18, "London"}
+	tom := &Person{"Tom", 20, "Paris"}
+
+	if stored, err := cache.SetIfPresent("a", jack, 10); stored || err != nil {
+		t.Fatalf("SetIfPresent on missing key expect false nil, but %v %v", stored, err)
+	}
+	if stored, err := cache.SetIfAbsent("a", jack, 10); !stored || err != nil {
+		t.Fatalf("SetIfAbsent on missing key expect true nil, but %v %v", stored, err)
+	}
+	if stored, _ := cache.SetIfAbsent("a", tom, 10); stored {
+		t.Fatalf("SetIfAbsent on live key expect false, but true")
+	}
+	if stored, _ := cache.SetIfPresent("a", tom, 0); !stored {
+		t.Fatalf("SetIfPresent on live key expect true, but false")
+	}
+	if v, ttl := cache.Get("a"); v != tom || ttl != 10 {
+		t.Fatalf("get 'a' expect Tom with kept ttl 10, but %v %d", v, ttl)
+	}
+
+	// expired but not recycled yet counts as absent
+	clock.Advance(10 * time.Second)
+	if stored, _ := cache.SetIfPresent("a", jack, 10); stored {
+		t.Fatalf("SetIfPresent on expired key expect false, but true")
+	}
+	if stored, _ := cache.SetIfAbsent("a", jack, 0); !stored {
+		t.Fatalf("SetIfAbsent on expired key expect true, but false")
+	}
+	if v, ttl := cache.Get("a"); v != jack || ttl != 30 {
+		t.Fatalf("get 'a' expect Jack with default ttl 30, but %v %d", v, ttl)
+	}
+}
+
+func Test_Cache_CompareAndSwap(t *testing.T) {
+	cache, err := New(nil)
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	jack := &Person{"Jack", 18, "London"}
+	jack_copy := &Person{"Jack", 18, "London"}
+	tom := &Person{"Tom", 20, "Paris"}
+	cache.SetTTL("a", jack, 100)
+
+	if swapped, _ := cache.CompareAndSwap("a", jack_copy, tom, 0); swapped {
+		t.Fatalf("CompareAndSwap with an equal copy expect false, but true")
+	}
+	if swapped, _ := cache.CompareAndSwap("a", jack, tom, 0); !swapped {
+		t.Fatalf("CompareAndSwap with the same pointer expect true, but false")
+	}
+	if swapped, _ := cache.CompareAndSwap("missing", jack, tom, 0); swapped {
+		t.Fatalf("CompareAndSwap on missing key expect false, but true")
+	}
+
+	//Bytes are compared by content
+	cache.SetTTL("b", Bytes("hello"), 100)
+	if swapped, _ := cache.CompareAndSwap("b", Bytes("world"), Bytes("x"), 0); swapped {
+		t.Fatalf("CompareAndSwap of other bytes expect false, but true")
+	}
+	if swapped, _ := cache.CompareAndSwap("b", Bytes("hello"), Bytes("x"), 0); !swapped {
+		t.Fatalf("CompareAndSwap of a copy of the bytes expect true, but false")
+	}
+	if value, _ := cache.Get("b"); string(value.(Bytes)) != "x" {
+		t.Fatalf("b expect x, but %v", value)
+	}
+
+	_, _, version := cache.GetWithVersion("a")
+	cache.SetTTL("a", tom, 100) // same value, new version
+	if swapped, _ := cache.CompareVersionAndSwap("a", version, jack, 0); swapped {
+		t.Fatalf("CompareVersionAndSwap with an old version expect false, but true")
+	}
+	_, _, version = cache.GetWithVersion("a")
+	if swapped, _ := cache.CompareVersionAndSwap("a", version, jack, 0); !swapped {
+		t.Fatalf("CompareVersionAndSwap with the current version expect true, but false")
+	}
+	if v, _ := cache.Get("a"); v != jack {
+		t.Fatalf("get 'a' expect Jack, but %v", v)
+	}
+}
+
+func Test_Cache_CompareVersionAndSwapConcurrent(t *testing.T) {
+	cache, err := New(&CacheConfig{ShardCount: 4})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	cache.SetTTL("counter", &Person{"0", 0, ""}, 100)
+
+	// optimistic increments, none of them must be lost
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				for {
+					v, _, version := cache.GetWithVersion("counter")
+					next := v.(*Person).Age + 1
+					if swapped, _ := cache.CompareVersionAndSwap("counter", version, &Person{strconv.Itoa(next), next, ""}, 0); swapped {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if v, _ := cache.Get("counter"); v.(*Person).Age != 800 {
+		t.Fatalf("counter expect 800, but %d", v.(*Person).Age)
+	}
+}
+
+func Test_Cache_CompareVersionAndDelete(t *testing.T) {
+	cache, err := New(nil)
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	jack := &Person{"Jack", 18, "London"}
+	cache.SetTTL("a", jack, 100)
+	_, _, version := cache.GetWithVersion("a")
+	cache.SetTTL("a", jack, 100) // same value, new version
+	if deleted, _ := cache.CompareVersionAndDelete("a", version); deleted {
+		t.Fatalf("CompareVersionAndDelete with an old version expect false, but true")
+	}
+	_, _, version = cache.GetWithVersion("a")
+	if deleted, _ := cache.CompareVersionAndDelete("a", version); !deleted {
+		t.Fatalf("CompareVersionAndDelete with the current version expect true, but false")
+	}
+	if v, _ := cache.Get("a"); v != nil || cache.Stats().Deletes != 1 {
+		t.Fatalf("get 'a' and deletes expect nil 1, but %v %d", v, cache.Stats().Deletes)
+	}
+	if deleted, _ := cache.CompareVersionAndDelete("a", version); deleted {
+		t.Fatalf("CompareVersionAndDelete of a missing key expect false, but true")
+	}
+}
+
+func Test_Cache_GetOrSet(t *testing.T) {
+	cache, err := New(nil)
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	var stored int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, _, loaded, _ := cache.GetOrSet("a", &Person{"Jack", i, "London"}, 100); !loaded {
+				atomic.AddInt32(&stored, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if stored != 1 {
+		t.Fatalf("GetOrSet expect to store once, but %d", stored)
+	}
+
+	jack, _ := cache.Get("a")
+	actual, ttl, loaded, err := cache.GetOrSet("a", &Person{"Tom", 20, "Paris"}, 10)
+	if actual != jack || ttl != 100 || !loaded || err != nil {
+		t.Fatalf("GetOrSet expect %v 100 true nil, but %v %d %v %v", jack, actual, ttl, loaded, err)
+	}
+}
+
+func Test_Cache_GetOrSetCappedTTL(t *testing.T) {
+	cache, err := New(&CacheConfig{MaxTtlSecs: 600})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	if _, ttl, loaded, _ := cache.GetOrSet("a", &Person{"Jack", 18, "London"}, 1000); loaded || ttl != 600 {
+		t.Fatalf("GetOrSet over MaxTtlSecs expect 600 false, but %d %v", ttl, loaded)
+	}
+
+	orders, _ := cache.Namespace("orders")
+	orders.SetConfig(&NamespaceConfig{MaxTtlSecs: 10})
+	if _, ttl, loaded, _ := cache.GetOrSet(orders.Key("1"), &Person{"Jack", 18, "London"}, 100); loaded || ttl != 10 {
+		t.Fatalf("GetOrSet over the MaxTtlSecs of the namespace expect 10 false, but %d %v", ttl, loaded)
+	}
+}
+
+func Test_Cache_SetIfDuration(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	cache, err := New(&CacheConfig{Clock: clock})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	jack := &Person{"Jack", 18, "London"}
+	rose := &Person{"Rose", 17, "Paris"}
+	if stored, _ := cache.SetIfPresentDuration("a", jack, time.Second); stored {
+		t.Fatalf("SetIfPresentDuration on missing key expect false, but true")
+	}
+	if stored, _ := cache.SetIfAbsentDuration("a", jack, 1500*time.Millisecond); !stored {
+		t.Fatalf("SetIfAbsentDuration on missing key expect true, but false")
+	}
+	if stored, _ := cache.SetIfAbsentDuration("a", rose, time.Second); stored {
+		t.Fatalf("SetIfAbsentDuration on live key expect false, but true")
+	}
+	if stored, _ := cache.SetIfPresentDuration("a", rose, 0); !stored {
+		t.Fatalf("SetIfPresentDuration on live key expect true, but false")
+	}
+	if v, ttl := cache.GetDuration("a"); v != rose || ttl != 1500*time.Millisecond {
+		t.Fatalf("get 'a' expect %v with the kept ttl 1.5s, but %v %v", rose, v, ttl)
+	}
+	if stored, _ := cache.SetIfPresentDuration("a", jack, 200*time.Millisecond); !stored {
+		t.Fatalf("SetIfPresentDuration on live key expect true, but false")
+	}
+	clock.Advance(200 * time.Millisecond)
+	if v, _ := cache.Get("a"); v != nil {
+		t.Fatalf("get 'a' expect nil after 200ms, but %v", v)
+	}
+}
@@ -0,0 +1,206 @@
+package cache
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+)
+
+// EvictionPolicy decides which items are recycled first once RecycleRatioThreshold of CacheBytesLimit is reached.
+// Expired items are always recycled by their ttl, whatever the policy is.
+// OnSet and OnDelete of a key are called with the lock of its shard held, any method may be called concurrently with the others.
+// A policy keeps state about the keys of one cache, so an instance must not be shared between caches.
+type EvictionPolicy interface {
+	// key is set, replaced is true if it already exists
+	OnSet(key string, replaced bool)
+	// key is hit by a Get
+	OnAccess(key string)
+	// key is removed from the cache for any reason
+	OnDelete(key string)
+	// up to n keys which should be evicted first, they must stay in the policy until OnDelete
+	Victims(n int) []string
+}
+
+type expiry_policy struct{}
+
+// ExpiryPolicy is the default policy, items expiring soonest are evicted first.
+// It keeps no state of its own as it uses the expiry skiplist of the cache, so it can be shared.
+var ExpiryPolicy EvictionPolicy = expiry_policy{}
+
+func (expiry_policy) OnSet(key string, replaced bool) {}
+func (expiry_policy) OnAccess(key string)             {}
+func (expiry_policy) OnDelete(key string)             {}
+func (expiry_policy) Victims(n int) []string          { return nil }
+
+// the keys of a list based policy, front is the most recently inserted or used
+type list_policy struct {
+	lock        sync.Mutex
+	elements    map[string]*list.Element
+	order       *list.List
+	move_on_use bool
+}
+
+// least recently used items are evicted first, both Get and Set count as use
+func NewLRUPolicy() EvictionPolicy {
+	return &list_policy{
+		elements:    make(map[string]*list.Element),
+		order:       list.New(),
+		move_on_use: true,
+	}
+}
+
+// earliest inserted items are evicted first, neither Get nor replacing Set changes the order
+func NewFIFOPolicy() EvictionPolicy {
+	return &list_policy{
+		elements:    make(map[string]*list.Element),
+		order:       list.New(),
+		move_on_use: false,
+	}
+}
+
+func (p *list_policy) OnSet(key string, replaced bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if ele, exist := p.elements[key]; exist {
+		if p.move_on_use {
+			p.order.MoveToFront(ele)
+		}
+		return
+	}
+	p.elements[key] = p.order.PushFront(key)
+}
+
+func (p *list_policy) OnAccess(key string) {
+	if !p.move_on_use {
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if ele, exist := p.elements[key]; exist {
+		p.order.MoveToFront(ele)
+	}
+}
+
+func (p *list_policy) OnDelete(key string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if ele, exist := p.elements[key]; exist {
+		p.order.Remove(ele)
+		delete(p.elements, key)
+	}
+}
+
+func (p *list_policy) Victims(n int) []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	keys := make([]string, 0, n)
+	for ele := p.order.Back(); ele != nil && len(keys) < n; ele = ele.Prev() {
+		keys = append(keys, ele.Value.(string))
+	}
+	return keys
+}
+
+type lfu_entry struct {
+	key     string
+	freq    int64
+	element *list.Element //element in the bucket of freq
+}
+
+// keys are grouped in buckets by access frequency, front of a bucket is the most recent one
+type lfu_policy struct {
+	lock    sync.Mutex
+	entries map[string]*lfu_entry
+	buckets map[int64]*list.List
+}
+
+// least frequently used items are evicted first, the least recent one among the same frequency.
+// Both Get and Set count as use.
+func NewLFUPolicy() EvictionPolicy {
+	return &lfu_policy{
+		entries: make(map[string]*lfu_entry),
+		buckets: make(map[int64]*list.List),
+	}
+}
+
+func (p *lfu_policy) OnSet(key string, replaced bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if entry, exist := p.entries[key]; exist {
+		p.increase(entry)
+		return
+	}
+	entry := &lfu_entry{key: key}
+	p.entries[key] = entry
+	p.link(entry, 1)
+}
+
+func (p *lfu_policy) OnAccess(key string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if entry, exist := p.entries[key]; exist {
+		p.increase(entry)
+	}
+}
+
+func (p *lfu_policy) OnDelete(key string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if entry, exist := p.entries[key]; exist {
+		p.unlink(entry)
+		delete(p.entries, key)
+	}
+}
+
+func (p *lfu_policy) Victims(n int) []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	freqs := make([]int64, 0, len(p.buckets))
+	for freq := range p.buckets {
+		freqs = append(freqs, freq)
+	}
+	sort.Slice(freqs, func(i, j int) bool { return freqs[i] < freqs[j] })
+
+	keys := make([]string, 0, n)
+	for _, freq := range freqs {
+		for ele := p.buckets[freq].Back(); ele != nil && len(keys) < n; ele = ele.Prev() {
+			keys = append(keys, ele.Value.(*lfu_entry).key)
+		}
+		if len(keys) >= n {
+			break
+		}
+	}
+	return keys
+}
+
+func (p *lfu_policy) increase(entry *lfu_entry) {
+	freq := entry.freq + 1
+	p.unlink(entry)
+	p.link(entry, freq)
+}
+
+func (p *lfu_policy) link(entry *lfu_entry, freq int64) {
+	bucket, exist := p.buckets[freq]
+	if !exist {
+		bucket = list.New()
+		p.buckets[freq] = bucket
+	}
+	entry.freq = freq
+	entry.element = bucket.PushFront(entry)
+}
+
+func (p *lfu_policy) unlink(entry *lfu_entry) {
+	bucket := p.buckets[entry.freq]
+	bucket.Remove(entry.element)
+	if bucket.Len() == 0 {
+		delete(p.buckets, entry.freq)
+	}
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_EvictionPolicy_Victims(t *testing.T) {
+	lru := NewLRUPolicy()
+	lfu := NewLFUPolicy()
+	fifo := NewFIFOPolicy()
+
+	for _, p := range []EvictionPolicy{lru, lfu, fifo} {
+		p.OnSet("a", false)
+		p.OnSet("b", false)
+		p.OnSet("c", false)
+		p.OnSet("d", false)
+		p.OnAccess("a")
+		p.OnAccess("a")
+		p.OnSet("b", true)
+		p.OnAccess("c")
+		p.OnDelete("d")
+	}
+
+	if victims := lru.Victims(3); !reflect.DeepEqual(victims, []string{"a", "b", "c"}) {
+		t.Fatalf("lru victims expect [a b c], but %v", victims)
+	}
+	if victims := lfu.Victims(2); !reflect.DeepEqual(victims, []string{"b", "c"}) {
+		t.Fatalf("lfu victims expect [b c], but %v", victims)
+	}
+	if victims := fifo.Victims(10); !reflect.DeepEqual(victims, []string{"a", "b", "c"}) {
+		t.Fatalf("fifo victims expect [a b c], but %v", victims)
+	}
+	if victims := ExpiryPolicy.Victims(10); len(victims) != 0 {
+		t.Fatalf("expiry victims expect empty, but %v", victims)
+	}
+}
+
+func Test_Cache_EvictionPolicy(t *testing.T) {
+	jack := &Person{"Jack", 18, "America"}
+
+	policies := map[string]EvictionPolicy{
+		"lru":  NewLRUPolicy(),
+		"lfu":  NewLFUPolicy(),
+		"fifo": NewFIFOPolicy(),
+	}
+
+	for name, policy := range policies {
+		clock := NewFakeClock(time.Unix(1700000000, 0))
+		cache, err := New(&CacheConfig{
+			CacheBytesLimit:  int64(jack.CacheBytes()) * 100,
+			RecycleBatchSize: 10,
+			Clock:            clock,
+			EvictionPolicy:   policy,
+		})
+		if nil != err {
+			t.Fatalf("New cache instance failed! err=%v", err)
+		}
+
+		// the hot key has the shortest ttl
+		cache.SetTTL("hot", jack, 60)
+		for j := 0; j < 99; j++ {
+			cache.SetTTL(strconv.Itoa(j), jack, 3600)
+			if name != "fifo" {
+				cache.Get("hot")
+			}
+		}
+
+		clock.Advance(5 * time.Second)
+		if int64(cache.Bytes()) >= cache.recycle_bytes_threshold {
+			t.Fatalf("%s: total bytes expect < %d after recycling, but %d", name, cache.recycle_bytes_threshold, cache.Bytes())
+		}
+
+		v, _ := cache.Get("hot")
+		if name == "fifo" && v != nil {
+			t.Fatalf("%s: the first inserted key should be evicted, but %v", name, v)
+		}
+		if name != "fifo" && v != jack {
+			t.Fatalf("%s: the hot key should be kept, but %v", name, v)
+		}
+		if v, _ := cache.Get("98"); v != jack {
+			t.Fatalf("%s: get '98' from cache should be %v, but %v", name, jack, v)
+		}
+		cache.Close()
+	}
+}
@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"time"
+)
+
+// Expire changes the ttl of the live key without changing its value, ttlSecond <= 0 deletes it like EXPIRE of Redis.
+// ok is false if the key is missing or expired.
+func (cache *Cache) Expire(key string, ttlSecond int64) (ok bool, err error) {
+	return cache.expire_(key, secsToMillis(ttlSecond))
+}
+
+// like Expire with a ttl in millis precision
+func (cache *Cache) ExpireDuration(key string, ttl time.Duration) (ok bool, err error) {
+	return cache.expire_(key, ttl.Milliseconds())
+}
+
+// ExpireAt is like Expire with an absolute time, a time not after now deletes the key
+func (cache *Cache) ExpireAt(key string, at time.Time) (ok bool, err error) {
+	return cache.expire_(key, at.UnixMilli()-cache.now())
+}
+
+func (cache *Cache) expire_(key string, ttl int64) (ok bool, err error) {
+	if ttl <= 0 {
+		_, _, err = cache.Update(key, func(old CacheItem, exists bool) (CacheItem, int64, UpdateAction) {
+			ok = exists
+			return nil, 0, UpdateDelete
+		})
+		return ok, err
+	}
+	return cache.retime(key, ttl)
+}
+
+// TTL returns the remaining secs of the live key without fetching its value, exists is false if it is missing or expired.
+// it is not counted as a hit or a miss
+func (cache *Cache) TTL(key string) (ttl int64, exists bool) {
+	ttl, exists = cache.ttl(key)
+	return millisToSecs(ttl), exists
+}
+
+// like TTL in the precision of ClockResolution
+func (cache *Cache) TTLDuration(key string) (ttl time.Duration, exists bool) {
+	ttl_millis, exists := cache.ttl(key)
+	return time.Duration(ttl_millis) * time.Millisecond, exists
+}
+
+// remaining millis of the live key
+func (cache *Cache) ttl(key string) (int64, bool) {
+	ele, ttl := cache.peek(key)
+	return ttl, ele != nil
+}
+
+// Touch resets the ttl of the live key to DefaultTtlSecs, or to the one of its namespace
+func (cache *Cache) Touch(key string) (ok bool, err error) {
+	if ns := cache.namespaceOf(key); ns != nil {
+		return cache.retime(key, secsToMillis(ns.GetConfig().DefaultTtlSecs))
+	}
+	return cache.retime(key, secsToMillis(cache.cache_config.DefaultTtlSecs))
+}
+
+// Persist sets the ttl of the live key to MaxTtlSecs, the longest a key can live, or to the one of its namespace
+func (cache *Cache) Persist(key string) (ok bool, err error) {
+	return cache.retime(key, secsToMillis(cache.cache_config.MaxTtlSecs))
+}
+
+// set the ttl of the live key to ttl millis > 0, capped by MaxTtlSecs and the one of its namespace.
+// the element is replaced by one with the same value and version, and its skiplist entry moved to the new score
+func (cache *Cache) retime(key string, ttl int64) (bool, error) {
+	ttl = cache.namespaceOf(key).capTtl(cache.capTtl(ttl))
+
+	shard := cache.shard(key)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	if cache.Closed() {
+		return false, ErrClosed
+	}
+
+	now := cache.now()
+	ele_, exist := shard.sync_map.Load(key)
+	if !exist || ele_.(*cache_element).expire() <= now {
+		return false, nil
+	}
+	cache.moveExpire(shard, key, ele_.(*cache_element), now+ttl, nil)
+
+	if cache.aof != nil {
+		return true, cache.aof.append(aofExpireEntry(key, now+ttl))
+	}
+	return true, nil
+}
+
+// replace ele of key by one expiring at expire_time with the shard lock held.
+// a sliding element is taken as last read a sliding ttl before expire_time, so that an older read can not push it further.
+// the skiplist update is appended to batch, or dispatched right away if batch is nil
+func (cache *Cache) moveExpire(shard *cache_shard, key string, ele *cache_element, expire_time int64, batch *[]sl_op) {
+	if ele.Score == expire_time && ele.expire() == expire_time {
+		return
+	}
+	var accessed int64
+	if ele.Sliding > 0 {
+		accessed = expire_time - ele.Sliding
+	}
+	shard.sync_map.Store(key, &cache_element{
+		Score:    expire_time,
+		Value:    ele.Value,
+		Version:  ele.Version,
+		Sliding:  ele.Sliding,
+		Tags:     ele.Tags,
+		ns:       ele.ns,
+		accessed: accessed,
+	})
+	shard.unindexNamespace(ele.ns, key, ele.Score)
+	shard.indexNamespace(ele.ns, key, expire_time)
+	shard.dispatch(sl_op{key: key, remove: true, remove_score: ele.Score, insert: true, insert_score: expire_time}, batch)
+}
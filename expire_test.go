@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_Cache_ExpireAndTTL(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	cache, err := New(&CacheConfig{Clock: clock, ShardCount: 2})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+
+	jack := &Person{"Jack", 18, "London"}
+	cache.SetTTL("a", jack, 10)
+	_, _, version := cache.GetWithVersion("a")
+
+	if ttl, exists := cache.TTL("a"); ttl != 10 || !exists {
+		t.Fatalf("TTL expect 10 true, but %d %v", ttl, exists)
+	}
+	if ok, err := cache.Expire("a", 100); !ok || err != nil {
+		t.Fatalf("Expire expect true nil, but %v %v", ok, err)
+	}
+	if v, ttl, ver := cache.GetWithVersion("a"); v != jack || ttl != 100 || ver != version {
+		t.Fatalf("get 'a' expect the same value and version with ttl 100, but %v %d %d", v, ttl, ver)
+	}
+
+	if ok, _ := cache.ExpireAt("a", time.Unix(1700000050, 0)); !ok {
+		t.Fatalf("ExpireAt expect true, but false")
+	}
+	if ttl, _ := cache.TTL("a"); ttl != 50 {
+		t.Fatalf("TTL after ExpireAt expect 50, but %d", ttl)
+	}
+	if ok, _ := cache.Persist("a"); !ok {
+		t.Fatalf("Persist expect true, but false")
+	}
+	if ttl, _ := cache.TTL("a"); ttl != 7200 {
+		t.Fatalf("TTL after Persist expect 7200, but %d", ttl)
+	}
+	if ok, _ := cache.Touch("a"); !ok {
+		t.Fatalf("Touch expect true, but false")
+	}
+	if ttl, _ := cache.TTL("a"); ttl != 30 {
+		t.Fatalf("TTL after Touch expect 30, but %d", ttl)
+	}
+
+	// the recycler follows the new expire time
+	clock.Advance(31 * time.Second)
+	if _, exists := cache.TTL("a"); exists {
+		t.Fatalf("TTL of expired key expect false, but true")
+	}
+	if ok, _ := cache.Expire("a", 100); ok {
+		t.Fatalf("Expire of expired key expect false, but true")
+	}
+	clock.Advance(5 * time.Second)
+	if cache.Items() != 0 {
+		t.Fatalf("items expect 0 after recycling, but %d", cache.Items())
+	}
+
+	cache.SetTTL("b", jack, 10)
+	if ok, _ := cache.Expire("b", 0); !ok || cache.Items() != 0 {
+		t.Fatalf("Expire 0 expect to delete, but %v %d items", ok, cache.Items())
+	}
+	if ok, _ := cache.Expire("missing", 10); ok {
+		t.Fatalf("Expire of missing key expect false, but true")
+	}
+
+	cache.Close()
+	for _, shard := range cache.shards {
+		if shard.skip_list.length != 0 {
+			t.Fatalf("skiplist length expect 0 after drain, but %d", shard.skip_list.length)
+		}
+	}
+}
+
+func Test_Cache_ExpireAOF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+
+	cache := newAOFCache(t, clock, path, AOFFsyncEverySecond)
+	cache.SetTTL("a", &Person{"Jack", 18, "London"}, 10)
+	cache.Expire("a", 1000)
+	cache.Close()
+
+	clock.Advance(100 * time.Second)
+	cache = newAOFCache(t, clock, path, AOFFsyncEverySecond)
+	defer cache.Close()
+	if ttl, exists := cache.TTL("a"); ttl != 900 || !exists {
+		t.Fatalf("TTL after replay expect 900 true, but %d %v", ttl, exists)
+	}
+}
+
+func Test_Cache_ExpireDuration(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	cache, err := New(&CacheConfig{Clock: clock})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	jack := &Person{"Jack", 18, "London"}
+	cache.SetTTL("a", jack, 10)
+	if ok, err := cache.ExpireDuration("a", 250*time.Millisecond); !ok || err != nil {
+		t.Fatalf("ExpireDuration expect true nil, but %v %v", ok, err)
+	}
+	if ttl, exists := cache.TTLDuration("a"); ttl != 250*time.Millisecond || !exists {
+		t.Fatalf("TTLDuration expect 250ms true, but %v %v", ttl, exists)
+	}
+	if ttl, _ := cache.TTL("a"); ttl != 1 {
+		t.Fatalf("TTL expect 1, but %d", ttl)
+	}
+
+	clock.Advance(250 * time.Millisecond)
+	if ttl, exists := cache.TTLDuration("a"); ttl != 0 || exists {
+		t.Fatalf("TTLDuration expect 0 false once expired, but %v %v", ttl, exists)
+	}
+}
+
+func Test_Cache_ExpireSliding(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	cache, err := New(&CacheConfig{Clock: clock})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	jack := &Person{"Jack", 18, "London"}
+	cache.SetSliding("a", jack, 100)
+	clock.Advance(60 * time.Second)
+	cache.Get("a")
+
+	// the read 60s ago does not push the new expire time, neither now nor after a recycle check
+	if ok, _ := cache.Expire("a", 40); !ok {
+		t.Fatalf("Expire expect true, but false")
+	}
+	if ttl, _ := cache.TTL("a"); ttl != 40 {
+		t.Fatalf("TTL after Expire expect 40, but %d", ttl)
+	}
+	clock.Advance(10 * time.Second)
+	if ttl, _ := cache.TTL("a"); ttl != 30 {
+		t.Fatalf("TTL after a recycle check expect 30, but %d", ttl)
+	}
+
+	// a read after it slides again
+	if _, ttl := cache.Get("a"); ttl != 100 {
+		t.Fatalf("get 'a' expect ttl 100, but %d", ttl)
+	}
+}
+
+func Test_Cache_TouchNamespace(t *testing.T) {
+	cache, err := New(nil)
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	orders, _ := cache.Namespace("orders")
+	orders.SetConfig(&NamespaceConfig{DefaultTtlSecs: 600})
+	orders.SetTTL("1", &Person{"Jack", 18, "London"}, 10)
+	if ok, _ := cache.Touch(orders.Key("1")); !ok {
+		t.Fatalf("Touch expect true, but false")
+	}
+	if ttl, _ := cache.TTL(orders.Key("1")); ttl != 600 {
+		t.Fatalf("TTL after Touch expect the DefaultTtlSecs 600 of the namespace, but %d", ttl)
+	}
+}
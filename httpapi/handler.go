@@ -0,0 +1,394 @@
+// Package httpapi is an http.Handler to inspect and fix the contents of a running cache with any http client.
+//
+//	GET    /keys/{key}                  the value, with its ttl and version in the X-Cache-Ttl and X-Cache-Version headers.
+//	                                    a Peek: no hit or miss, no sliding of the ttl and no access for the eviction policy
+//	PUT    /keys/{key}?ttl=secs         set the request body, the DefaultTtlSecs without ttl
+//	DELETE /keys/{key}                  delete the key
+//	GET    /keys?prefix=&cursor=&count= a page of the live keys, like the Scan of the cache
+//	GET    /stats                       the counters of the cache
+//	GET    /config                      the config of the cache
+//	POST   /flush                       delete every key
+//
+// Errors are replied as {"error": "..."} with the status code.
+package httpapi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xlander-io/cache"
+)
+
+// Config of a Handler, the zero value serves raw bytes to anyone, read and write
+type Config struct {
+	// requests need an "Authorization: Bearer <Token>" header, "" for no auth
+	Token string
+	// PUT, DELETE and POST /flush are forbidden
+	ReadOnly bool
+	// encodes the values in the bodies, nil for raw bytes: values are cache.Bytes, and other values are
+	// replied as json but can't be written
+	Codec cache.Codec
+	// max body of a PUT, 1M bytes if <= 0
+	MaxBodyBytes int64
+}
+
+type Handler struct {
+	cache  *cache.Cache
+	config Config
+}
+
+// NewHandler serves c, a nil config is the zero Config
+func NewHandler(c *cache.Cache, config *Config) *Handler {
+	handler := &Handler{cache: c}
+	if config != nil {
+		handler.config = *config
+	}
+	if handler.config.MaxBodyBytes <= 0 {
+		handler.config.MaxBodyBytes = 1 << 20
+	}
+	return handler
+}
+
+func (handler *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !handler.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="cache"`)
+		replyError(w, http.StatusUnauthorized, "missing or wrong bearer token")
+		return
+	}
+
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/keys/") && len(path) > len("/keys/"):
+		key := path[len("/keys/"):]
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			handler.get(w, key)
+		case http.MethodPut:
+			if handler.writable(w) {
+				handler.put(w, r, key)
+			}
+		case http.MethodDelete:
+			if handler.writable(w) {
+				handler.delete(w, key)
+			}
+		default:
+			methodNotAllowed(w, "GET, HEAD, PUT, DELETE")
+		}
+	case path == "/keys":
+		if allowed(w, r, http.MethodGet) {
+			handler.scan(w, r)
+		}
+	case path == "/stats":
+		if allowed(w, r, http.MethodGet) {
+			replyJSON(w, http.StatusOK, statsOf(handler.cache.Stats()))
+		}
+	case path == "/config":
+		if allowed(w, r, http.MethodGet) {
+			replyJSON(w, http.StatusOK, configOf(handler.cache.GetConfig()))
+		}
+	case path == "/flush":
+		if allowed(w, r, http.MethodPost) && handler.writable(w) {
+			handler.flush(w)
+		}
+	default:
+		replyError(w, http.StatusNotFound, "no such endpoint")
+	}
+}
+
+func (handler *Handler) authorized(r *http.Request) bool {
+	if handler.config.Token == "" {
+		return true
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(handler.config.Token)) == 1
+}
+
+func (handler *Handler) writable(w http.ResponseWriter) bool {
+	if handler.config.ReadOnly {
+		replyError(w, http.StatusForbidden, "read only")
+		return false
+	}
+	return true
+}
+
+func allowed(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method || (method == http.MethodGet && r.Method == http.MethodHead) {
+		return true
+	}
+	if method == http.MethodGet {
+		method = "GET, HEAD"
+	}
+	methodNotAllowed(w, method)
+	return false
+}
+
+func methodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	replyError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+func (handler *Handler) get(w http.ResponseWriter, key string) {
+	value, ttl, version := handler.cache.Peek(key)
+	if value == nil {
+		replyError(w, http.StatusNotFound, "key not found")
+		return
+	}
+
+	var body []byte
+	var err error
+	content_type := "application/octet-stream"
+	codec := handler.config.Codec
+	switch v, is_bytes := value.(cache.Bytes); {
+	case codec != nil:
+		body, err = codec.Encode(value)
+		if codec.Name() == "json" {
+			content_type = "application/json"
+		}
+	case is_bytes:
+		body = v
+	default:
+		//read only without a codec
+		body, err = json.Marshal(value)
+		content_type = "application/json"
+	}
+	if err != nil {
+		replyError(w, http.StatusInternalServerError, "encode value: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", content_type)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("X-Cache-Ttl", strconv.FormatInt(ttl, 10))
+	w.Header().Set("X-Cache-Version", strconv.FormatUint(version, 10))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func (handler *Handler) put(w http.ResponseWriter, r *http.Request, key string) {
+	ttl := int64(0)
+	if ttl_param := r.URL.Query().Get("ttl"); ttl_param != "" {
+		var err error
+		if ttl, err = strconv.ParseInt(ttl_param, 10, 64); err != nil || ttl <= 0 {
+			replyError(w, http.StatusBadRequest, "ttl must be a positive number of secs")
+			return
+		}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, handler.config.MaxBodyBytes))
+	if err != nil {
+		if _, too_large := err.(*http.MaxBytesError); too_large {
+			replyError(w, http.StatusRequestEntityTooLarge, "body larger than "+strconv.FormatInt(handler.config.MaxBodyBytes, 10)+" bytes")
+			return
+		}
+		replyError(w, http.StatusBadRequest, "read body: "+err.Error())
+		return
+	}
+
+	var value cache.CacheItem = cache.Bytes(body)
+	if handler.config.Codec != nil {
+		if value, err = handler.config.Codec.Decode(body); err != nil {
+			replyError(w, http.StatusBadRequest, "decode value: "+err.Error())
+			return
+		}
+	}
+
+	if ttl > 0 {
+		err = handler.cache.SetTTL(key, value, ttl)
+	} else {
+		err = handler.cache.Set(key, value)
+	}
+	if err != nil {
+		replyCacheError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (handler *Handler) delete(w http.ResponseWriter, key string) {
+	deleted, err := handler.cache.MDelete([]string{key})
+	if err != nil {
+		replyCacheError(w, err)
+		return
+	}
+	if deleted == 0 {
+		replyError(w, http.StatusNotFound, "key not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type scan_reply struct {
+	Keys   []string `json:"keys"`
+	Cursor string   `json:"cursor"` //"0" once the scan ends, a string as it may not fit a float64
+}
+
+// a page of the keys starting with prefix, a page may be empty before the scan ends
+func (handler *Handler) scan(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	cursor := uint64(0)
+	if cursor_param := query.Get("cursor"); cursor_param != "" {
+		var err error
+		if cursor, err = strconv.ParseUint(cursor_param, 10, 64); err != nil {
+			replyError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+	}
+	count := 0
+	if count_param := query.Get("count"); count_param != "" {
+		var err error
+		if count, err = strconv.Atoi(count_param); err != nil || count <= 0 || count > 10000 {
+			replyError(w, http.StatusBadRequest, "count must be in [1,10000]")
+			return
+		}
+	}
+
+	keys, next := handler.cache.Scan(cursor, globPrefix(query.Get("prefix")), count)
+	replyJSON(w, http.StatusOK, scan_reply{Keys: keys, Cursor: strconv.FormatUint(next, 10)})
+}
+
+// the glob pattern of the keys starting with prefix
+func globPrefix(prefix string) string {
+	if prefix == "" {
+		return ""
+	}
+	var pattern strings.Builder
+	for i := 0; i < len(prefix); i++ {
+		switch prefix[i] {
+		case '*', '?', '[', '\\':
+			pattern.WriteByte('\\')
+		}
+		pattern.WriteByte(prefix[i])
+	}
+	pattern.WriteByte('*')
+	return pattern.String()
+}
+
+func (handler *Handler) flush(w http.ResponseWriter) {
+	flushed, err := handler.cache.Flush()
+	if err != nil {
+		replyCacheError(w, err)
+		return
+	}
+	replyJSON(w, http.StatusOK, map[string]int{"flushed": flushed})
+}
+
+type stats_reply struct {
+	Items              int32            `json:"items"`
+	Bytes              int32            `json:"bytes"`
+	Hits               int64            `json:"hits"`
+	Misses             int64            `json:"misses"`
+	ExpiredOnRead      int64            `json:"expired_on_read"`
+	Sets               int64            `json:"sets"`
+	Deletes            int64            `json:"deletes"`
+	Evictions          map[string]int64 `json:"evictions"` //by the String of the EvictReason
+	LoadSuccesses      int64            `json:"load_successes"`
+	LoadFailures       int64            `json:"load_failures"`
+	SkipListLength     int64            `json:"skiplist_length"`
+	SkipListQueue      int              `json:"skiplist_queue"`
+	RecycleRuns        int64            `json:"recycle_runs"`
+	RecycleLastMillis  float64          `json:"recycle_last_millis"`
+	RecycleMaxMillis   float64          `json:"recycle_max_millis"`
+	RecycleTotalMillis float64          `json:"recycle_total_millis"`
+}
+
+func statsOf(stats *cache.CacheStats) stats_reply {
+	reply := stats_reply{
+		Items:              stats.Items,
+		Bytes:              stats.Bytes,
+		Hits:               stats.Hits,
+		Misses:             stats.Misses,
+		ExpiredOnRead:      stats.ExpiredOnRead,
+		Sets:               stats.Sets,
+		Deletes:            stats.Deletes,
+		Evictions:          make(map[string]int64, len(stats.Evictions)),
+		LoadSuccesses:      stats.LoadSuccesses,
+		LoadFailures:       stats.LoadFailures,
+		SkipListLength:     stats.SkipListLength,
+		SkipListQueue:      stats.SkipListQueue,
+		RecycleRuns:        stats.RecycleRuns,
+		RecycleLastMillis:  millis(stats.RecycleLastDuration),
+		RecycleMaxMillis:   millis(stats.RecycleMaxDuration),
+		RecycleTotalMillis: millis(stats.RecycleTotalDuration),
+	}
+	for reason, count := range stats.Evictions {
+		reply.Evictions[reason.String()] = count
+	}
+	return reply
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// the fields of cache.CacheConfig which are plain values
+type config_reply struct {
+	CacheBytesLimit          int64   `json:"cache_bytes_limit"`
+	MaxTtlSecs               int64   `json:"max_ttl_secs"`
+	DefaultTtlSecs           int64   `json:"default_ttl_secs"`
+	RecycleCheckIntervalSecs int     `json:"recycle_check_interval_secs"`
+	RecycleRatioThreshold    int     `json:"recycle_ratio_threshold"`
+	RecycleBatchSize         int     `json:"recycle_batch_size"`
+	SkipListBufferSize       int     `json:"skiplist_buffer_size"`
+	ShardCount               int     `json:"shard_count"`
+	LoadErrorTtlSecs         int64   `json:"load_error_ttl_secs"`
+	AOFPath                  string  `json:"aof_path"`
+	AOFCodec                 string  `json:"aof_codec"` //the Name of the codec, "" for none
+	AOFRewriteMinBytes       int64   `json:"aof_rewrite_min_bytes"`
+	SlidingTTL               bool    `json:"sliding_ttl"`
+	ClockResolutionMillis    float64 `json:"clock_resolution_millis"`
+}
+
+func configOf(config *cache.CacheConfig) config_reply {
+	reply := config_reply{
+		CacheBytesLimit:          config.CacheBytesLimit,
+		MaxTtlSecs:               config.MaxTtlSecs,
+		DefaultTtlSecs:           config.DefaultTtlSecs,
+		RecycleCheckIntervalSecs: config.RecycleCheckIntervalSecs,
+		RecycleRatioThreshold:    config.RecycleRatioThreshold,
+		RecycleBatchSize:         config.RecycleBatchSize,
+		SkipListBufferSize:       config.SkipListBufferSize,
+		ShardCount:               config.ShardCount,
+		LoadErrorTtlSecs:         config.LoadErrorTtlSecs,
+		AOFPath:                  config.AOFPath,
+		AOFRewriteMinBytes:       config.AOFRewriteMinBytes,
+		SlidingTTL:               config.SlidingTTL,
+		ClockResolutionMillis:    millis(config.ClockResolution),
+	}
+	if config.AOFCodec != nil {
+		reply.AOFCodec = config.AOFCodec.Name()
+	}
+	return reply
+}
+
+func replyJSON(w http.ResponseWriter, status int, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		status = http.StatusInternalServerError
+		data, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
+
+func replyError(w http.ResponseWriter, status int, message string) {
+	replyJSON(w, status, map[string]string{"error": message})
+}
+
+// a closed cache is unavailable, other errors are the ones of the values
+func replyCacheError(w http.ResponseWriter, err error) {
+	if errors.Is(err, cache.ErrClosed) {
+		replyError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	replyError(w, http.StatusInternalServerError, err.Error())
+}
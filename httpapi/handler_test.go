@@ -0,0 +1,198 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xlander-io/cache"
+)
+
+func newTestCache(t *testing.T) (*cache.Cache, *cache.FakeClock) {
+	clock := cache.NewFakeClock(time.Unix(1700000000, 0))
+	c, err := cache.New(&cache.CacheConfig{Clock: clock, ShardCount: 4})
+	if err != nil {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, clock
+}
+
+// serve a request and check its status, the body is returned
+func expectStatus(t *testing.T, handler http.Handler, method string, target string, body string, token string, status int) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+	var body_reader io.Reader
+	if body != "" {
+		body_reader = strings.NewReader(body)
+	}
+	r := httptest.NewRequest(method, target, body_reader)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != status {
+		t.Fatalf("%s %s expect status %d, but %d %s", method, target, status, w.Code, w.Body.String())
+	}
+	return w, w.Body.String()
+}
+
+func Test_Handler_Keys(t *testing.T) {
+	c, clock := newTestCache(t)
+	handler := NewHandler(c, nil)
+
+	expectStatus(t, handler, "GET", "/keys/a", "", "", http.StatusNotFound)
+	expectStatus(t, handler, "PUT", "/keys/a?ttl=100", "hello", "", http.StatusNoContent)
+	expectStatus(t, handler, "PUT", "/keys/dir/b", "world", "", http.StatusNoContent)
+	expectStatus(t, handler, "PUT", "/keys/c?ttl=-1", "x", "", http.StatusBadRequest)
+
+	w, body := expectStatus(t, handler, "GET", "/keys/a", "", "", http.StatusOK)
+	if body != "hello" || w.Header().Get("X-Cache-Ttl") != "100" || w.Header().Get("Content-Type") != "application/octet-stream" {
+		t.Fatalf("GET /keys/a expect hello with ttl 100, but %q %v", body, w.Header())
+	}
+	if value, _ := c.Get("dir/b"); string(value.(cache.Bytes)) != "world" {
+		t.Fatalf("dir/b expect world, but %v", value)
+	}
+	if ttl, _ := c.TTL("dir/b"); ttl != c.GetConfig().DefaultTtlSecs {
+		t.Fatalf("dir/b ttl expect the default %d, but %d", c.GetConfig().DefaultTtlSecs, ttl)
+	}
+
+	//a peek, not a hit
+	if hits := c.Stats().Hits; hits != 1 {
+		t.Fatalf("hits after GET expect only the one of c.Get, but %d", hits)
+	}
+
+	expectStatus(t, handler, "DELETE", "/keys/a", "", "", http.StatusNoContent)
+	expectStatus(t, handler, "DELETE", "/keys/a", "", "", http.StatusNotFound)
+	expectStatus(t, handler, "POST", "/keys/a", "", "", http.StatusMethodNotAllowed)
+	expectStatus(t, handler, "GET", "/nothing", "", "", http.StatusNotFound)
+
+	clock.Advance(time.Duration(c.GetConfig().DefaultTtlSecs) * time.Second)
+	expectStatus(t, handler, "GET", "/keys/dir/b", "", "", http.StatusNotFound)
+
+	//max body
+	small := NewHandler(c, &Config{MaxBodyBytes: 4})
+	expectStatus(t, small, "PUT", "/keys/a", "12345", "", http.StatusRequestEntityTooLarge)
+}
+
+type person struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func (p *person) CacheBytes() int { return len(p.Name) + 8 }
+
+func Test_Handler_JSONCodec(t *testing.T) {
+	c, _ := newTestCache(t)
+	handler := NewHandler(c, &Config{Codec: cache.NewJSONCodec(func() cache.CacheItem { return &person{} })})
+
+	expectStatus(t, handler, "PUT", "/keys/p", `{"name":"ann","age":3}`, "", http.StatusNoContent)
+	expectStatus(t, handler, "PUT", "/keys/p", `{"name":`, "", http.StatusBadRequest)
+	if value, _ := c.Get("p"); value.(*person).Name != "ann" {
+		t.Fatalf("p expect ann, but %v", value)
+	}
+	w, body := expectStatus(t, handler, "GET", "/keys/p", "", "", http.StatusOK)
+	if body != `{"name":"ann","age":3}` || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("GET /keys/p expect the json of ann, but %q %v", body, w.Header())
+	}
+
+	//without a codec, values which are not cache.Bytes are replied as json
+	_, body = expectStatus(t, NewHandler(c, nil), "GET", "/keys/p", "", "", http.StatusOK)
+	if body != `{"name":"ann","age":3}` {
+		t.Fatalf("GET /keys/p without a codec expect the json of ann, but %q", body)
+	}
+}
+
+func Test_Handler_Scan(t *testing.T) {
+	c, _ := newTestCache(t)
+	handler := NewHandler(c, nil)
+	for _, key := range []string{"user:1", "user:2", "user:3", "user*x", "order:1"} {
+		c.Set(key, cache.Bytes("x"))
+	}
+
+	scan := func(prefix string) []string {
+		keys := []string{}
+		cursor := "0"
+		for {
+			_, body := expectStatus(t, handler, "GET", "/keys?count=2&prefix="+prefix+"&cursor="+cursor, "", "", http.StatusOK)
+			var reply scan_reply
+			if err := json.Unmarshal([]byte(body), &reply); err != nil {
+				t.Fatalf("scan reply expect json, but %q", body)
+			}
+			keys = append(keys, reply.Keys...)
+			if cursor = reply.Cursor; cursor == "0" {
+				return keys
+			}
+		}
+	}
+	if keys := scan("user:"); len(keys) != 3 {
+		t.Fatalf("scan of user: expect 3 keys, but %v", keys)
+	}
+	//glob chars in the prefix are literals
+	if keys := scan("user%2A"); len(keys) != 1 || keys[0] != "user*x" {
+		t.Fatalf("scan of user* expect [user*x], but %v", keys)
+	}
+	if keys := scan(""); len(keys) != 5 {
+		t.Fatalf("scan expect 5 keys, but %v", keys)
+	}
+	expectStatus(t, handler, "GET", "/keys?cursor=x", "", "", http.StatusBadRequest)
+}
+
+func Test_Handler_StatsConfigFlush(t *testing.T) {
+	c, _ := newTestCache(t)
+	handler := NewHandler(c, nil)
+	c.Set("a", cache.Bytes("x"))
+	c.Set("b", cache.Bytes("x"))
+	c.Get("a")
+
+	_, body := expectStatus(t, handler, "GET", "/stats", "", "", http.StatusOK)
+	var stats stats_reply
+	json.Unmarshal([]byte(body), &stats)
+	if stats.Items != 2 || stats.Hits != 1 || stats.Sets != 2 {
+		t.Fatalf("stats expect 2 items, 1 hit and 2 sets, but %s", body)
+	}
+	if _, exist := stats.Evictions["deleted"]; !exist {
+		t.Fatalf("stats evictions expect reason names, but %s", body)
+	}
+
+	_, body = expectStatus(t, handler, "GET", "/config", "", "", http.StatusOK)
+	var config config_reply
+	json.Unmarshal([]byte(body), &config)
+	if config.ShardCount != 4 || config.MaxTtlSecs != c.GetConfig().MaxTtlSecs {
+		t.Fatalf("config expect 4 shards, but %s", body)
+	}
+
+	expectStatus(t, handler, "GET", "/flush", "", "", http.StatusMethodNotAllowed)
+	_, body = expectStatus(t, handler, "POST", "/flush", "", "", http.StatusOK)
+	if body != "{\"flushed\":2}\n" || c.Items() != 0 {
+		t.Fatalf("flush expect 2 flushed, but %s with %d items", body, c.Items())
+	}
+
+	c.Close()
+	expectStatus(t, handler, "PUT", "/keys/a", "x", "", http.StatusServiceUnavailable)
+}
+
+func Test_Handler_AuthReadOnly(t *testing.T) {
+	c, _ := newTestCache(t)
+	c.Set("a", cache.Bytes("x"))
+	handler := NewHandler(c, &Config{Token: "secret", ReadOnly: true})
+
+	w, _ := expectStatus(t, handler, "GET", "/keys/a", "", "", http.StatusUnauthorized)
+	if w.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("401 expect a WWW-Authenticate header, but none")
+	}
+	expectStatus(t, handler, "GET", "/keys/a", "", "wrong", http.StatusUnauthorized)
+	expectStatus(t, handler, "GET", "/keys/a", "", "secret", http.StatusOK)
+	expectStatus(t, handler, "GET", "/stats", "", "secret", http.StatusOK)
+
+	expectStatus(t, handler, "PUT", "/keys/a", "y", "secret", http.StatusForbidden)
+	expectStatus(t, handler, "DELETE", "/keys/a", "", "secret", http.StatusForbidden)
+	expectStatus(t, handler, "POST", "/flush", "", "secret", http.StatusForbidden)
+	if value, _ := c.Get("a"); string(value.(cache.Bytes)) != "x" {
+		t.Fatalf("a expect x in read only mode, but %v", value)
+	}
+}
@@ -0,0 +1,141 @@
+// Package netserver runs the listeners and connections of the protocol servers of the cache.
+package netserver
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ErrServerClosed is returned by Serve once Close is called
+var ErrServerClosed = errors.New("server closed")
+
+// Server serves the connections of its listeners, one go-routine per connection
+type Server struct {
+	lock      sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	routines  sync.WaitGroup
+	//
+	connections int64 //connections accepted
+}
+
+// Serve accepts connections on l until l fails or Close is called, l is closed on return.
+// handle runs in its own go-routine for every connection, which is closed once handle returns.
+// It can be called for several listeners, like a tcp and a unix one.
+func (server *Server) Serve(l net.Listener, handle func(conn net.Conn)) error {
+	server.lock.Lock()
+	if server.closed {
+		server.lock.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	if server.listeners == nil {
+		server.listeners = make(map[net.Listener]struct{})
+		server.conns = make(map[net.Conn]struct{})
+	}
+	server.listeners[l] = struct{}{}
+	server.lock.Unlock()
+
+	defer func() {
+		server.lock.Lock()
+		delete(server.listeners, l)
+		server.lock.Unlock()
+		l.Close()
+	}()
+
+	delay := 5 * time.Millisecond
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if server.isClosed() {
+				return ErrServerClosed
+			}
+			//out of file descriptors and the like, retried with a growing delay
+			if isTemporary(err) {
+				time.Sleep(delay)
+				if delay < time.Second {
+					delay *= 2
+				}
+				continue
+			}
+			return err
+		}
+		delay = 5 * time.Millisecond
+
+		server.lock.Lock()
+		if server.closed {
+			server.lock.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		server.conns[conn] = struct{}{}
+		server.routines.Add(1)
+		server.lock.Unlock()
+		atomic.AddInt64(&server.connections, 1)
+
+		go func() {
+			defer func() {
+				server.lock.Lock()
+				delete(server.conns, conn)
+				server.lock.Unlock()
+				conn.Close()
+				server.routines.Done()
+			}()
+			handle(conn)
+		}()
+	}
+}
+
+// Close stops the listeners, closes the connections and waits for their go-routines
+func (server *Server) Close() error {
+	server.lock.Lock()
+	if server.closed {
+		server.lock.Unlock()
+		return nil
+	}
+	server.closed = true
+	var err error
+	for l := range server.listeners {
+		if close_err := l.Close(); err == nil {
+			err = close_err
+		}
+	}
+	for conn := range server.conns {
+		conn.Close()
+	}
+	server.lock.Unlock()
+
+	server.routines.Wait()
+	return err
+}
+
+// whether the accept error passes: a timeout, out of file descriptors or a connection aborted before it was accepted
+func isTemporary(err error) bool {
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) || errors.Is(err, syscall.ECONNABORTED)
+}
+
+func (server *Server) isClosed() bool {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return server.closed
+}
+
+// connections open now
+func (server *Server) Conns() int {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return len(server.conns)
+}
+
+// connections accepted since the start
+func (server *Server) Connections() int64 {
+	return atomic.LoadInt64(&server.connections)
+}
@@ -0,0 +1,231 @@
+package cache
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"sort"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// Range calls f for every live key until f returns false, expired keys not recycled yet are skipped.
+// No lock is held while f runs, so f may use the cache; a key set or deleted meanwhile may or may not be visited.
+func (cache *Cache) Range(f func(key string, value CacheItem, ttl int64) bool) {
+	if cache.Closed() {
+		return
+	}
+	now := cache.now()
+	for _, shard := range cache.shards {
+		stop := false
+		shard.sync_map.Range(func(key, value interface{}) bool {
+			ele := value.(*cache_element)
+			if ele.expire() <= now {
+				return true
+			}
+			stop = !f(key.(string), ele.Value.(CacheItem), millisToSecs(ele.expire()-now))
+			return !stop
+		})
+		if stop {
+			return
+		}
+	}
+}
+
+// Keys returns the live keys matching the glob pattern match, "" matches every key
+func (cache *Cache) Keys(match string) []string {
+	keys := []string{}
+	cache.Range(func(key string, value CacheItem, ttl int64) bool {
+		if match == "" || globMatch(match, key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys
+}
+
+// Scan pages through the live keys like the SCAN command of Redis: start with cursor 0 and call again
+// with the returned next cursor until it is 0. A key present during the whole scan is returned at least once,
+// keys set or deleted meanwhile may or may not be.
+// Each call pages through about count keys (10 if count <= 0), only the ones matching the glob pattern match
+// are returned, "" matches every key, so a call may return no keys before the scan ends.
+// The cursor is a shard and a position in the keys of the shard sorted by hash. The sorted keys of a shard are
+// built once as the scan enters it, so a call reads its page only and no shard lock is held.
+func (cache *Cache) Scan(cursor uint64, match string, count int) (keys []string, next uint64) {
+	if count <= 0 {
+		count = 10
+	}
+	if cache.Closed() {
+		return []string{}, 0
+	}
+
+	// the shard index in the high bits, the high bits of the hash in the rest
+	shard_bits := uint(bits.Len(uint(len(cache.shards))))
+	keys = []string{}
+	now := cache.now()
+	for paged := 0; paged < count; {
+		index, position := cursor>>(64-shard_bits), cursor<<shard_bits>>shard_bits
+		if index >= uint64(len(cache.shards)) {
+			return keys, 0
+		}
+		shard := cache.shards[index]
+		entries := shard.scanIndex(position == 0, cache.shard_seed)
+		from := sort.Search(len(entries), func(i int) bool { return entries[i].hash>>shard_bits >= position })
+		to := from + count - paged
+		if to > len(entries) {
+			to = len(entries)
+		}
+		// keys colliding with the last position would be skipped by the next cursor, they go into this page
+		for to > from && to < len(entries) && entries[to].hash>>shard_bits == entries[to-1].hash>>shard_bits {
+			to++
+		}
+
+		for _, entry := range entries[from:to] {
+			value, exist := shard.sync_map.Load(entry.key)
+			if !exist || value.(*cache_element).expire() <= now {
+				continue
+			}
+			if match == "" || globMatch(match, entry.key) {
+				keys = append(keys, entry.key)
+			}
+		}
+		paged += to - from
+
+		if to == len(entries) {
+			// the scan leaves the shard
+			shard.releaseScanIndex(entries)
+			cursor = (index + 1) << (64 - shard_bits)
+		} else {
+			// wraps to the next shard after the largest position
+			cursor = index<<(64-shard_bits) | entries[to-1].hash>>shard_bits
+			cursor++
+		}
+	}
+	if cursor>>(64-shard_bits) >= uint64(len(cache.shards)) {
+		return keys, 0
+	}
+	return keys, cursor
+}
+
+type scan_entry struct {
+	hash uint64
+	key  string
+}
+
+// the keys of the shard sorted by hash, rebuilt if rebuild is true or none is kept.
+// The returned entries are never modified, a rebuild replaces them
+func (shard *cache_shard) scanIndex(rebuild bool, seed maphash.Seed) []scan_entry {
+	shard.scan_lock.Lock()
+	defer shard.scan_lock.Unlock()
+	if !rebuild && shard.scan_keys != nil {
+		return shard.scan_keys
+	}
+	entries := make([]scan_entry, 0, atomic.LoadInt32(&shard.element_count))
+	shard.sync_map.Range(func(key, value interface{}) bool {
+		entries = append(entries, scan_entry{maphash.String(seed, key.(string)), key.(string)})
+		return true
+	})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].hash < entries[j].hash })
+	shard.scan_keys = entries
+	return entries
+}
+
+// drop the sorted keys once a scan is done with the shard, unless another scan has rebuilt them meanwhile
+func (shard *cache_shard) releaseScanIndex(entries []scan_entry) {
+	shard.scan_lock.Lock()
+	defer shard.scan_lock.Unlock()
+	if len(entries) > 0 && len(shard.scan_keys) > 0 && &shard.scan_keys[0] == &entries[0] {
+		shard.scan_keys = nil
+	}
+}
+
+// glob style matching as in Redis: * any string, ? any char, [abc] [a-z] [^a] a char class, \ escapes
+func globMatch(pattern string, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			_, size := utf8.DecodeRuneInString(s)
+			pattern, s = pattern[1:], s[size:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			r, size := utf8.DecodeRuneInString(s)
+			matched, rest, ok := matchClass(pattern[1:], r)
+			if !ok {
+				//unterminated class, the [ is a literal
+				if s[0] != '[' {
+					return false
+				}
+				pattern, s = pattern[1:], s[1:]
+				continue
+			}
+			if !matched {
+				return false
+			}
+			pattern, s = rest, s[size:]
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+	return len(s) == 0
+}
+
+// match r against the class starting after [, the pattern after ] is returned.
+// ok is false if the class is not terminated
+func matchClass(pattern string, r rune) (matched bool, rest string, ok bool) {
+	negate := false
+	if len(pattern) > 0 && pattern[0] == '^' {
+		negate = true
+		pattern = pattern[1:]
+	}
+	for first := true; len(pattern) > 0; first = false {
+		if pattern[0] == ']' && !first {
+			return matched != negate, pattern[1:], true
+		}
+		if pattern[0] == '\\' && len(pattern) >= 2 {
+			pattern = pattern[1:]
+		}
+		lo, size := utf8.DecodeRuneInString(pattern)
+		pattern = pattern[size:]
+		hi := lo
+		if len(pattern) >= 2 && pattern[0] == '-' && pattern[1] != ']' {
+			pattern = pattern[1:]
+			if pattern[0] == '\\' && len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			hi, size = utf8.DecodeRuneInString(pattern)
+			pattern = pattern[size:]
+		}
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		if lo <= r && r <= hi {
+			matched = true
+		}
+	}
+	return false, "", false
+}
@@ -0,0 +1,181 @@
+package cache
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_Cache_Range(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	cache, err := New(&CacheConfig{Clock: clock, ShardCount: 4})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	cache.SetTTL("a", &Person{"Jack", 18, "London"}, 10)
+	cache.SetTTL("b", &Person{"Tom", 20, "Paris"}, 100)
+	cache.SetTTL("c", &Person{"Bob", 30, "Rome"}, 1000)
+	clock.Advance(20 * time.Second)
+
+	ttls := map[string]int64{}
+	cache.Range(func(key string, value CacheItem, ttl int64) bool {
+		ttls[key] = ttl
+		return true
+	})
+	if len(ttls) != 2 || ttls["b"] != 80 || ttls["c"] != 980 {
+		t.Fatalf("Range expect b:80 c:980, but %v", ttls)
+	}
+
+	visited := 0
+	cache.Range(func(key string, value CacheItem, ttl int64) bool {
+		visited++
+		return false
+	})
+	if visited != 1 {
+		t.Fatalf("Range expect to stop after 1 key, but %d", visited)
+	}
+
+	keys := cache.Keys("[ab]")
+	if len(keys) != 1 || keys[0] != "b" {
+		t.Fatalf("Keys expect [b], but %v", keys)
+	}
+}
+
+func Test_Cache_Scan(t *testing.T) {
+	cache, err := New(&CacheConfig{ShardCount: 4})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	for i := 0; i < 1000; i++ {
+		cache.Set("user:"+strconv.Itoa(i), &Person{"Jack", i, "London"})
+	}
+	cache.Set("order:1", &Person{"Tom", 1, "Paris"})
+
+	seen := map[string]int{}
+	cursor, calls := uint64(0), 0
+	for {
+		var keys []string
+		keys, cursor = cache.Scan(cursor, "user:*", 37)
+		for _, key := range keys {
+			seen[key]++
+		}
+		calls++
+		// keys added during the scan must not break it
+		if calls == 5 {
+			cache.Set("user:new", &Person{"Bob", 1, "Rome"})
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		if seen["user:"+strconv.Itoa(i)] != 1 {
+			t.Fatalf("Scan expect user:%d once, but %d", i, seen["user:"+strconv.Itoa(i)])
+		}
+	}
+	if seen["order:1"] != 0 {
+		t.Fatalf("Scan expect order:1 not to match, but returned")
+	}
+	if calls < 1000/37 {
+		t.Fatalf("Scan expect at least %d calls, but %d", 1000/37, calls)
+	}
+}
+
+func Test_Cache_ScanPages(t *testing.T) {
+	cache, err := New(&CacheConfig{ShardCount: 16})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	for i := 0; i < 500; i++ {
+		cache.Set(strconv.Itoa(i), &Person{"Jack", i, "London"})
+	}
+
+	seen := map[string]int{}
+	deleted := ""
+	cursor, calls := uint64(0), 0
+	for {
+		var keys []string
+		keys, cursor = cache.Scan(cursor, "", 10)
+		if len(keys) > 10 {
+			t.Fatalf("Scan expect pages of at most 10 keys, but %d", len(keys))
+		}
+		for _, key := range keys {
+			seen[key]++
+		}
+		calls++
+		// a key not returned yet and deleted meanwhile is not returned
+		if calls == 3 {
+			for i := 0; i < 500 && deleted == ""; i++ {
+				if seen[strconv.Itoa(i)] == 0 {
+					deleted = strconv.Itoa(i)
+					cache.Delete(deleted)
+				}
+			}
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+
+	if len(seen) != 499 || seen[deleted] != 0 {
+		t.Fatalf("Scan expect the 499 keys left, but %d keys and %d of %s", len(seen), seen[deleted], deleted)
+	}
+	if calls != 50 {
+		t.Fatalf("Scan expect 50 calls of 10 keys, but %d", calls)
+	}
+}
+
+func Test_GlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		s       string
+		match   bool
+	}{
+		{"*", "", true},
+		{"user:*", "user:1", true},
+		{"user:*", "order:1", false},
+		{"h?llo", "héllo", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+		{"[abc", "[abc", true},
+	}
+	for _, c := range cases {
+		if globMatch(c.pattern, c.s) != c.match {
+			t.Fatalf("globMatch(%q, %q) expect %v, but %v", c.pattern, c.s, c.match, !c.match)
+		}
+	}
+}
+
+func Test_TypedCache_Range(t *testing.T) {
+	tc, err := NewTyped[int, string](func(v string) int { return len(v) }, nil)
+	if nil != err {
+		t.Fatalf("New typed cache instance failed! err=%v", err)
+	}
+	defer tc.Close()
+
+	tc.Set(1, "one")
+	tc.Set(2, "two")
+	keys := []int{}
+	tc.Range(func(key int, value string, ttl int64) bool {
+		keys = append(keys, key)
+		return true
+	})
+	sort.Ints(keys)
+	if len(keys) != 2 || keys[0] != 1 || keys[1] != 2 {
+		t.Fatalf("Range expect [1 2], but %v", keys)
+	}
+}
@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Loader loads the value of a key missing in the cache, ttl <= 0 for the default ttl
+type Loader func(ctx context.Context) (value CacheItem, ttl int64, err error)
+
+// an in-flight load shared by all the callers of the same key
+type load_call struct {
+	done  chan struct{}
+	value CacheItem
+	ttl   int64
+	err   error
+}
+
+// a cached loader error
+type load_error struct {
+	err    error
+	expire int64
+}
+
+type load_group struct {
+	lock   sync.Mutex
+	calls  map[string]*load_call
+	errors map[string]*load_error
+}
+
+// GetOrLoad returns the value of key, if it is missing the loader is called and the loaded value is set with its ttl.
+// Only one load of a key runs at a time, concurrent callers wait for it and share its result.
+// The loader runs with the ctx of the caller starting it, other callers stop waiting once their own ctx is done.
+// Loader errors are returned to all the waiting callers, and also to the later ones for LoadErrorTtlSecs if it is > 0.
+// A load failing with the cancellation or deadline of its ctx is neither shared nor cached,
+// the waiting callers whose own ctx is still alive start another load.
+func (cache *Cache) GetOrLoad(ctx context.Context, key string, loader Loader) (value CacheItem, ttl int64, err error) {
+	if value, ttl := cache.Get(key); value != nil {
+		return value, ttl, nil
+	}
+	if cache.Closed() {
+		return nil, 0, ErrClosed
+	}
+
+	group := &cache.loads
+	group.lock.Lock()
+
+	//negative entry
+	if load_err, exist := group.errors[key]; exist {
+		if load_err.expire > cache.now() {
+			group.lock.Unlock()
+			return nil, 0, load_err.err
+		}
+		delete(group.errors, key)
+	}
+
+	//wait for the in-flight load
+	if call, exist := group.calls[key]; exist {
+		group.lock.Unlock()
+		select {
+		case <-call.done:
+			if isContextErr(call.err) && ctx.Err() == nil {
+				return cache.GetOrLoad(ctx, key, loader)
+			}
+			return call.value, call.ttl, call.err
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		}
+	}
+
+	//a load may have finished since the first check, not counted as another Get
+	if ele_, exist := cache.shard(key).sync_map.Load(key); exist {
+		ele := ele_.(*cache_element)
+		if now := cache.now(); ele.expire() > now {
+			group.lock.Unlock()
+			return ele.Value.(CacheItem), millisToSecs(ele.expire() - now), nil
+		}
+	}
+
+	call := &load_call{done: make(chan struct{})}
+	if group.calls == nil {
+		group.calls = make(map[string]*load_call)
+	}
+	group.calls[key] = call
+	group.lock.Unlock()
+
+	call.value, call.ttl, call.err = cache.load(ctx, key, loader)
+	if call.err != nil {
+		atomic.AddInt64(&cache.stats.load_failures, 1)
+	} else {
+		atomic.AddInt64(&cache.stats.load_successes, 1)
+	}
+
+	group.lock.Lock()
+	delete(group.calls, key)
+	if call.err != nil && cache.cache_config.LoadErrorTtlSecs > 0 && !errors.Is(call.err, ErrClosed) && !isContextErr(call.err) {
+		if group.errors == nil {
+			group.errors = make(map[string]*load_error)
+		}
+		group.errors[key] = &load_error{
+			err:    call.err,
+			expire: cache.now() + secsToMillis(cache.cache_config.LoadErrorTtlSecs),
+		}
+	}
+	group.lock.Unlock()
+	close(call.done)
+
+	return call.value, call.ttl, call.err
+}
+
+// the ctx of the caller running the load is done, which says nothing about the key
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// call the loader and set the loaded value, a panic in the loader is returned as an error
+func (cache *Cache) load(ctx context.Context, key string, loader Loader) (value CacheItem, ttl int64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			value, ttl, err = nil, 0, fmt.Errorf("loader panic: %v", r)
+		}
+	}()
+
+	value, ttl, err = loader(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if value == nil {
+		return nil, 0, errors.New("loader returned nil value")
+	}
+
+	if ttl <= 0 {
+		ttl = cache.cache_config.DefaultTtlSecs
+	}
+	if ttl > cache.cache_config.MaxTtlSecs {
+		ttl = cache.cache_config.MaxTtlSecs
+	}
+	if err := cache.SetTTL(key, value, ttl); err != nil {
+		return nil, 0, err
+	}
+	return value, ttl, nil
+}
+
+// remove the expired negative entries
+func (group *load_group) purge(now int64) {
+	group.lock.Lock()
+	defer group.lock.Unlock()
+
+	for key, load_err := range group.errors {
+		if load_err.expire <= now {
+			delete(group.errors, key)
+		}
+	}
+}
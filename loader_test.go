@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_Cache_GetOrLoad(t *testing.T) {
+	cache, err := New(nil)
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	jack := &Person{"Jack", 18, "London"}
+	var loads int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (CacheItem, int64, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return jack, 60, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, ttl, err := cache.GetOrLoad(context.Background(), "a", loader)
+			if err != nil || v != jack || ttl != 60 {
+				t.Errorf("GetOrLoad expect %v 60 nil, but %v %d %v", jack, v, ttl, err)
+			}
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if loads != 1 {
+		t.Fatalf("loader expect to be called once, but %d", loads)
+	}
+	if v, ttl := cache.Get("a"); v != jack || ttl != 60 {
+		t.Fatalf("get 'a' expect %v 60, but %v %d", jack, v, ttl)
+	}
+
+	// cached value, loader not called
+	cache.GetOrLoad(context.Background(), "a", loader)
+	if loads != 1 {
+		t.Fatalf("loader expect not to be called for a cached key, but %d", loads)
+	}
+}
+
+func Test_Cache_GetOrLoadError(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	cache, err := New(&CacheConfig{Clock: clock, LoadErrorTtlSecs: 10})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	load_err := errors.New("backend down")
+	var loads int32
+	loader := func(ctx context.Context) (CacheItem, int64, error) {
+		atomic.AddInt32(&loads, 1)
+		return nil, 0, load_err
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := cache.GetOrLoad(context.Background(), "a", loader); err != load_err {
+			t.Fatalf("GetOrLoad expect %v, but %v", load_err, err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("loader error expect to be cached, but loader called %d times", loads)
+	}
+
+	// negative entry expired
+	clock.Advance(10 * time.Second)
+	cache.GetOrLoad(context.Background(), "a", loader)
+	if loads != 2 {
+		t.Fatalf("loader expect to be called again after LoadErrorTtlSecs, but %d", loads)
+	}
+
+	// panic is returned as an error
+	_, _, err = cache.GetOrLoad(context.Background(), "b", func(ctx context.Context) (CacheItem, int64, error) {
+		panic("boom")
+	})
+	if err == nil {
+		t.Fatalf("loader panic expect an error")
+	}
+
+	// waiter gives up with its ctx
+	release := make(chan struct{})
+	go cache.GetOrLoad(context.Background(), "c", func(ctx context.Context) (CacheItem, int64, error) {
+		<-release
+		return &Person{"Jack", 18, "London"}, 0, nil
+	})
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := cache.GetOrLoad(ctx, "c", loader); err != context.DeadlineExceeded {
+		t.Fatalf("waiter expect %v, but %v", context.DeadlineExceeded, err)
+	}
+	close(release)
+}
+
+func Test_Cache_GetOrLoadCanceled(t *testing.T) {
+	cache, err := New(&CacheConfig{LoadErrorTtlSecs: 60})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	leader := make(chan error, 1)
+	go func() {
+		_, _, err := cache.GetOrLoad(ctx, "a", func(ctx context.Context) (CacheItem, int64, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, 0, ctx.Err()
+		})
+		leader <- err
+	}()
+	<-started
+
+	//waits for the leader, or loads after it if it comes late
+	waiter := make(chan CacheItem, 1)
+	go func() {
+		value, _, _ := cache.GetOrLoad(context.Background(), "a", func(ctx context.Context) (CacheItem, int64, error) {
+			return &Person{"Jack", 18, "London"}, 10, nil
+		})
+		waiter <- value
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	if err := <-leader; !errors.Is(err, context.Canceled) {
+		t.Fatalf("leader expect context.Canceled, but %v", err)
+	}
+	if value := <-waiter; value == nil || value.(*Person).Name != "Jack" {
+		t.Fatalf("waiter expect Jack despite the canceled leader, but %v", value)
+	}
+	if value, _ := cache.Get("a"); value == nil {
+		t.Fatalf("a expect to be loaded, but nil")
+	}
+}
@@ -0,0 +1,81 @@
+package memcache
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/xlander-io/cache"
+)
+
+// Item is a value set with non zero flags, a value with flags 0 is stored as cache.Bytes
+// so that it is shared with the resp server
+type Item struct {
+	Flags uint32
+	Value []byte
+}
+
+func (item Item) CacheBytes() int {
+	return 4 + len(item.Value)
+}
+
+// the flags and data of a value of the cache, ok is false if it is neither cache.Bytes nor Item
+func itemOf(value cache.CacheItem) (flags uint32, data []byte, ok bool) {
+	switch v := value.(type) {
+	case cache.Bytes:
+		return 0, v, true
+	case Item:
+		return v.Flags, v.Value, true
+	}
+	return 0, nil, false
+}
+
+// the value of the cache for flags and data
+func valueOf(flags uint32, data []byte) cache.CacheItem {
+	if flags == 0 {
+		return cache.Bytes(data)
+	}
+	return Item{Flags: flags, Value: data}
+}
+
+const (
+	codec_bytes byte = 0
+	codec_item  byte = 1
+)
+
+type codec struct{}
+
+// NewCodec encodes both cache.Bytes and Item values, for the append only log and snapshots
+// of a cache served by this package.
+//
+//	cache.Bytes: byte 0, data
+//	Item:        byte 1, uint32 big endian flags, data
+func NewCodec() cache.Codec {
+	return codec{}
+}
+
+func (codec) Name() string {
+	return "memcache"
+}
+
+func (codec) Encode(value cache.CacheItem) ([]byte, error) {
+	switch v := value.(type) {
+	case cache.Bytes:
+		return append([]byte{codec_bytes}, v...), nil
+	case Item:
+		data := make([]byte, 5, 5+len(v.Value))
+		data[0] = codec_item
+		binary.BigEndian.PutUint32(data[1:], v.Flags)
+		return append(data, v.Value...), nil
+	}
+	return nil, errors.New("memcache codec: value is neither cache.Bytes nor Item")
+}
+
+func (codec) Decode(data []byte) (cache.CacheItem, error) {
+	switch {
+	case len(data) >= 1 && data[0] == codec_bytes:
+		return cache.Bytes(data[1:]), nil
+	case len(data) >= 5 && data[0] == codec_item:
+		return Item{Flags: binary.BigEndian.Uint32(data[1:]), Value: data[5:]}, nil
+	}
+	return nil, errors.New("memcache codec: corrupted value")
+}
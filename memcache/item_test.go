@@ -0,0 +1,29 @@
+package memcache
+
+import (
+	"testing"
+
+	"github.com/xlander-io/cache"
+)
+
+func Test_Codec(t *testing.T) {
+	codec := NewCodec()
+	for _, value := range []cache.CacheItem{cache.Bytes("hello"), cache.Bytes{}, Item{Flags: 7, Value: []byte("x")}} {
+		data, err := codec.Encode(value)
+		if err != nil {
+			t.Fatalf("Encode %v expect nil, but %v", value, err)
+		}
+		decoded, err := codec.Decode(data)
+		if err != nil {
+			t.Fatalf("Decode %v expect nil, but %v", value, err)
+		}
+		flags, v, _ := itemOf(value)
+		decoded_flags, decoded_v, ok := itemOf(decoded)
+		if !ok || flags != decoded_flags || string(v) != string(decoded_v) {
+			t.Fatalf("Decode expect %v, but %v", value, decoded)
+		}
+	}
+	if _, err := codec.Decode([]byte{9}); err == nil {
+		t.Fatalf("Decode of a corrupted value expect an error, but nil")
+	}
+}
@@ -0,0 +1,558 @@
+// Package memcache speaks the memcached text protocol in front of a cache.
+//
+// The storage commands set, add, replace and cas, the retrieval commands get and gets,
+// and delete, touch, incr, decr, stats, flush_all, version, verbosity and quit are supported.
+// The cas unique of an item is its version in the cache.
+package memcache
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xlander-io/cache"
+	"github.com/xlander-io/cache/internal/netserver"
+)
+
+// ErrServerClosed is returned by Serve once Close is called
+var ErrServerClosed = netserver.ErrServerClosed
+
+// limits of the protocol, as in the default config of memcached
+const (
+	MaxKeyLength   = 250
+	MaxValueLength = 1 << 20
+	max_line       = 64 << 10
+)
+
+// an exptime up to 30 days is relative, beyond it is an absolute unix time
+const max_relative_exptime = 60 * 60 * 24 * 30
+
+var errBadFormat = errors.New("bad command line format")
+
+// Server serves a cache of cache.Bytes and Item values to memcached clients, one go-routine per connection
+type Server struct {
+	cache   *cache.Cache
+	max_ttl int64 //of an exptime of 0
+	started time.Time
+	net     netserver.Server
+	stats   server_stats
+	//the pending flush_all with a delay, replaced by the next flush_all
+	flush_lock  sync.Mutex
+	flush_timer cache.Timer
+}
+
+// counters of the commands, reported by stats
+type server_stats struct {
+	cmd_get       int64
+	cmd_set       int64
+	cmd_touch     int64
+	get_hits      int64
+	get_misses    int64
+	delete_hits   int64
+	delete_misses int64
+	incr_hits     int64
+	incr_misses   int64
+	decr_hits     int64
+	decr_misses   int64
+	cas_hits      int64
+	cas_misses    int64
+	cas_badval    int64
+	touch_hits    int64
+	touch_misses  int64
+}
+
+func NewServer(c *cache.Cache) *Server {
+	return &Server{
+		cache:   c,
+		max_ttl: c.GetConfig().MaxTtlSecs,
+		started: time.Now(),
+	}
+}
+
+// Serve accepts connections on l until l fails or Close is called, l is closed on return.
+// It can be called for several listeners, like a tcp and a unix one.
+func (server *Server) Serve(l net.Listener) error {
+	return server.net.Serve(l, server.serveConn)
+}
+
+// Close stops the listeners, closes the connections and waits for their go-routines. The cache is not closed,
+// a pending flush_all with a delay is canceled.
+func (server *Server) Close() error {
+	err := server.net.Close()
+	server.scheduleFlush(0)
+	return err
+}
+
+// replace the pending flush_all by one flushing the cache in delay, 0 only cancels it
+func (server *Server) scheduleFlush(delay time.Duration) {
+	server.flush_lock.Lock()
+	defer server.flush_lock.Unlock()
+	if server.flush_timer != nil {
+		server.flush_timer.Stop()
+		server.flush_timer = nil
+	}
+	if delay > 0 {
+		flush := server.cache.Flush
+		server.flush_timer = server.cache.GetConfig().Clock.AfterFunc(delay, func() { flush() })
+	}
+}
+
+// the state of a connection
+type conn struct {
+	server *Server
+	r      *bufio.Reader
+	w      *bufio.Writer
+}
+
+func (server *Server) serveConn(net_conn net.Conn) {
+	c := &conn{
+		server: server,
+		r:      bufio.NewReaderSize(net_conn, max_line),
+		w:      bufio.NewWriter(net_conn),
+	}
+	for {
+		line, err := c.r.ReadSlice('\n')
+		if err != nil {
+			if err == bufio.ErrBufferFull {
+				c.reply("CLIENT_ERROR line too long")
+				c.w.Flush()
+			}
+			return
+		}
+		args := bytes.Fields(line)
+		if len(args) == 0 {
+			c.reply("ERROR")
+			continue
+		}
+
+		quit := c.execute(args)
+		//replies of pipelined commands are flushed together
+		if quit || c.r.Buffered() == 0 {
+			if c.w.Flush() != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+func (c *conn) reply(line string) {
+	c.w.WriteString(line)
+	c.w.WriteString("\r\n")
+}
+
+// run the command of args and write its reply, quit is true once the connection is to be closed
+func (c *conn) execute(args [][]byte) (quit bool) {
+	switch string(args[0]) {
+	case "get", "gets":
+		c.get(args[1:], len(args[0]) == 4)
+	case "set", "add", "replace", "cas":
+		return c.store(string(args[0]), args[1:])
+	case "delete":
+		c.delete(args[1:])
+	case "touch":
+		c.touch(args[1:])
+	case "incr", "decr":
+		c.incr(args[1:], string(args[0]) == "incr")
+	case "stats":
+		c.statsReply(args[1:])
+	case "flush_all":
+		c.flushAll(args[1:])
+	case "version":
+		c.reply("VERSION 1.6.0-xlander-io")
+	case "verbosity":
+		c.replyUnless(noreply(args[1:]), "OK")
+	case "quit":
+		return true
+	default:
+		c.reply("ERROR")
+	}
+	return false
+}
+
+// whether the last arg is noreply
+func noreply(args [][]byte) bool {
+	return len(args) > 0 && string(args[len(args)-1]) == "noreply"
+}
+
+func (c *conn) replyUnless(noreply bool, line string) {
+	if !noreply {
+		c.reply(line)
+	}
+}
+
+func validKey(key []byte) bool {
+	if len(key) == 0 || len(key) > MaxKeyLength {
+		return false
+	}
+	for _, b := range key {
+		if b <= ' ' || b == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// get <key>*, gets also returns the cas unique of every item
+func (c *conn) get(keys [][]byte, cas bool) {
+	if len(keys) == 0 {
+		c.reply("ERROR")
+		return
+	}
+	for _, key := range keys {
+		if !validKey(key) {
+			c.reply("CLIENT_ERROR bad command line format")
+			return
+		}
+	}
+	for _, key := range keys {
+		atomic.AddInt64(&c.server.stats.cmd_get, 1)
+		value, _, version := c.server.cache.GetWithVersion(string(key))
+		flags, data, ok := itemOf(value)
+		if !ok {
+			atomic.AddInt64(&c.server.stats.get_misses, 1)
+			continue
+		}
+		atomic.AddInt64(&c.server.stats.get_hits, 1)
+
+		c.w.WriteString("VALUE ")
+		c.w.Write(key)
+		c.w.WriteString(" " + strconv.FormatUint(uint64(flags), 10) + " " + strconv.Itoa(len(data)))
+		if cas {
+			c.w.WriteString(" " + strconv.FormatUint(version, 10))
+		}
+		c.w.WriteString("\r\n")
+		c.w.Write(data)
+		c.w.WriteString("\r\n")
+	}
+	c.reply("END")
+}
+
+// <command> <key> <flags> <exptime> <bytes> [<cas unique>] [noreply], followed by the data block
+func (c *conn) store(command string, args [][]byte) (quit bool) {
+	atomic.AddInt64(&c.server.stats.cmd_set, 1)
+	fields := 4
+	if command == "cas" {
+		fields = 5
+	}
+	no_reply := noreply(args)
+	if len(args) < 4 {
+		c.reply("ERROR")
+		return false
+	}
+	length, err := strconv.Atoi(string(args[3]))
+	if err != nil || length < 0 {
+		//the data block can not be skipped
+		c.reply("CLIENT_ERROR bad data chunk")
+		return true
+	}
+	if length > MaxValueLength {
+		if _, err := io.CopyN(io.Discard, c.r, int64(length)+2); err != nil {
+			return true
+		}
+		c.reply("SERVER_ERROR object too large for cache")
+		return false
+	}
+	data := make([]byte, length+2)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return true
+	}
+	if data[length] != '\r' || data[length+1] != '\n' {
+		c.reply("CLIENT_ERROR bad data chunk")
+		return true
+	}
+	data = data[:length]
+
+	key := args[0]
+	flags, flags_err := strconv.ParseUint(string(args[1]), 10, 32)
+	exptime, exptime_err := strconv.ParseInt(string(args[2]), 10, 64)
+	var cas_unique uint64
+	var cas_err error
+	if command == "cas" && len(args) > 4 {
+		cas_unique, cas_err = strconv.ParseUint(string(args[4]), 10, 64)
+	}
+	if !validKey(key) || flags_err != nil || exptime_err != nil || cas_err != nil ||
+		len(args) < fields || len(args) > fields+1 || (len(args) == fields+1 && !no_reply) {
+		c.reply("CLIENT_ERROR " + errBadFormat.Error())
+		return false
+	}
+
+	ttl, expired := c.server.ttlOf(exptime)
+	value := valueOf(uint32(flags), data)
+
+	c.replyUnless(no_reply, c.server.storeValue(command, string(key), value, ttl, cas_unique, expired))
+	return false
+}
+
+// the reply of a storage command
+// an expired value is stored like memcached does and gone right away, so only the key it replaces is deleted
+func (server *Server) storeValue(command string, key string, value cache.CacheItem, ttl int64, cas_unique uint64, expired bool) string {
+	stored := true
+	var err error
+	switch command {
+	case "set":
+		if expired {
+			err = server.cache.Delete(key)
+		} else {
+			err = server.cache.SetTTL(key, value, ttl)
+		}
+	case "add":
+		if expired {
+			_, exists := server.cache.TTL(key)
+			stored = !exists
+		} else {
+			stored, err = server.cache.SetIfAbsent(key, value, ttl)
+		}
+	case "replace":
+		if expired {
+			var count int
+			count, err = server.cache.MDelete([]string{key})
+			stored = count == 1
+		} else {
+			stored, err = server.cache.SetIfPresent(key, value, ttl)
+		}
+	case "cas":
+		if expired {
+			stored, err = server.cache.CompareVersionAndDelete(key, cas_unique)
+		} else {
+			stored, err = server.cache.CompareVersionAndSwap(key, cas_unique, value, ttl)
+		}
+		if err == nil && !stored {
+			if _, exists := server.cache.TTL(key); exists {
+				atomic.AddInt64(&server.stats.cas_badval, 1)
+				return "EXISTS"
+			}
+			atomic.AddInt64(&server.stats.cas_misses, 1)
+			return "NOT_FOUND"
+		}
+		if stored {
+			atomic.AddInt64(&server.stats.cas_hits, 1)
+		}
+	}
+	if err != nil {
+		return "SERVER_ERROR " + err.Error()
+	}
+	if !stored {
+		return "NOT_STORED"
+	}
+	return "STORED"
+}
+
+// ttl secs of a memcached exptime: 0 never expires, which is MaxTtlSecs here, up to 30 days it is relative,
+// beyond it is an absolute unix time. expired is true for a negative exptime or a time which has passed
+func (server *Server) ttlOf(exptime int64) (ttl int64, expired bool) {
+	switch {
+	case exptime < 0:
+		return 0, true
+	case exptime == 0:
+		return server.max_ttl, false
+	case exptime > max_relative_exptime:
+		exptime -= server.cache.GetUnixTime()
+		if exptime <= 0 {
+			return 0, true
+		}
+	}
+	//capped by MaxTtlSecs in the cache
+	return exptime, false
+}
+
+// delete <key> [0] [noreply], the 0 of old clients is accepted
+func (c *conn) delete(args [][]byte) {
+	no_reply := noreply(args)
+	if no_reply {
+		args = args[:len(args)-1]
+	}
+	if len(args) == 2 && string(args[1]) == "0" {
+		args = args[:1]
+	}
+	if len(args) != 1 || !validKey(args[0]) {
+		c.reply("CLIENT_ERROR bad command line format.  Usage: delete <key> [noreply]")
+		return
+	}
+
+	deleted, err := c.server.cache.MDelete([]string{string(args[0])})
+	switch {
+	case err != nil:
+		c.replyUnless(no_reply, "SERVER_ERROR "+err.Error())
+	case deleted == 0:
+		atomic.AddInt64(&c.server.stats.delete_misses, 1)
+		c.replyUnless(no_reply, "NOT_FOUND")
+	default:
+		atomic.AddInt64(&c.server.stats.delete_hits, 1)
+		c.replyUnless(no_reply, "DELETED")
+	}
+}
+
+// touch <key> <exptime> [noreply]
+func (c *conn) touch(args [][]byte) {
+	atomic.AddInt64(&c.server.stats.cmd_touch, 1)
+	no_reply := noreply(args)
+	if no_reply {
+		args = args[:len(args)-1]
+	}
+	if len(args) != 2 || !validKey(args[0]) {
+		c.reply("ERROR")
+		return
+	}
+	exptime, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		c.reply("CLIENT_ERROR invalid exptime argument")
+		return
+	}
+
+	ttl, expired := c.server.ttlOf(exptime)
+	if expired {
+		//Expire with a ttl of 0 deletes the key
+		ttl = 0
+	}
+	ok, err := c.server.cache.Expire(string(args[0]), ttl)
+	switch {
+	case err != nil:
+		c.replyUnless(no_reply, "SERVER_ERROR "+err.Error())
+	case !ok:
+		atomic.AddInt64(&c.server.stats.touch_misses, 1)
+		c.replyUnless(no_reply, "NOT_FOUND")
+	default:
+		atomic.AddInt64(&c.server.stats.touch_hits, 1)
+		c.replyUnless(no_reply, "TOUCHED")
+	}
+}
+
+// incr|decr <key> <delta> [noreply]: a 64 bit unsigned value, incr wraps around and decr stops at 0.
+// the ttl and flags are kept
+func (c *conn) incr(args [][]byte, incr bool) {
+	no_reply := noreply(args)
+	if no_reply {
+		args = args[:len(args)-1]
+	}
+	if len(args) != 2 || !validKey(args[0]) {
+		c.reply("ERROR")
+		return
+	}
+	delta, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		c.reply("CLIENT_ERROR invalid numeric delta argument")
+		return
+	}
+
+	var reply string
+	_, _, err = c.server.cache.Update(string(args[0]), func(old cache.CacheItem, exists bool) (cache.CacheItem, int64, cache.UpdateAction) {
+		if !exists {
+			reply = "NOT_FOUND"
+			return nil, 0, cache.UpdateKeep
+		}
+		flags, data, ok := itemOf(old)
+		n, parse_err := strconv.ParseUint(string(data), 10, 64)
+		if !ok || parse_err != nil {
+			reply = "CLIENT_ERROR cannot increment or decrement non-numeric value"
+			return nil, 0, cache.UpdateKeep
+		}
+		switch {
+		case incr:
+			n += delta
+		case delta > n:
+			n = 0
+		default:
+			n -= delta
+		}
+		reply = strconv.FormatUint(n, 10)
+		return valueOf(flags, []byte(reply)), 0, cache.UpdateReplace
+	})
+	if err != nil {
+		reply = "SERVER_ERROR " + err.Error()
+	}
+
+	hits, misses := &c.server.stats.incr_hits, &c.server.stats.incr_misses
+	if !incr {
+		hits, misses = &c.server.stats.decr_hits, &c.server.stats.decr_misses
+	}
+	if reply == "NOT_FOUND" {
+		atomic.AddInt64(misses, 1)
+	} else {
+		atomic.AddInt64(hits, 1)
+	}
+	c.replyUnless(no_reply, reply)
+}
+
+// flush_all [delay] [noreply], a delayed flush runs on the clock of the cache until the next flush_all or Close
+func (c *conn) flushAll(args [][]byte) {
+	no_reply := noreply(args)
+	if no_reply {
+		args = args[:len(args)-1]
+	}
+	delay := int64(0)
+	if len(args) > 1 {
+		c.reply("ERROR")
+		return
+	}
+	if len(args) == 1 {
+		var err error
+		if delay, err = strconv.ParseInt(string(args[0]), 10, 64); err != nil || delay < 0 {
+			c.reply("CLIENT_ERROR bad command line format")
+			return
+		}
+	}
+
+	//like memcached, a flush_all replaces the pending one
+	c.server.scheduleFlush(time.Duration(delay) * time.Second)
+	if delay > 0 {
+		c.replyUnless(no_reply, "OK")
+		return
+	}
+	if _, err := c.server.cache.Flush(); err != nil {
+		c.replyUnless(no_reply, "SERVER_ERROR "+err.Error())
+		return
+	}
+	c.replyUnless(no_reply, "OK")
+}
+
+// stats, the general statistics only
+func (c *conn) statsReply(args [][]byte) {
+	if len(args) > 0 {
+		c.reply("ERROR")
+		return
+	}
+	server := c.server
+	cache_stats := server.cache.Stats()
+	stat := func(name string, value int64) {
+		c.reply("STAT " + name + " " + strconv.FormatInt(value, 10))
+	}
+	load := func(counter *int64) int64 {
+		return atomic.LoadInt64(counter)
+	}
+
+	stat("pid", int64(os.Getpid()))
+	stat("uptime", int64(time.Since(server.started)/time.Second))
+	stat("time", server.cache.GetUnixTime())
+	c.reply("STAT version 1.6.0-xlander-io")
+	stat("curr_connections", int64(server.net.Conns()))
+	stat("total_connections", server.net.Connections())
+	stat("cmd_get", load(&server.stats.cmd_get))
+	stat("cmd_set", load(&server.stats.cmd_set))
+	stat("cmd_touch", load(&server.stats.cmd_touch))
+	stat("get_hits", load(&server.stats.get_hits))
+	stat("get_misses", load(&server.stats.get_misses))
+	stat("delete_hits", load(&server.stats.delete_hits))
+	stat("delete_misses", load(&server.stats.delete_misses))
+	stat("incr_hits", load(&server.stats.incr_hits))
+	stat("incr_misses", load(&server.stats.incr_misses))
+	stat("decr_hits", load(&server.stats.decr_hits))
+	stat("decr_misses", load(&server.stats.decr_misses))
+	stat("cas_hits", load(&server.stats.cas_hits))
+	stat("cas_misses", load(&server.stats.cas_misses))
+	stat("cas_badval", load(&server.stats.cas_badval))
+	stat("touch_hits", load(&server.stats.touch_hits))
+	stat("touch_misses", load(&server.stats.touch_misses))
+	stat("curr_items", int64(cache_stats.Items))
+	stat("bytes", int64(cache_stats.Bytes))
+	stat("limit_maxbytes", server.cache.GetConfig().CacheBytesLimit)
+	stat("evictions", cache_stats.Evictions[cache.EvictCapacity]+cache_stats.Evictions[cache.EvictQuota])
+	stat("expired_unfetched", cache_stats.Evictions[cache.EvictExpired])
+	c.reply("END")
+}
@@ -0,0 +1,289 @@
+package memcache
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xlander-io/cache"
+)
+
+// a server of a new cache on a loopback tcp listener, closed with the test
+func newTestServer(t *testing.T, clock cache.Clock) (*cache.Cache, *Server, net.Addr) {
+	c, err := cache.New(&cache.CacheConfig{Clock: clock, ShardCount: 4})
+	if err != nil {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen expect nil, but %v", err)
+	}
+	server := NewServer(c)
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(l) }()
+	t.Cleanup(func() {
+		server.Close()
+		if err := <-done; err != ErrServerClosed {
+			t.Errorf("Serve expect ErrServerClosed, but %v", err)
+		}
+		c.Close()
+	})
+	return c, server, l.Addr()
+}
+
+type testConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func dial(t *testing.T, addr net.Addr) *testConn {
+	conn, err := net.DialTimeout("tcp", addr.String(), time.Second)
+	if err != nil {
+		t.Fatalf("Dial expect nil, but %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &testConn{Conn: conn, r: bufio.NewReader(conn)}
+}
+
+// send request and check the reply, both with \n for \r\n
+func expectReply(t *testing.T, conn *testConn, request string, expect string) {
+	t.Helper()
+	if _, err := conn.Write([]byte(strings.ReplaceAll(request, "\n", "\r\n"))); err != nil {
+		t.Fatalf("%q write expect nil, but %v", request, err)
+	}
+	expect = strings.ReplaceAll(expect, "\n", "\r\n")
+	got := make([]byte, len(expect))
+	if _, err := io.ReadFull(conn.r, got); err != nil {
+		t.Fatalf("%q expect %q, but %v after %q", request, expect, err, got)
+	}
+	if string(got) != expect {
+		t.Fatalf("%q expect %q, but %q", request, expect, got)
+	}
+}
+
+// the cas unique of key from a gets
+func casOf(t *testing.T, conn *testConn, key string) string {
+	t.Helper()
+	conn.Write([]byte("gets " + key + "\r\n"))
+	line, _ := conn.r.ReadString('\n')
+	fields := strings.Fields(line)
+	if len(fields) != 5 {
+		t.Fatalf("gets %s expect a VALUE line, but %q", key, line)
+	}
+	length, _ := strconv.Atoi(fields[3])
+	io.CopyN(io.Discard, conn.r, int64(length)+2)
+	if end, _ := conn.r.ReadString('\n'); end != "END\r\n" {
+		t.Fatalf("gets %s expect END, but %q", key, end)
+	}
+	return fields[4]
+}
+
+func Test_Server_Storage(t *testing.T) {
+	clock := cache.NewFakeClock(time.Unix(1700000000, 0))
+	c, _, addr := newTestServer(t, clock)
+	conn := dial(t, addr)
+
+	expectReply(t, conn, "set a 0 0 5\nhello\n", "STORED\n")
+	expectReply(t, conn, "get a b\n", "VALUE a 0 5\nhello\nEND\n")
+	expectReply(t, conn, "set b 42 100 0\n\n", "STORED\n")
+	expectReply(t, conn, "get a b\n", "VALUE a 0 5\nhello\nVALUE b 42 0\n\nEND\n")
+
+	//flags 0 are shared as cache.Bytes, others as Item
+	if value, _ := c.Get("a"); string(value.(cache.Bytes)) != "hello" {
+		t.Fatalf("a expect cache.Bytes hello, but %v", value)
+	}
+	if value, _ := c.Get("b"); value.(Item).Flags != 42 {
+		t.Fatalf("b expect Item with flags 42, but %v", value)
+	}
+	//an exptime of 0 is MaxTtlSecs, a relative one is a ttl
+	if ttl, _ := c.TTL("a"); ttl != c.GetConfig().MaxTtlSecs {
+		t.Fatalf("a ttl expect %d, but %d", c.GetConfig().MaxTtlSecs, ttl)
+	}
+	if ttl, _ := c.TTL("b"); ttl != 100 {
+		t.Fatalf("b ttl expect 100, but %d", ttl)
+	}
+
+	expectReply(t, conn, "add a 0 0 1\nx\n", "NOT_STORED\n")
+	expectReply(t, conn, "add c 0 0 1\nx\n", "STORED\n")
+	expectReply(t, conn, "replace d 0 0 1\nx\n", "NOT_STORED\n")
+	expectReply(t, conn, "replace c 0 0 1\ny\n", "STORED\n")
+	expectReply(t, conn, "get c\n", "VALUE c 0 1\ny\nEND\n")
+
+	//an absolute exptime
+	expectReply(t, conn, "set abs 0 1700000060 1\nx\n", "STORED\n")
+	if ttl, _ := c.TTL("abs"); ttl != 60 {
+		t.Fatalf("abs ttl expect 60, but %d", ttl)
+	}
+	//a past one or a negative one expires right away
+	expectReply(t, conn, "set past 0 1600000000 1\nx\n", "STORED\n")
+	expectReply(t, conn, "set neg 0 -1 1\nx\n", "STORED\n")
+	expectReply(t, conn, "get past neg\n", "END\n")
+
+	clock.Advance(101 * time.Second)
+	expectReply(t, conn, "get b abs\n", "END\n")
+
+	//noreply, then a command with a reply on the same connection
+	expectReply(t, conn, "set q 0 0 1 noreply\nq\nget q\n", "VALUE q 0 1\nq\nEND\n")
+
+	expectReply(t, conn, "set big 0 0 "+strconv.Itoa(MaxValueLength+1)+"\n"+strings.Repeat("x", MaxValueLength+1)+"\n",
+		"SERVER_ERROR object too large for cache\n")
+	expectReply(t, conn, "set k 0 x 1\nx\n", "CLIENT_ERROR bad command line format\n")
+	expectReply(t, conn, "set "+strings.Repeat("k", MaxKeyLength+1)+" 0 0 1\nx\n", "CLIENT_ERROR bad command line format\n")
+	expectReply(t, conn, "get a "+strings.Repeat("k", MaxKeyLength+1)+"\n", "CLIENT_ERROR bad command line format\n")
+	expectReply(t, conn, "gets "+strings.Repeat("k", MaxKeyLength+1)+"\n", "CLIENT_ERROR bad command line format\n")
+	expectReply(t, conn, "bogus\n", "ERROR\n")
+	expectReply(t, conn, "get a\n", "VALUE a 0 5\nhello\nEND\n")
+
+	//a data block of the wrong length closes the connection
+	expectReply(t, conn, "set a 0 0 1\nxyz\n", "CLIENT_ERROR bad data chunk\n")
+	if _, err := conn.r.ReadByte(); err != io.EOF {
+		t.Fatalf("after a bad data chunk expect io.EOF, but %v", err)
+	}
+}
+
+func Test_Server_Cas(t *testing.T) {
+	_, _, addr := newTestServer(t, cache.NewFakeClock(time.Unix(1700000000, 0)))
+	conn := dial(t, addr)
+
+	expectReply(t, conn, "cas a 0 0 1 1\nx\n", "NOT_FOUND\n")
+	expectReply(t, conn, "set a 0 0 1\nx\n", "STORED\n")
+	unique := casOf(t, conn, "a")
+	expectReply(t, conn, "cas a 0 0 1 "+unique+"\ny\n", "STORED\n")
+	//the version has moved on
+	expectReply(t, conn, "cas a 0 0 1 "+unique+"\nz\n", "EXISTS\n")
+	expectReply(t, conn, "get a\n", "VALUE a 0 1\ny\nEND\n")
+	if next := casOf(t, conn, "a"); next == unique {
+		t.Fatalf("cas unique expect to change, but %s", next)
+	}
+
+	expectReply(t, conn, "cas a 0 0 1\nz\n", "CLIENT_ERROR bad command line format\n")
+}
+
+func Test_Server_PastExptime(t *testing.T) {
+	c, _, addr := newTestServer(t, cache.NewFakeClock(time.Unix(1700000000, 0)))
+	conn := dial(t, addr)
+
+	//the key replaced is deleted, nothing is stored
+	expectReply(t, conn, "set a 0 0 1\nx\n", "STORED\n")
+	expectReply(t, conn, "set a 0 -1 1\ny\n", "STORED\n")
+	expectReply(t, conn, "add b 0 -1 1\ny\n", "STORED\n")
+	expectReply(t, conn, "set c 0 0 1\nx\n", "STORED\n")
+	expectReply(t, conn, "add c 0 -1 1\ny\n", "NOT_STORED\n")
+	expectReply(t, conn, "get a b c\n", "VALUE c 0 1\nx\nEND\n")
+	expectReply(t, conn, "replace c 0 -1 1\ny\n", "STORED\n")
+	expectReply(t, conn, "replace c 0 -1 1\ny\n", "NOT_STORED\n")
+	expectReply(t, conn, "set d 0 0 1\nx\n", "STORED\n")
+	unique := casOf(t, conn, "d")
+	expectReply(t, conn, "cas d 0 -1 1 "+unique+"\ny\n", "STORED\n")
+	expectReply(t, conn, "cas d 0 -1 1 "+unique+"\ny\n", "NOT_FOUND\n")
+	expectReply(t, conn, "get a b c d\n", "END\n")
+
+	stats := c.Stats()
+	if stats.Sets != 3 || stats.Evictions[cache.EvictReplaced] != 0 || stats.Evictions[cache.EvictDeleted] != 3 {
+		t.Fatalf("sets, replaced and deleted expect 3 0 3, but %d %d %d",
+			stats.Sets, stats.Evictions[cache.EvictReplaced], stats.Evictions[cache.EvictDeleted])
+	}
+}
+
+func Test_Server_DeleteTouchIncr(t *testing.T) {
+	clock := cache.NewFakeClock(time.Unix(1700000000, 0))
+	c, _, addr := newTestServer(t, clock)
+	conn := dial(t, addr)
+
+	expectReply(t, conn, "set a 0 10 1\nx\n", "STORED\n")
+	expectReply(t, conn, "touch a 100\n", "TOUCHED\n")
+	if ttl, _ := c.TTL("a"); ttl != 100 {
+		t.Fatalf("a ttl expect 100, but %d", ttl)
+	}
+	expectReply(t, conn, "touch b 100\n", "NOT_FOUND\n")
+	expectReply(t, conn, "delete a\n", "DELETED\n")
+	expectReply(t, conn, "delete a 0\n", "NOT_FOUND\n")
+	expectReply(t, conn, "delete a 1\n", "CLIENT_ERROR bad command line format.  Usage: delete <key> [noreply]\n")
+
+	expectReply(t, conn, "incr n 1\n", "NOT_FOUND\n")
+	expectReply(t, conn, "set n 7 30 2\n10\n", "STORED\n")
+	expectReply(t, conn, "incr n 5\n", "15\n")
+	expectReply(t, conn, "decr n 20\n", "0\n")
+	expectReply(t, conn, "incr n 18446744073709551615\n", "18446744073709551615\n")
+	expectReply(t, conn, "incr n 2\n", "1\n")
+	expectReply(t, conn, "incr n x\n", "CLIENT_ERROR invalid numeric delta argument\n")
+	//flags and ttl are kept
+	expectReply(t, conn, "get n\n", "VALUE n 7 1\n1\nEND\n")
+	if ttl, _ := c.TTL("n"); ttl != 30 {
+		t.Fatalf("n ttl expect 30, but %d", ttl)
+	}
+	expectReply(t, conn, "set s 0 0 1\nx\n", "STORED\n")
+	expectReply(t, conn, "incr s 1\n", "CLIENT_ERROR cannot increment or decrement non-numeric value\n")
+	expectReply(t, conn, "incr n 1 noreply\nget n\n", "VALUE n 7 1\n2\nEND\n")
+}
+
+func Test_Server_StatsAndFlush(t *testing.T) {
+	clock := cache.NewFakeClock(time.Unix(1700000000, 0))
+	c, server, addr := newTestServer(t, clock)
+	conn := dial(t, addr)
+
+	expectReply(t, conn, "set a 0 0 1\nx\n", "STORED\n")
+	expectReply(t, conn, "get a b\n", "VALUE a 0 1\nx\nEND\n")
+	expectReply(t, conn, "version\n", "VERSION 1.6.0-xlander-io\n")
+	expectReply(t, conn, "verbosity 1\n", "OK\n")
+
+	conn.Write([]byte("stats\r\n"))
+	stats := map[string]string{}
+	for {
+		line, err := conn.r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stats expect lines, but %v", err)
+		}
+		if line == "END\r\n" {
+			break
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "STAT" {
+			t.Fatalf("stats expect STAT lines, but %q", line)
+		}
+		stats[fields[1]] = fields[2]
+	}
+	for name, expect := range map[string]string{"cmd_get": "2", "get_hits": "1", "get_misses": "1", "cmd_set": "1", "curr_items": "1", "curr_connections": "1"} {
+		if stats[name] != expect {
+			t.Fatalf("stat %s expect %s, but %s", name, expect, stats[name])
+		}
+	}
+
+	expectReply(t, conn, "flush_all\n", "OK\n")
+	expectReply(t, conn, "get a\n", "END\n")
+
+	expectReply(t, conn, "set a 0 0 1\nx\n", "STORED\n")
+	expectReply(t, conn, "flush_all 10\n", "OK\n")
+	expectReply(t, conn, "get a\n", "VALUE a 0 1\nx\nEND\n")
+	clock.Advance(10 * time.Second)
+	if items := c.Stats().Items; items != 0 {
+		t.Fatalf("items after a delayed flush expect 0, but %d", items)
+	}
+
+	//a new flush_all replaces the pending one
+	expectReply(t, conn, "set a 0 0 1\nx\n", "STORED\n")
+	expectReply(t, conn, "flush_all 10\n", "OK\n")
+	expectReply(t, conn, "flush_all 20\n", "OK\n")
+	clock.Advance(10 * time.Second)
+	expectReply(t, conn, "get a\n", "VALUE a 0 1\nx\nEND\n")
+	clock.Advance(10 * time.Second)
+	expectReply(t, conn, "get a\n", "END\n")
+
+	//and Close cancels it
+	expectReply(t, conn, "set a 0 0 1\nx\n", "STORED\n")
+	expectReply(t, conn, "flush_all 10\n", "OK\n")
+	expectReply(t, conn, "quit\n", "")
+	if _, err := conn.r.ReadByte(); err != io.EOF {
+		t.Fatalf("after quit expect io.EOF, but %v", err)
+	}
+	server.Close()
+	clock.Advance(10 * time.Second)
+	if items := c.Stats().Items; items != 1 {
+		t.Fatalf("items after closing the server with a pending flush expect 1, but %d", items)
+	}
+}
@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// MetricsHandler is an http.Handler writing the stats of the registered caches in the OpenMetrics text format,
+// each cache is labeled with cache="name"
+type MetricsHandler struct {
+	lock   sync.RWMutex
+	caches map[string]*Cache
+}
+
+func NewMetricsHandler() *MetricsHandler {
+	return &MetricsHandler{
+		caches: make(map[string]*Cache),
+	}
+}
+
+// register cache under name, an existing cache with the same name is replaced
+func (handler *MetricsHandler) Register(name string, cache *Cache) {
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	handler.caches[name] = cache
+}
+
+func (handler *MetricsHandler) Unregister(name string) {
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	delete(handler.caches, name)
+}
+
+func (handler *MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", openMetricsContentType)
+	if r.Method == http.MethodHead {
+		return
+	}
+	handler.WriteMetrics(w)
+}
+
+type metric_sample struct {
+	suffix string //appended to the family name, e.g. _total for counters
+	labels string
+	value  float64
+}
+
+type metric_family struct {
+	name    string
+	kind    string //gauge, counter or summary
+	help    string
+	samples func(name string, stats *CacheStats, config *CacheConfig) []metric_sample
+}
+
+func gaugeOf(f func(stats *CacheStats, config *CacheConfig) float64) func(string, *CacheStats, *CacheConfig) []metric_sample {
+	return func(name string, stats *CacheStats, config *CacheConfig) []metric_sample {
+		return []metric_sample{{labels: cacheLabel(name), value: f(stats, config)}}
+	}
+}
+
+func counterOf(f func(stats *CacheStats) int64) func(string, *CacheStats, *CacheConfig) []metric_sample {
+	return func(name string, stats *CacheStats, config *CacheConfig) []metric_sample {
+		return []metric_sample{{suffix: "_total", labels: cacheLabel(name), value: float64(f(stats))}}
+	}
+}
+
+var metric_families = []metric_family{
+	{"cache_items", "gauge", "Items in the cache.", gaugeOf(func(stats *CacheStats, config *CacheConfig) float64 {
+		return float64(stats.Items)
+	})},
+	{"cache_bytes", "gauge", "Bytes of the items in the cache.", gaugeOf(func(stats *CacheStats, config *CacheConfig) float64 {
+		return float64(stats.Bytes)
+	})},
+	{"cache_bytes_limit", "gauge", "CacheBytesLimit of the cache.", gaugeOf(func(stats *CacheStats, config *CacheConfig) float64 {
+		return float64(config.CacheBytesLimit)
+	})},
+	{"cache_hit_ratio", "gauge", "Hits over the reads of the cache.", gaugeOf(func(stats *CacheStats, config *CacheConfig) float64 {
+		if stats.Hits+stats.Misses == 0 {
+			return 0
+		}
+		return float64(stats.Hits) / float64(stats.Hits+stats.Misses)
+	})},
+	{"cache_hits", "counter", "Reads finding a live item.", counterOf(func(stats *CacheStats) int64 {
+		return stats.Hits
+	})},
+	{"cache_misses", "counter", "Reads finding no live item.", counterOf(func(stats *CacheStats) int64 {
+		return stats.Misses
+	})},
+	{"cache_expired_on_read", "counter", "Reads finding an expired item not recycled yet.", counterOf(func(stats *CacheStats) int64 {
+		return stats.ExpiredOnRead
+	})},
+	{"cache_sets", "counter", "Items stored.", counterOf(func(stats *CacheStats) int64 {
+		return stats.Sets
+	})},
+	{"cache_deletes", "counter", "Items removed by Delete.", counterOf(func(stats *CacheStats) int64 {
+		return stats.Deletes
+	})},
+	{"cache_evictions", "counter", "Items which left the cache by reason.", func(name string, stats *CacheStats, config *CacheConfig) []metric_sample {
+		samples := []metric_sample{}
+		for reason := EvictExpired; reason <= EvictQuota; reason++ {
+			samples = append(samples, metric_sample{
+				suffix: "_total",
+				labels: cacheLabel(name) + `,reason="` + reason.String() + `"`,
+				value:  float64(stats.Evictions[reason]),
+			})
+		}
+		return samples
+	}},
+	{"cache_loads", "counter", "Loader calls of GetOrLoad by result.", func(name string, stats *CacheStats, config *CacheConfig) []metric_sample {
+		return []metric_sample{
+			{suffix: "_total", labels: cacheLabel(name) + `,result="success"`, value: float64(stats.LoadSuccesses)},
+			{suffix: "_total", labels: cacheLabel(name) + `,result="failure"`, value: float64(stats.LoadFailures)},
+		}
+	}},
+	{"cache_skiplist_queue", "gauge", "Skiplist commands waiting in the chan buffers.", gaugeOf(func(stats *CacheStats, config *CacheConfig) float64 {
+		return float64(stats.SkipListQueue)
+	})},
+	{"cache_recycle_duration_seconds", "summary", "Duration of the recycler runs.", func(name string, stats *CacheStats, config *CacheConfig) []metric_sample {
+		return []metric_sample{
+			{suffix: "_count", labels: cacheLabel(name), value: float64(stats.RecycleRuns)},
+			{suffix: "_sum", labels: cacheLabel(name), value: stats.RecycleTotalDuration.Seconds()},
+		}
+	}},
+	{"cache_recycle_last_duration_seconds", "gauge", "Duration of the last recycler run.", gaugeOf(func(stats *CacheStats, config *CacheConfig) float64 {
+		return stats.RecycleLastDuration.Seconds()
+	})},
+	{"cache_recycle_max_duration_seconds", "gauge", "Duration of the longest recycler run.", gaugeOf(func(stats *CacheStats, config *CacheConfig) float64 {
+		return stats.RecycleMaxDuration.Seconds()
+	})},
+}
+
+// write the metrics of all the registered caches, sorted by name, terminated by # EOF
+func (handler *MetricsHandler) WriteMetrics(w io.Writer) error {
+	handler.lock.RLock()
+	names := make([]string, 0, len(handler.caches))
+	for name := range handler.caches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	stats := make([]*CacheStats, len(names))
+	configs := make([]*CacheConfig, len(names))
+	for i, name := range names {
+		stats[i] = handler.caches[name].Stats()
+		configs[i] = handler.caches[name].GetConfig()
+	}
+	handler.lock.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	for _, family := range metric_families {
+		fmt.Fprintf(bw, "# TYPE %s %s\n", family.name, family.kind)
+		fmt.Fprintf(bw, "# HELP %s %s\n", family.name, family.help)
+		for i, name := range names {
+			for _, sample := range family.samples(name, stats[i], configs[i]) {
+				fmt.Fprintf(bw, "%s%s{%s} %v\n", family.name, sample.suffix, sample.labels, sample.value)
+			}
+		}
+	}
+	bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+func cacheLabel(name string) string {
+	return `cache="` + escapeLabel(name) + `"`
+}
+
+var label_escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return label_escaper.Replace(value)
+}
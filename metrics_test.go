@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_MetricsHandler(t *testing.T) {
+	orders, _ := New(&CacheConfig{CacheBytesLimit: 1000})
+	defer orders.Close()
+	users, _ := New(nil)
+	defer users.Close()
+
+	jack := &Person{"Jack", 18, "London"}
+	orders.SetTTL("a", jack, 60)
+	orders.Get("a")
+	orders.Get("b")
+	orders.Delete("a")
+
+	handler := NewMetricsHandler()
+	handler.Register("orders", orders)
+	handler.Register(`us"ers`, users)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("get metrics failed! err=%v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	text := string(body)
+
+	if resp.Header.Get("Content-Type") != openMetricsContentType {
+		t.Fatalf("content type expect %s, but %s", openMetricsContentType, resp.Header.Get("Content-Type"))
+	}
+
+	for _, line := range []string{
+		"# TYPE cache_items gauge",
+		`cache_items{cache="orders"} 0`,
+		`cache_bytes_limit{cache="orders"} 1000`,
+		`cache_hit_ratio{cache="orders"} 0.5`,
+		"# TYPE cache_hits counter",
+		`cache_hits_total{cache="orders"} 1`,
+		`cache_misses_total{cache="orders"} 1`,
+		`cache_sets_total{cache="orders"} 1`,
+		`cache_evictions_total{cache="orders",reason="deleted"} 1`,
+		`cache_evictions_total{cache="orders",reason="capacity"} 0`,
+		`cache_loads_total{cache="orders",result="failure"} 0`,
+		`cache_recycle_duration_seconds_count{cache="orders"} 0`,
+		`cache_items{cache="us\"ers"} 0`,
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Fatalf("metrics expect line %q, but:\n%s", line, text)
+		}
+	}
+	if !strings.HasSuffix(text, "# EOF\n") {
+		t.Fatalf("metrics expect to end with # EOF, but:\n%s", text)
+	}
+
+	handler.Unregister("orders")
+	resp2, _ := http.Get(server.URL)
+	body, _ = io.ReadAll(resp2.Body)
+	resp2.Body.Close()
+	if strings.Contains(string(body), `cache="orders"`) {
+		t.Fatalf("unregistered cache expect no metrics")
+	}
+
+	resp3, _ := http.Post(server.URL, "text/plain", nil)
+	resp3.Body.Close()
+	if resp3.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("post expect status %d, but %d", http.StatusMethodNotAllowed, resp3.StatusCode)
+	}
+}
@@ -0,0 +1,332 @@
+package cache
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// the limits of a namespace, 0 for the ones of the cache
+type NamespaceConfig struct {
+	BytesQuota     int64 // max bytes of the namespace, recycled once RecycleRatioThreshold of it is reached
+	DefaultTtlSecs int64 // default set ttl of the namespace
+	MaxTtlSecs     int64 // max item duration in secs in the namespace, capped by the MaxTtlSecs of the cache
+}
+
+// NamespaceStats is a snapshot of the counters of a namespace, all counters start from its creation
+type NamespaceStats struct {
+	Items          int32 // current items
+	Bytes          int64 // current bytes
+	Hits           int64 // Get of the namespace found a live item
+	Misses         int64 // Get of the namespace found nothing
+	Sets           int64 // items stored in the namespace by any write
+	Deletes        int64 // items removed by Delete or Flush of the namespace
+	QuotaEvictions int64 // items recycled because the namespace was over its quota
+}
+
+// Namespace is a handle on the keys of the cache prefixed by its name and ":".
+// A key belongs to the namespace whichever way it is set, so keys written directly to the cache,
+// replayed from the append only log or loaded from a snapshot count in its quota and stats as well,
+// and their ttl is capped by its MaxTtlSecs, also by Expire and Persist.
+type Namespace struct {
+	cache  *Cache
+	name   string
+	prefix string
+	//
+	config_lock sync.Mutex
+	config      NamespaceConfig
+	//
+	items           int32
+	bytes           int64
+	hits            int64
+	misses          int64
+	sets            int64
+	deletes         int64
+	quota_evictions int64
+}
+
+// Namespace returns the namespace name, created with the limits of the cache on the first call.
+// name can not be empty or contain ":".
+func (cache *Cache) Namespace(name string) (*Namespace, error) {
+	if name == "" || strings.Contains(name, ":") {
+		return nil, errors.New("namespace name can not be empty or contain ':'")
+	}
+	if ns := cache.namespaceMap()[name]; ns != nil {
+		return ns, nil
+	}
+
+	cache.namespaces_lock.Lock()
+	defer cache.namespaces_lock.Unlock()
+	if cache.Closed() {
+		return nil, ErrClosed
+	}
+	namespaces := cache.namespaceMap()
+	if ns := namespaces[name]; ns != nil {
+		return ns, nil
+	}
+
+	ns := &Namespace{cache: cache, name: name, prefix: name + ":"}
+	copied := make(map[string]*Namespace, len(namespaces)+1)
+	for n, namespace := range namespaces {
+		copied[n] = namespace
+	}
+	copied[name] = ns
+	cache.namespaces.Store(copied)
+
+	//adopt the keys set before, a writer which missed the new map is done once the lock of its shard is taken
+	for _, shard := range cache.shards {
+		shard.lock.Lock()
+		shard.sync_map.Range(func(key, value interface{}) bool {
+			ele := value.(*cache_element)
+			if ele.ns == nil && strings.HasPrefix(key.(string), ns.prefix) {
+				shard.sync_map.Store(key, &cache_element{
+					Score:    ele.Score,
+					Value:    ele.Value,
+					Version:  ele.Version,
+					Sliding:  ele.Sliding,
+					Tags:     ele.Tags,
+					ns:       ns,
+					accessed: atomic.LoadInt64(&ele.accessed),
+				})
+				shard.indexNamespace(ns, key.(string), ele.Score)
+				atomic.AddInt32(&ns.items, 1)
+				atomic.AddInt64(&ns.bytes, int64(ele.Value.(CacheItem).CacheBytes()))
+			}
+			return true
+		})
+		shard.lock.Unlock()
+	}
+	return ns, nil
+}
+
+// Namespaces returns the namespaces created so far sorted by name
+func (cache *Cache) Namespaces() []*Namespace {
+	namespaces := make([]*Namespace, 0, len(cache.namespaceMap()))
+	for _, ns := range cache.namespaceMap() {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].name < namespaces[j].name })
+	return namespaces
+}
+
+// the namespaces by name, nil before the first one is created
+func (cache *Cache) namespaceMap() map[string]*Namespace {
+	namespaces, _ := cache.namespaces.Load().(map[string]*Namespace)
+	return namespaces
+}
+
+// the namespace owning key, nil if none
+func (cache *Cache) namespaceOf(key string) *Namespace {
+	namespaces := cache.namespaceMap()
+	if len(namespaces) == 0 {
+		return nil
+	}
+	i := strings.IndexByte(key, ':')
+	if i < 0 {
+		return nil
+	}
+	return namespaces[key[:i]]
+}
+
+func (ns *Namespace) Name() string {
+	return ns.name
+}
+
+// the key of the cache for key of the namespace
+func (ns *Namespace) Key(key string) string {
+	return ns.prefix + key
+}
+
+// SetConfig replaces the limits of the namespace, a lower quota is enforced by the next recycling,
+// a lower MaxTtlSecs by the next write or ttl change of each key
+func (ns *Namespace) SetConfig(config *NamespaceConfig) error {
+	if config.BytesQuota < 0 {
+		return errors.New("namespace config BytesQuota error: val >= 0")
+	}
+	if config.MaxTtlSecs < 0 || config.MaxTtlSecs > ns.cache.cache_config.MaxTtlSecs {
+		return errors.New("namespace config MaxTtlSecs error: val between [0,MaxTtlSecs of the cache]")
+	}
+	max_ttl := config.MaxTtlSecs
+	if max_ttl == 0 {
+		max_ttl = ns.cache.cache_config.MaxTtlSecs
+	}
+	if config.DefaultTtlSecs < 0 || config.DefaultTtlSecs > max_ttl {
+		return errors.New("namespace config DefaultTtlSecs error: val between [0,MaxTtlSecs]")
+	}
+
+	ns.config_lock.Lock()
+	ns.config = *config
+	ns.config_lock.Unlock()
+	return nil
+}
+
+// GetConfig returns the limits of the namespace, the ones of the cache are filled in for the zero fields
+func (ns *Namespace) GetConfig() *NamespaceConfig {
+	ns.config_lock.Lock()
+	config := ns.config
+	ns.config_lock.Unlock()
+
+	if config.MaxTtlSecs == 0 {
+		config.MaxTtlSecs = ns.cache.cache_config.MaxTtlSecs
+	}
+	if config.DefaultTtlSecs == 0 {
+		config.DefaultTtlSecs = ns.cache.cache_config.DefaultTtlSecs
+		if config.DefaultTtlSecs > config.MaxTtlSecs {
+			config.DefaultTtlSecs = config.MaxTtlSecs
+		}
+	}
+	return &config
+}
+
+func (ns *Namespace) Get(key string) (value CacheItem, ttl int64) {
+	value, ttl = ns.cache.Get(ns.prefix + key)
+	if value != nil {
+		atomic.AddInt64(&ns.hits, 1)
+	} else {
+		atomic.AddInt64(&ns.misses, 1)
+	}
+	return value, ttl
+}
+
+// Set sets key with the DefaultTtlSecs of the namespace
+func (ns *Namespace) Set(key string, value CacheItem) error {
+	return ns.cache.set_(ns.prefix+key, value, secsToMillis(ns.GetConfig().DefaultTtlSecs))
+}
+
+// SetTTL sets key with ttlSecond capped by the MaxTtlSecs of the namespace
+func (ns *Namespace) SetTTL(key string, value CacheItem, ttlSecond int64) error {
+	if ttlSecond <= 0 {
+		return errors.New("ttl <=0 err")
+	}
+	if max_ttl := ns.GetConfig().MaxTtlSecs; ttlSecond > max_ttl {
+		ttlSecond = max_ttl
+	}
+	return ns.cache.set_(ns.prefix+key, value, secsToMillis(ttlSecond))
+}
+
+func (ns *Namespace) Delete(key string) error {
+	key = ns.prefix + key
+	count, err := ns.cache.deleteInShard(ns.cache.shard(key), EvictDeleted, func() []string { return []string{key} })
+	atomic.AddInt64(&ns.deletes, int64(count))
+	return err
+}
+
+// Flush deletes every key of the namespace and returns how many were deleted.
+// The lock of each shard is taken once, a key set meanwhile in another shard may or may not be deleted.
+func (ns *Namespace) Flush() (int, error) {
+	deleted := 0
+	var aof_err error
+	for _, shard := range ns.cache.shards {
+		shard := shard
+		count, err := ns.cache.deleteInShard(shard, EvictDeleted, func() []string {
+			var keys []string
+			shard.sync_map.Range(func(key, value interface{}) bool {
+				if value.(*cache_element).ns == ns {
+					keys = append(keys, key.(string))
+				}
+				return true
+			})
+			return keys
+		})
+		deleted += count
+		atomic.AddInt64(&ns.deletes, int64(count))
+		if err == ErrClosed {
+			return deleted, err
+		}
+		if err != nil && aof_err == nil {
+			aof_err = err
+		}
+	}
+	return deleted, aof_err
+}
+
+func (ns *Namespace) Items() int32 {
+	return atomic.LoadInt32(&ns.items)
+}
+
+func (ns *Namespace) Bytes() int64 {
+	return atomic.LoadInt64(&ns.bytes)
+}
+
+// Stats returns a snapshot of the counters of the namespace
+func (ns *Namespace) Stats() *NamespaceStats {
+	return &NamespaceStats{
+		Items:          ns.Items(),
+		Bytes:          ns.Bytes(),
+		Hits:           atomic.LoadInt64(&ns.hits),
+		Misses:         atomic.LoadInt64(&ns.misses),
+		Sets:           atomic.LoadInt64(&ns.sets),
+		Deletes:        atomic.LoadInt64(&ns.deletes),
+		QuotaEvictions: atomic.LoadInt64(&ns.quota_evictions),
+	}
+}
+
+// ttl millis capped by the MaxTtlSecs of the namespace. ns may be nil
+func (ns *Namespace) capTtl(ttl int64) int64 {
+	if ns == nil {
+		return ttl
+	}
+	if max := secsToMillis(ns.GetConfig().MaxTtlSecs); ttl > max {
+		return max
+	}
+	return ttl
+}
+
+// count value stored in the namespace, with the shard lock held. ns may be nil
+func (ns *Namespace) added(value CacheItem) {
+	if ns == nil {
+		return
+	}
+	atomic.AddInt64(&ns.sets, 1)
+	atomic.AddInt32(&ns.items, 1)
+	atomic.AddInt64(&ns.bytes, int64(value.CacheBytes()))
+}
+
+// count ele removed or replaced, with the shard lock held. ns may be nil
+func (ns *Namespace) removed(ele *cache_element) {
+	if ns == nil {
+		return
+	}
+	atomic.AddInt32(&ns.items, -1)
+	atomic.AddInt64(&ns.bytes, -int64(ele.Value.(CacheItem).CacheBytes()))
+}
+
+// recycle the soonest expiring keys of every namespace over RecycleRatioThreshold of its quota,
+// whatever the EvictionPolicy, until it is under it again.
+// the keys are taken from the expire index of the namespace in every shard, so the other keys are never visited
+func (cache *Cache) recycleNamespaces() {
+	for _, ns := range cache.namespaceMap() {
+		quota := ns.GetConfig().BytesQuota
+		threshold := quota * int64(cache.cache_config.RecycleRatioThreshold) / 100
+		if quota == 0 {
+			continue
+		}
+
+		for ns.Bytes() >= threshold {
+			//the soonest expiring of the first keys of the namespace in every shard
+			var victim_shard *cache_shard
+			var victim *node
+			for _, shard := range cache.shards {
+				shard.lock.Lock()
+				if index := shard.ns_index[ns]; index != nil {
+					if first := index.getByRank(1); first != nil && (victim == nil || first.Score < victim.Score) {
+						victim_shard, victim = shard, first
+					}
+				}
+				shard.lock.Unlock()
+			}
+			if victim == nil {
+				break
+			}
+
+			key := victim.Member
+			count, err := cache.deleteInShard(victim_shard, EvictQuota, func() []string { return []string{key} })
+			if err != nil {
+				return
+			}
+			atomic.AddInt64(&ns.quota_evictions, int64(count))
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_Cache_Namespace(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	cache, err := New(&CacheConfig{Clock: clock, ShardCount: 4})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	jack := &Person{"Jack", 18, "London"}
+	// set before the namespace exists
+	cache.SetTTL("orders:early", jack, 60)
+	cache.SetTTL("ordersX", jack, 60)
+
+	for _, name := range []string{"", "a:b"} {
+		if _, err := cache.Namespace(name); err == nil {
+			t.Fatalf("Namespace '%s' expect error, but nil", name)
+		}
+	}
+	orders, err := cache.Namespace("orders")
+	if err != nil {
+		t.Fatalf("Namespace expect nil, but %v", err)
+	}
+	if again, _ := cache.Namespace("orders"); again != orders {
+		t.Fatalf("Namespace expect the same handle, but %p %p", orders, again)
+	}
+	users, _ := cache.Namespace("users")
+	if namespaces := cache.Namespaces(); len(namespaces) != 2 || namespaces[0] != orders || namespaces[1] != users {
+		t.Fatalf("Namespaces expect orders users, but %v", namespaces)
+	}
+
+	if err := orders.SetConfig(&NamespaceConfig{DefaultTtlSecs: 10, MaxTtlSecs: 100}); err != nil {
+		t.Fatalf("SetConfig expect nil, but %v", err)
+	}
+	if err := orders.SetConfig(&NamespaceConfig{MaxTtlSecs: 10000}); err == nil {
+		t.Fatalf("SetConfig over the MaxTtlSecs of the cache expect error, but nil")
+	}
+	if err := orders.SetConfig(&NamespaceConfig{DefaultTtlSecs: 200, MaxTtlSecs: 100}); err == nil {
+		t.Fatalf("SetConfig with DefaultTtlSecs over MaxTtlSecs expect error, but nil")
+	}
+
+	orders.Set("a", jack)
+	orders.SetTTL("b", jack, 1000)
+	users.Set("a", jack)
+	cache.SetTTL("orders:direct", jack, 60)
+
+	if v, ttl := orders.Get("a"); v != jack || ttl != 10 {
+		t.Fatalf("get 'a' expect %v with the default ttl 10, but %v %d", jack, v, ttl)
+	}
+	if v, ttl := cache.Get("orders:b"); v != jack || ttl != 100 {
+		t.Fatalf("get 'orders:b' expect %v capped to 100, but %v %d", jack, v, ttl)
+	}
+	if v, ttl := users.Get("a"); v != jack || ttl != 30 {
+		t.Fatalf("get users 'a' expect %v with the default ttl of the cache, but %v %d", jack, v, ttl)
+	}
+	orders.Get("missing")
+
+	stats := orders.Stats()
+	expect := NamespaceStats{Items: 4, Bytes: int64(4 * jack.CacheBytes()), Hits: 1, Misses: 1, Sets: 3}
+	if *stats != expect {
+		t.Fatalf("stats expect %+v, but %+v", expect, *stats)
+	}
+
+	orders.Delete("a")
+	if count, err := orders.Flush(); count != 3 || err != nil {
+		t.Fatalf("Flush expect 3 nil, but %d %v", count, err)
+	}
+	if orders.Items() != 0 || orders.Bytes() != 0 || orders.Stats().Deletes != 4 {
+		t.Fatalf("flushed namespace expect empty, but %+v", *orders.Stats())
+	}
+	if v, _ := users.Get("a"); v != jack {
+		t.Fatalf("get users 'a' expect %v, but %v", jack, v)
+	}
+	if v, _ := cache.Get("ordersX"); v != jack {
+		t.Fatalf("get 'ordersX' expect %v, but %v", jack, v)
+	}
+
+	//the MaxTtlSecs of the namespace applies to the writes of the cache as well
+	cache.SetTTL("orders:c", jack, 1000)
+	cache.MSet(map[string]CacheItem{"orders:d": jack, "ordersY": jack}, 1000)
+	cache.SetTTL("orders:e", jack, 5)
+	cache.Expire("orders:e", 1000)
+	cache.SetTTL("orders:f", jack, 5)
+	cache.Persist("orders:f")
+	for _, key := range []string{"orders:c", "orders:d", "orders:e", "orders:f"} {
+		if ttl, _ := cache.TTL(key); ttl != 100 {
+			t.Fatalf("ttl of '%s' expect capped to 100, but %d", key, ttl)
+		}
+	}
+	if ttl, _ := cache.TTL("ordersY"); ttl != 1000 {
+		t.Fatalf("ttl of 'ordersY' expect 1000, but %d", ttl)
+	}
+}
+
+func Test_Cache_NamespaceQuota(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	jack := &Person{"Jack", 18, "London"}
+	cache, err := New(&CacheConfig{
+		Clock:           clock,
+		ShardCount:      2,
+		CacheBytesLimit: int64(jack.CacheBytes()) * 100,
+	})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	orders, _ := cache.Namespace("orders")
+	users, _ := cache.Namespace("users")
+	orders.SetConfig(&NamespaceConfig{BytesQuota: int64(jack.CacheBytes()) * 10})
+
+	// 100 items reach the threshold of the cache, the users expire first
+	for i := 0; i < 70; i++ {
+		users.SetTTL(strconv.Itoa(i), jack, int64(10+i))
+	}
+	for i := 0; i < 30; i++ {
+		orders.SetTTL(strconv.Itoa(i), jack, int64(100+i))
+	}
+
+	clock.Advance(5 * time.Second)
+
+	// orders is recycled under 80% of its quota, which brings the cache under its threshold
+	if orders.Items() != 7 {
+		t.Fatalf("orders items expect 7, but %d", orders.Items())
+	}
+	if users.Items() != 70 {
+		t.Fatalf("users items expect 70, but %d", users.Items())
+	}
+	for i := 0; i < 30; i++ {
+		if v, _ := orders.Get(strconv.Itoa(i)); (v != nil) != (i >= 23) {
+			t.Fatalf("get orders '%d' expect the soonest expiring recycled, but %v", i, v)
+		}
+	}
+	if count := orders.Stats().QuotaEvictions; count != 23 {
+		t.Fatalf("orders quota evictions expect 23, but %d", count)
+	}
+	if count := cache.Stats().Evictions[EvictQuota]; count != 23 {
+		t.Fatalf("quota evictions expect 23, but %d", count)
+	}
+}
+
+func Test_Cache_NamespaceQuotaCost(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	jack := &Person{"Jack", 18, "London"}
+	cache, err := New(&CacheConfig{Clock: clock, ShardCount: 4})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	// the threshold of orders is 10000 items
+	orders, _ := cache.Namespace("orders")
+	orders.SetConfig(&NamespaceConfig{BytesQuota: int64(jack.CacheBytes()) * 10000 * 100 / 80})
+	for i := 0; i < 100000; i++ {
+		cache.SetTTL(strconv.Itoa(i), jack, 3600)
+	}
+	for i := 0; i < 9999; i++ {
+		orders.SetTTL(strconv.Itoa(i), jack, int64(3600+i))
+	}
+
+	// each pass recycles the one key over the threshold without going through the other keys
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 9999; i < 10099; i++ {
+		orders.SetTTL(strconv.Itoa(i), jack, int64(3600+i))
+		cache.recycleNamespaces()
+	}
+	runtime.ReadMemStats(&after)
+	if bytes := (after.TotalAlloc - before.TotalAlloc) / 100; bytes > 4096 {
+		t.Fatalf("bytes allocated by a set and a recycle pass expect <= 4096, but %d", bytes)
+	}
+
+	if orders.Items() != 9999 || orders.Stats().QuotaEvictions != 100 {
+		t.Fatalf("orders items and quota evictions expect 9999 100, but %d %d", orders.Items(), orders.Stats().QuotaEvictions)
+	}
+	for i := 0; i < 100; i++ {
+		if v, _ := orders.Get(strconv.Itoa(i)); v != nil {
+			t.Fatalf("get orders '%d' expect the soonest expiring recycled, but %v", i, v)
+		}
+	}
+	var indexed int32
+	for _, shard := range cache.shards {
+		if index := shard.ns_index[orders]; index != nil {
+			indexed += index.length
+		}
+	}
+	if indexed != orders.Items() {
+		t.Fatalf("indexed keys of orders expect %d, but %d", orders.Items(), indexed)
+	}
+}
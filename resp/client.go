@@ -0,0 +1,46 @@
+package resp
+
+import (
+	"net"
+	"time"
+)
+
+// a connection to a RESP2 server, not safe for concurrent use
+type Client struct {
+	conn   net.Conn
+	reader *Reader
+	writer *Writer
+}
+
+// connect to address on network, "tcp" or "unix"
+func Dial(network string, address string, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+func NewClient(conn net.Conn) *Client {
+	return &Client{conn: conn, reader: NewReader(conn), writer: NewWriter(conn)}
+}
+
+// send a command and read its reply, an error reply is returned as a ReplyError
+func (client *Client) Do(args ...string) (Value, error) {
+	client.writer.WriteCommand(args...)
+	if err := client.writer.Flush(); err != nil {
+		return Value{}, err
+	}
+	value, err := client.reader.ReadValue()
+	if err != nil {
+		return Value{}, err
+	}
+	if value.Kind == Error {
+		return value, ReplyError(value.Str)
+	}
+	return value, nil
+}
+
+func (client *Client) Close() error {
+	return client.conn.Close()
+}
@@ -0,0 +1,326 @@
+// Package resp speaks RESP2, the protocol of Redis, in front of a cache.
+//
+// A command is an array of bulk strings, or an inline command of words separated by spaces:
+//
+//	*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\n
+//	SET k v\r\n
+//
+// Replies are simple strings (+OK), errors (-ERR msg), integers (:1), bulk strings ($1\r\nv\r\n, $-1 for null)
+// and arrays (*2\r\n..., *-1 for null).
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// kinds of values, the first byte of their encoding
+const (
+	SimpleString byte = '+'
+	Error        byte = '-'
+	Integer      byte = ':'
+	BulkString   byte = '$'
+	Array        byte = '*'
+)
+
+// limits of a single value, a corrupted length must not cause a huge allocation
+const (
+	MaxBulkLength   = 512 << 20
+	MaxArrayLength  = 1 << 20
+	MaxInlineLength = 64 << 10
+)
+
+// an array grows as its elements are received, its length preallocates up to this many
+const array_prealloc = 64
+
+var ErrProtocol = errors.New("resp: protocol error")
+
+// a RESP2 value
+type Value struct {
+	Kind  byte    // one of the kinds
+	Str   []byte  // SimpleString, Error and BulkString
+	Int   int64   // Integer
+	Array []Value // Array
+	Null  bool    // null BulkString or Array
+}
+
+// ReplyError is an error reply of the server
+type ReplyError string
+
+func (e ReplyError) Error() string {
+	return string(e)
+}
+
+type Reader struct {
+	r *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, MaxInlineLength)}
+}
+
+// bytes read from the connection and not consumed yet, commands pipelined by the client
+func (reader *Reader) Buffered() int {
+	return reader.r.Buffered()
+}
+
+// read the next value
+func (reader *Reader) ReadValue() (Value, error) {
+	line, err := reader.readLine()
+	if err != nil {
+		return Value{}, err
+	}
+	if len(line) == 0 {
+		return Value{}, ErrProtocol
+	}
+
+	value := Value{Kind: line[0]}
+	switch line[0] {
+	case SimpleString, Error:
+		value.Str = append([]byte(nil), line[1:]...)
+	case Integer:
+		if value.Int, err = strconv.ParseInt(string(line[1:]), 10, 64); err != nil {
+			return Value{}, ErrProtocol
+		}
+	case BulkString:
+		length, err := parseLength(line[1:], MaxBulkLength)
+		if err != nil {
+			return Value{}, err
+		}
+		if length < 0 {
+			value.Null = true
+			break
+		}
+		if value.Str, err = reader.readBulk(length); err != nil {
+			return Value{}, err
+		}
+	case Array:
+		length, err := parseLength(line[1:], MaxArrayLength)
+		if err != nil {
+			return Value{}, err
+		}
+		if length < 0 {
+			value.Null = true
+			break
+		}
+		capacity := length
+		if capacity > array_prealloc {
+			capacity = array_prealloc
+		}
+		value.Array = make([]Value, 0, capacity)
+		for i := 0; i < length; i++ {
+			element, err := reader.ReadValue()
+			if err != nil {
+				return Value{}, err
+			}
+			value.Array = append(value.Array, element)
+		}
+	default:
+		return Value{}, ErrProtocol
+	}
+	return value, nil
+}
+
+// read the next command, an array of bulk strings or an inline command. an empty line is an empty command
+func (reader *Reader) ReadCommand() ([][]byte, error) {
+	first, err := reader.r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] != Array {
+		line, err := reader.readLine()
+		if err != nil {
+			return nil, err
+		}
+		return splitInline(line)
+	}
+
+	line, err := reader.readLine()
+	if err != nil {
+		return nil, err
+	}
+	length, err := parseLength(line[1:], MaxArrayLength)
+	if err != nil {
+		return nil, err
+	}
+	if length <= 0 {
+		return nil, nil
+	}
+	capacity := length
+	if capacity > array_prealloc {
+		capacity = array_prealloc
+	}
+	args := make([][]byte, 0, capacity)
+	for i := 0; i < length; i++ {
+		line, err := reader.readLine()
+		if err != nil {
+			return nil, unexpected(err, 1)
+		}
+		if len(line) == 0 || line[0] != BulkString {
+			return nil, ErrProtocol
+		}
+		arg_len, err := parseLength(line[1:], MaxBulkLength)
+		if err != nil || arg_len < 0 {
+			return nil, ErrProtocol
+		}
+		arg, err := reader.readBulk(arg_len)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// a line without its \r\n, only valid until the next read
+func (reader *Reader) readLine() ([]byte, error) {
+	line, err := reader.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, ErrProtocol
+	}
+	if err != nil {
+		return nil, unexpected(err, len(line))
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, ErrProtocol
+	}
+	return line[:len(line)-2], nil
+}
+
+// the bulk data and its \r\n, a large one grows as it is received rather than trusting its length
+func (reader *Reader) readBulk(length int) ([]byte, error) {
+	var data []byte
+	if length <= MaxInlineLength {
+		data = make([]byte, length+2)
+		if _, err := io.ReadFull(reader.r, data); err != nil {
+			return nil, unexpected(err, 1)
+		}
+	} else {
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, reader.r, int64(length+2)); err != nil {
+			return nil, unexpected(err, 1)
+		}
+		data = buf.Bytes()
+	}
+	if data[length] != '\r' || data[length+1] != '\n' {
+		return nil, ErrProtocol
+	}
+	return data[:length], nil
+}
+
+// -1 for null, larger lengths than max are a protocol error
+func parseLength(line []byte, max int) (int, error) {
+	length, err := strconv.Atoi(string(line))
+	if err != nil || length < -1 || length > max {
+		return 0, ErrProtocol
+	}
+	return length, nil
+}
+
+// the words of an inline command, which may be quoted with double or single quotes like redis-cli does
+func splitInline(line []byte) ([][]byte, error) {
+	var args [][]byte
+	for {
+		line = bytes.TrimLeft(line, " \t")
+		if len(line) == 0 {
+			return args, nil
+		}
+		var arg []byte
+		if quote := line[0]; quote == '"' || quote == '\'' {
+			end := bytes.IndexByte(line[1:], quote)
+			if end < 0 {
+				return nil, ErrProtocol
+			}
+			arg, line = line[1:1+end], line[2+end:]
+			if len(line) > 0 && line[0] != ' ' && line[0] != '\t' {
+				return nil, ErrProtocol
+			}
+		} else {
+			end := bytes.IndexAny(line, " \t")
+			if end < 0 {
+				end = len(line)
+			}
+			arg, line = line[:end], line[end:]
+		}
+		args = append(args, append([]byte(nil), arg...))
+	}
+}
+
+// EOF in the middle of a value is never a clean end
+func unexpected(err error, read int) error {
+	if err == io.EOF && read > 0 {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+type Writer struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w), buf: make([]byte, 0, 32)}
+}
+
+func (writer *Writer) WriteSimple(s string) {
+	writer.w.WriteByte(SimpleString)
+	writer.w.WriteString(s)
+	writer.w.WriteString("\r\n")
+}
+
+// msg starts with an error code like ERR or WRONGTYPE, it must not contain \r or \n
+func (writer *Writer) WriteError(msg string) {
+	writer.w.WriteByte(Error)
+	writer.w.WriteString(msg)
+	writer.w.WriteString("\r\n")
+}
+
+func (writer *Writer) WriteInt(n int64) {
+	writer.writeHeader(Integer, n)
+}
+
+func (writer *Writer) WriteBulk(b []byte) {
+	writer.writeHeader(BulkString, int64(len(b)))
+	writer.w.Write(b)
+	writer.w.WriteString("\r\n")
+}
+
+func (writer *Writer) WriteBulkString(s string) {
+	writer.writeHeader(BulkString, int64(len(s)))
+	writer.w.WriteString(s)
+	writer.w.WriteString("\r\n")
+}
+
+// the null bulk string
+func (writer *Writer) WriteNull() {
+	writer.w.WriteString("$-1\r\n")
+}
+
+// the header of an array of n values, which are written next
+func (writer *Writer) WriteArray(n int) {
+	writer.writeHeader(Array, int64(n))
+}
+
+// write a command as an array of bulk strings
+func (writer *Writer) WriteCommand(args ...string) {
+	writer.WriteArray(len(args))
+	for _, arg := range args {
+		writer.WriteBulkString(arg)
+	}
+}
+
+// write the buffered values, the first error of a previous write is returned
+func (writer *Writer) Flush() error {
+	return writer.w.Flush()
+}
+
+func (writer *Writer) writeHeader(kind byte, n int64) {
+	writer.buf = append(writer.buf[:0], kind)
+	writer.buf = strconv.AppendInt(writer.buf, n, 10)
+	writer.buf = append(writer.buf, '\r', '\n')
+	writer.w.Write(writer.buf)
+}
@@ -0,0 +1,101 @@
+package resp
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func Test_Resp_WriteRead(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewWriter(&buf)
+	writer.WriteSimple("OK")
+	writer.WriteError("ERR bad")
+	writer.WriteInt(-42)
+	writer.WriteBulk([]byte("a\r\nb"))
+	writer.WriteNull()
+	writer.WriteArray(2)
+	writer.WriteBulkString("")
+	writer.WriteInt(7)
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("Flush expect nil, but %v", err)
+	}
+
+	expect := "+OK\r\n-ERR bad\r\n:-42\r\n$4\r\na\r\nb\r\n$-1\r\n*2\r\n$0\r\n\r\n:7\r\n"
+	if buf.String() != expect {
+		t.Fatalf("encoding expect %q, but %q", expect, buf.String())
+	}
+
+	reader := NewReader(&buf)
+	checks := []func(v Value) bool{
+		func(v Value) bool { return v.Kind == SimpleString && string(v.Str) == "OK" },
+		func(v Value) bool { return v.Kind == Error && string(v.Str) == "ERR bad" },
+		func(v Value) bool { return v.Kind == Integer && v.Int == -42 },
+		func(v Value) bool { return v.Kind == BulkString && string(v.Str) == "a\r\nb" },
+		func(v Value) bool { return v.Kind == BulkString && v.Null },
+		func(v Value) bool {
+			return v.Kind == Array && len(v.Array) == 2 && len(v.Array[0].Str) == 0 && !v.Array[0].Null && v.Array[1].Int == 7
+		},
+	}
+	for i, check := range checks {
+		if v, err := reader.ReadValue(); err != nil || !check(v) {
+			t.Fatalf("value %d unexpected %+v %v", i, v, err)
+		}
+	}
+	if _, err := reader.ReadValue(); err != io.EOF {
+		t.Fatalf("ReadValue at the end expect io.EOF, but %v", err)
+	}
+}
+
+func Test_Resp_ReadCommand(t *testing.T) {
+	input := "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$5\r\nhello\r\n" +
+		"GET k\r\n" +
+		"SET \"a b\" 'c'  d\r\n" +
+		"\r\n"
+	reader := NewReader(strings.NewReader(input))
+	expects := [][]string{{"SET", "k", "hello"}, {"GET", "k"}, {"SET", "a b", "c", "d"}, nil}
+	for _, expect := range expects {
+		args, err := reader.ReadCommand()
+		if err != nil || len(args) != len(expect) {
+			t.Fatalf("ReadCommand expect %q, but %q %v", expect, args, err)
+		}
+		for i := range args {
+			if string(args[i]) != expect[i] {
+				t.Fatalf("ReadCommand expect %q, but %q", expect, args)
+			}
+		}
+	}
+	if _, err := reader.ReadCommand(); err != io.EOF {
+		t.Fatalf("ReadCommand at the end expect io.EOF, but %v", err)
+	}
+
+	for _, bad := range []string{
+		"*1\r\n:1\r\n",
+		"*1\r\n$3\r\nabcd\r\n",
+		"*x\r\n",
+		"*1\r\n$-1\r\n",
+		"GET \"k\r\n",
+		"GET k\n",
+		"*9999999999\r\n",
+	} {
+		if _, err := NewReader(strings.NewReader(bad)).ReadCommand(); err != ErrProtocol {
+			t.Fatalf("ReadCommand of %q expect ErrProtocol, but %v", bad, err)
+		}
+	}
+	if _, err := NewReader(strings.NewReader("*2\r\n$1\r\na\r\n")).ReadCommand(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("ReadCommand of a truncated command expect EOF, but %v", err)
+	}
+
+	//a large length with few elements allocates for the elements received only
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	before := stats.TotalAlloc
+	NewReader(strings.NewReader("*1048576\r\n$1\r\na\r\n")).ReadCommand()
+	NewReader(strings.NewReader("*1048576\r\n:1\r\n")).ReadValue()
+	runtime.ReadMemStats(&stats)
+	if allocated := stats.TotalAlloc - before; allocated > 1<<20 {
+		t.Fatalf("reading a truncated array of 1<<20 expect a small allocation, but %d bytes", allocated)
+	}
+}
@@ -0,0 +1,444 @@
+package resp
+
+import (
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/xlander-io/cache"
+	"github.com/xlander-io/cache/internal/netserver"
+)
+
+// ErrServerClosed is returned by Serve once Close is called
+var ErrServerClosed = netserver.ErrServerClosed
+
+// Server serves a cache of cache.Bytes items to RESP2 clients, one go-routine per connection
+type Server struct {
+	cache       *cache.Cache
+	default_ttl time.Duration //of SET without EX or PX
+	started     time.Time
+	net         netserver.Server
+	commands    int64 //commands processed
+}
+
+func NewServer(c *cache.Cache) *Server {
+	return &Server{
+		cache:       c,
+		default_ttl: time.Duration(c.GetConfig().DefaultTtlSecs) * time.Second,
+		started:     time.Now(),
+	}
+}
+
+// Serve accepts connections on l until l fails or Close is called, l is closed on return.
+// It can be called for several listeners, like a tcp and a unix one.
+func (server *Server) Serve(l net.Listener) error {
+	return server.net.Serve(l, server.serveConn)
+}
+
+// Close stops the listeners, closes the connections and waits for their go-routines. The cache is not closed.
+func (server *Server) Close() error {
+	return server.net.Close()
+}
+
+func (server *Server) serveConn(conn net.Conn) {
+	reader := NewReader(conn)
+	writer := NewWriter(conn)
+	for {
+		args, err := reader.ReadCommand()
+		if err != nil {
+			if err == ErrProtocol {
+				writer.WriteError("ERR Protocol error")
+				writer.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		atomic.AddInt64(&server.commands, 1)
+		quit := server.execute(writer, args)
+		//replies of pipelined commands are flushed together
+		if quit || reader.Buffered() == 0 {
+			if writer.Flush() != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+type command struct {
+	arity   int //number of args with the name, -n for at least n
+	handler func(server *Server, w *Writer, args [][]byte) (quit bool)
+}
+
+var commands = map[string]command{
+	"ping":     {-1, cmdPing},
+	"echo":     {2, cmdEcho},
+	"quit":     {1, cmdQuit},
+	"select":   {2, cmdSelect},
+	"command":  {-1, cmdCommand},
+	"get":      {2, cmdGet},
+	"set":      {-3, cmdSet},
+	"del":      {-2, cmdDel},
+	"exists":   {-2, cmdExists},
+	"expire":   {3, cmdExpire},
+	"pexpire":  {3, cmdExpire},
+	"ttl":      {2, cmdTTL},
+	"pttl":     {2, cmdTTL},
+	"persist":  {2, cmdPersist},
+	"scan":     {-2, cmdScan},
+	"dbsize":   {1, cmdDBSize},
+	"flushdb":  {-1, cmdFlush},
+	"flushall": {-1, cmdFlush},
+	"info":     {-1, cmdInfo},
+}
+
+// run the command of args and write its reply, quit is true once the connection is to be closed
+func (server *Server) execute(w *Writer, args [][]byte) (quit bool) {
+	name := strings.ToLower(string(args[0]))
+	cmd, exist := commands[name]
+	if !exist {
+		w.WriteError("ERR unknown command '" + sanitize(args[0]) + "'")
+		return false
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		w.WriteError("ERR wrong number of arguments for '" + name + "' command")
+		return false
+	}
+	return cmd.handler(server, w, args)
+}
+
+// reply errors are a single line
+func sanitize(b []byte) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(string(b))
+}
+
+func writeCacheError(w *Writer, err error) {
+	w.WriteError("ERR " + sanitize([]byte(err.Error())))
+}
+
+func cmdPing(server *Server, w *Writer, args [][]byte) bool {
+	switch len(args) {
+	case 1:
+		w.WriteSimple("PONG")
+	case 2:
+		w.WriteBulk(args[1])
+	default:
+		w.WriteError("ERR wrong number of arguments for 'ping' command")
+	}
+	return false
+}
+
+func cmdEcho(server *Server, w *Writer, args [][]byte) bool {
+	w.WriteBulk(args[1])
+	return false
+}
+
+func cmdQuit(server *Server, w *Writer, args [][]byte) bool {
+	w.WriteSimple("OK")
+	return true
+}
+
+// a single database
+func cmdSelect(server *Server, w *Writer, args [][]byte) bool {
+	if string(args[1]) != "0" {
+		w.WriteError("ERR DB index is out of range")
+		return false
+	}
+	w.WriteSimple("OK")
+	return false
+}
+
+// no command docs, clients like redis-cli do without them
+func cmdCommand(server *Server, w *Writer, args [][]byte) bool {
+	w.WriteArray(0)
+	return false
+}
+
+func cmdGet(server *Server, w *Writer, args [][]byte) bool {
+	value, _ := server.cache.Get(string(args[1]))
+	if value == nil {
+		w.WriteNull()
+		return false
+	}
+	b, ok := value.(cache.Bytes)
+	if !ok {
+		w.WriteError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return false
+	}
+	w.WriteBulk(b)
+	return false
+}
+
+// SET key value [EX seconds|PX milliseconds] [NX|XX], the default ttl of the cache without EX or PX
+func cmdSet(server *Server, w *Writer, args [][]byte) bool {
+	key, value := string(args[1]), cache.Bytes(args[2])
+	var ttl time.Duration
+	nx, xx := false, false
+	for i := 3; i < len(args); i++ {
+		switch option := strings.ToLower(string(args[i])); option {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "ex", "px":
+			if ttl != 0 || i+1 >= len(args) {
+				w.WriteError("ERR syntax error")
+				return false
+			}
+			i++
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				w.WriteError("ERR value is not an integer or out of range")
+				return false
+			}
+			if n <= 0 {
+				w.WriteError("ERR invalid expire time in 'set' command")
+				return false
+			}
+			ttl = toDuration(n, option == "ex")
+		default:
+			w.WriteError("ERR syntax error")
+			return false
+		}
+	}
+	if nx && xx {
+		w.WriteError("ERR syntax error")
+		return false
+	}
+	if ttl == 0 {
+		ttl = server.default_ttl
+	}
+
+	stored := true
+	var err error
+	switch {
+	case nx:
+		stored, err = server.cache.SetIfAbsentDuration(key, value, ttl)
+	case xx:
+		stored, err = server.cache.SetIfPresentDuration(key, value, ttl)
+	default:
+		err = server.cache.SetTTLDuration(key, value, ttl)
+	}
+	if err != nil {
+		writeCacheError(w, err)
+	} else if !stored {
+		w.WriteNull()
+	} else {
+		w.WriteSimple("OK")
+	}
+	return false
+}
+
+// n secs or millis, saturated way beyond any MaxTtlSecs
+func toDuration(n int64, secs bool) time.Duration {
+	unit := time.Millisecond
+	if secs {
+		unit = time.Second
+	}
+	if n > int64(math.MaxInt64/unit) {
+		return math.MaxInt64
+	}
+	return time.Duration(n) * unit
+}
+
+func cmdDel(server *Server, w *Writer, args [][]byte) bool {
+	keys := make([]string, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		keys = append(keys, string(arg))
+	}
+	deleted, err := server.cache.MDelete(keys)
+	if err != nil {
+		writeCacheError(w, err)
+		return false
+	}
+	w.WriteInt(int64(deleted))
+	return false
+}
+
+// a key given several times is counted as many times
+func cmdExists(server *Server, w *Writer, args [][]byte) bool {
+	count := int64(0)
+	for _, arg := range args[1:] {
+		if _, exists := server.cache.TTL(string(arg)); exists {
+			count++
+		}
+	}
+	w.WriteInt(count)
+	return false
+}
+
+// EXPIRE key seconds and PEXPIRE key milliseconds, a ttl <= 0 deletes the key
+func cmdExpire(server *Server, w *Writer, args [][]byte) bool {
+	n, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		w.WriteError("ERR value is not an integer or out of range")
+		return false
+	}
+	var ok bool
+	if n <= 0 {
+		ok, err = server.cache.Expire(string(args[1]), 0)
+	} else {
+		ok, err = server.cache.ExpireDuration(string(args[1]), toDuration(n, strings.EqualFold(string(args[0]), "expire")))
+	}
+	if err != nil {
+		writeCacheError(w, err)
+		return false
+	}
+	w.WriteInt(boolInt(ok))
+	return false
+}
+
+// TTL key in seconds and PTTL key in milliseconds, -2 if the key is missing. every key has a ttl, so never -1
+func cmdTTL(server *Server, w *Writer, args [][]byte) bool {
+	ttl, exists := server.cache.TTLDuration(string(args[1]))
+	switch {
+	case !exists:
+		w.WriteInt(-2)
+	case strings.EqualFold(string(args[0]), "ttl"):
+		w.WriteInt(int64((ttl + time.Second - 1) / time.Second))
+	default:
+		w.WriteInt(ttl.Milliseconds())
+	}
+	return false
+}
+
+// the ttl is set to the MaxTtlSecs of the cache, 1 if the key exists
+func cmdPersist(server *Server, w *Writer, args [][]byte) bool {
+	ok, err := server.cache.Persist(string(args[1]))
+	if err != nil {
+		writeCacheError(w, err)
+		return false
+	}
+	w.WriteInt(boolInt(ok))
+	return false
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count]
+func cmdScan(server *Server, w *Writer, args [][]byte) bool {
+	cursor, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		w.WriteError("ERR invalid cursor")
+		return false
+	}
+	match, count := "", 10
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			w.WriteError("ERR syntax error")
+			return false
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			match = string(args[i+1])
+			if match == "*" {
+				match = ""
+			}
+		case "count":
+			count, err = strconv.Atoi(string(args[i+1]))
+			if err != nil || count < 1 {
+				w.WriteError("ERR value is not an integer or out of range")
+				return false
+			}
+		default:
+			w.WriteError("ERR syntax error")
+			return false
+		}
+	}
+
+	keys, next := server.cache.Scan(cursor, match, count)
+	w.WriteArray(2)
+	w.WriteBulkString(strconv.FormatUint(next, 10))
+	w.WriteArray(len(keys))
+	for _, key := range keys {
+		w.WriteBulkString(key)
+	}
+	return false
+}
+
+// expired keys not recycled yet are counted, like the lazily expired keys of Redis
+func cmdDBSize(server *Server, w *Writer, args [][]byte) bool {
+	w.WriteInt(int64(server.cache.Items()))
+	return false
+}
+
+// FLUSHDB and FLUSHALL, the ASYNC and SYNC options are accepted and both flush before replying
+func cmdFlush(server *Server, w *Writer, args [][]byte) bool {
+	if len(args) > 2 || (len(args) == 2 && !strings.EqualFold(string(args[1]), "async") && !strings.EqualFold(string(args[1]), "sync")) {
+		w.WriteError("ERR syntax error")
+		return false
+	}
+	if _, err := server.cache.Flush(); err != nil {
+		writeCacheError(w, err)
+		return false
+	}
+	w.WriteSimple("OK")
+	return false
+}
+
+// INFO [section], the sections are server, clients, memory, stats and keyspace
+func cmdInfo(server *Server, w *Writer, args [][]byte) bool {
+	section := "all"
+	if len(args) > 2 {
+		w.WriteError("ERR syntax error")
+		return false
+	}
+	if len(args) == 2 {
+		section = strings.ToLower(string(args[1]))
+	}
+	if section == "default" || section == "everything" {
+		section = "all"
+	}
+
+	stats := server.cache.Stats()
+
+	var info strings.Builder
+	add := func(name string, lines ...string) {
+		if section != "all" && section != name {
+			return
+		}
+		if info.Len() > 0 {
+			info.WriteString("\r\n")
+		}
+		info.WriteString("# " + strings.ToUpper(name[:1]) + name[1:] + "\r\n")
+		for _, line := range lines {
+			info.WriteString(line + "\r\n")
+		}
+	}
+	itoa := func(n int64) string { return strconv.FormatInt(n, 10) }
+
+	add("server",
+		"server_name:xlander-io/cache",
+		"uptime_in_seconds:"+itoa(int64(time.Since(server.started)/time.Second)),
+	)
+	add("clients",
+		"connected_clients:"+strconv.Itoa(server.net.Conns()),
+	)
+	add("memory",
+		"used_memory:"+itoa(int64(stats.Bytes)),
+		"maxmemory:"+itoa(server.cache.GetConfig().CacheBytesLimit),
+	)
+	add("stats",
+		"total_connections_received:"+itoa(server.net.Connections()),
+		"total_commands_processed:"+itoa(atomic.LoadInt64(&server.commands)),
+		"keyspace_hits:"+itoa(stats.Hits),
+		"keyspace_misses:"+itoa(stats.Misses),
+		"expired_keys:"+itoa(stats.Evictions[cache.EvictExpired]),
+		"evicted_keys:"+itoa(stats.Evictions[cache.EvictCapacity]+stats.Evictions[cache.EvictQuota]),
+	)
+	add("keyspace",
+		"db0:keys="+itoa(int64(stats.Items))+",expires="+itoa(int64(stats.Items))+",avg_ttl=0",
+	)
+	w.WriteBulkString(info.String())
+	return false
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
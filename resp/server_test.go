@@ -0,0 +1,225 @@
+package resp
+
+import (
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xlander-io/cache"
+)
+
+// a server of a new cache on a loopback tcp listener, closed with the test
+func newTestServer(t *testing.T, clock cache.Clock) (*cache.Cache, *Server, net.Addr) {
+	c, err := cache.New(&cache.CacheConfig{Clock: clock, ShardCount: 4})
+	if err != nil {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen expect nil, but %v", err)
+	}
+	server := NewServer(c)
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(l) }()
+	t.Cleanup(func() {
+		server.Close()
+		if err := <-done; err != ErrServerClosed {
+			t.Errorf("Serve expect ErrServerClosed, but %v", err)
+		}
+		c.Close()
+	})
+	return c, server, l.Addr()
+}
+
+func dial(t *testing.T, network string, address string) *Client {
+	client, err := Dial(network, address, time.Second)
+	if err != nil {
+		t.Fatalf("Dial expect nil, but %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// send args and check the reply, encoded back as text: OK, (nil), an integer, a bulk string or [a b]
+func expectReply(t *testing.T, client *Client, expect string, args ...string) {
+	t.Helper()
+	value, err := client.Do(args...)
+	if _, ok := err.(ReplyError); err != nil && !ok {
+		t.Fatalf("%q expect %s, but %v", args, expect, err)
+	}
+	if got := replyText(value); got != expect {
+		t.Fatalf("%q expect %s, but %s", args, expect, got)
+	}
+}
+
+func replyText(value Value) string {
+	switch {
+	case value.Null:
+		return "(nil)"
+	case value.Kind == Integer:
+		return strconv.FormatInt(value.Int, 10)
+	case value.Kind == Array:
+		items := make([]string, len(value.Array))
+		for i := range value.Array {
+			items[i] = replyText(value.Array[i])
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	default:
+		return string(value.Str)
+	}
+}
+
+func Test_Server_Commands(t *testing.T) {
+	clock := cache.NewFakeClock(time.Unix(1700000000, 0))
+	c, _, addr := newTestServer(t, clock)
+	client := dial(t, "tcp", addr.String())
+
+	expectReply(t, client, "PONG", "PING")
+	expectReply(t, client, "hi", "ECHO", "hi")
+	expectReply(t, client, "OK", "SELECT", "0")
+	expectReply(t, client, "ERR DB index is out of range", "SELECT", "1")
+	expectReply(t, client, "ERR unknown command 'NOPE'", "NOPE")
+	expectReply(t, client, "ERR wrong number of arguments for 'get' command", "GET")
+
+	expectReply(t, client, "(nil)", "GET", "a")
+	expectReply(t, client, "OK", "SET", "a", "1")
+	expectReply(t, client, "1", "GET", "a")
+	expectReply(t, client, "30", "TTL", "a")
+	expectReply(t, client, "(nil)", "SET", "a", "2", "NX")
+	expectReply(t, client, "OK", "SET", "a", "2", "XX", "EX", "100")
+	expectReply(t, client, "100", "TTL", "a")
+	expectReply(t, client, "(nil)", "SET", "b", "2", "XX")
+	expectReply(t, client, "OK", "SET", "b", "3", "NX", "PX", "1500")
+	expectReply(t, client, "1500", "PTTL", "b")
+	expectReply(t, client, "2", "TTL", "b")
+	expectReply(t, client, "ERR syntax error", "SET", "b", "3", "NX", "XX")
+	expectReply(t, client, "ERR invalid expire time in 'set' command", "SET", "b", "3", "EX", "0")
+	expectReply(t, client, "ERR value is not an integer or out of range", "SET", "b", "3", "PX", "x")
+	expectReply(t, client, "ERR syntax error", "SET", "b", "3", "EX")
+
+	clock.Advance(1500 * time.Millisecond)
+	expectReply(t, client, "(nil)", "GET", "b")
+	expectReply(t, client, "-2", "TTL", "b")
+
+	expectReply(t, client, "1", "EXPIRE", "a", "10")
+	expectReply(t, client, "10", "TTL", "a")
+	expectReply(t, client, "1", "PEXPIRE", "a", "200")
+	expectReply(t, client, "200", "PTTL", "a")
+	expectReply(t, client, "1", "PERSIST", "a")
+	expectReply(t, client, "7200", "TTL", "a")
+	expectReply(t, client, "0", "EXPIRE", "missing", "10")
+	expectReply(t, client, "0", "PERSIST", "missing")
+
+	expectReply(t, client, "OK", "SET", "c", "3")
+	expectReply(t, client, "OK", "SET", "d", "4")
+	expectReply(t, client, "4", "EXISTS", "a", "c", "a", "d", "missing")
+	// 'b' has expired but is not recycled yet
+	expectReply(t, client, "4", "DBSIZE")
+	expectReply(t, client, "1", "EXPIRE", "c", "0")
+	expectReply(t, client, "(nil)", "GET", "c")
+	expectReply(t, client, "2", "DEL", "a", "a", "d", "missing")
+	clock.Advance(5 * time.Second)
+	expectReply(t, client, "0", "DBSIZE")
+
+	c.Set("person", &person{})
+	expectReply(t, client, "WRONGTYPE Operation against a key holding the wrong kind of value", "GET", "person")
+	expectReply(t, client, "OK", "FLUSHDB")
+	expectReply(t, client, "0", "DBSIZE")
+	expectReply(t, client, "OK", "QUIT")
+	if _, err := client.Do("PING"); err == nil {
+		t.Fatalf("PING after QUIT expect error, but nil")
+	}
+}
+
+type person struct{}
+
+func (p *person) CacheBytes() int { return 1 }
+
+func Test_Server_ScanAndInfo(t *testing.T) {
+	c, _, addr := newTestServer(t, nil)
+	client := dial(t, "tcp", addr.String())
+
+	for i := 0; i < 50; i++ {
+		c.Set("user:"+strconv.Itoa(i), cache.Bytes("x"))
+	}
+	c.Set("other", cache.Bytes("x"))
+
+	seen := map[string]bool{}
+	cursor := "0"
+	for {
+		value, err := client.Do("SCAN", cursor, "MATCH", "user:*", "COUNT", "7")
+		if err != nil || len(value.Array) != 2 {
+			t.Fatalf("SCAN expect a cursor and keys, but %v %v", replyText(value), err)
+		}
+		for _, key := range value.Array[1].Array {
+			if !strings.HasPrefix(string(key.Str), "user:") {
+				t.Fatalf("SCAN expect keys matching user:*, but %s", key.Str)
+			}
+			seen[string(key.Str)] = true
+		}
+		cursor = string(value.Array[0].Str)
+		if cursor == "0" {
+			break
+		}
+	}
+	if len(seen) != 50 {
+		t.Fatalf("SCAN expect 50 keys, but %d", len(seen))
+	}
+	expectReply(t, client, "ERR invalid cursor", "SCAN", "x")
+	expectReply(t, client, "ERR syntax error", "SCAN", "0", "MATCH")
+
+	c.Get("other")
+	value, err := client.Do("INFO")
+	info := string(value.Str)
+	if err != nil || !strings.Contains(info, "# Keyspace\r\ndb0:keys=51,") || !strings.Contains(info, "keyspace_hits:1\r\n") {
+		t.Fatalf("INFO expect the keyspace and stats, but %q %v", info, err)
+	}
+	value, _ = client.Do("INFO", "memory")
+	if info := string(value.Str); !strings.HasPrefix(info, "# Memory\r\nused_memory:51\r\n") || strings.Contains(info, "# Stats") {
+		t.Fatalf("INFO memory expect the memory section only, but %q", info)
+	}
+}
+
+func Test_Server_PipelineUnixInline(t *testing.T) {
+	c, err := cache.New(nil)
+	if err != nil {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer c.Close()
+	path := filepath.Join(t.TempDir(), "cache.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Listen expect nil, but %v", err)
+	}
+	server := NewServer(c)
+	go server.Serve(l)
+	defer server.Close()
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("Dial expect nil, but %v", err)
+	}
+	defer conn.Close()
+
+	// pipelined commands, inline ones included, are answered in order
+	writer := NewWriter(conn)
+	writer.WriteCommand("SET", "k", "v")
+	writer.WriteCommand("GET", "k")
+	writer.Flush()
+	conn.Write([]byte("GET k\r\nDEL k\r\n*1\r\n:1\r\n"))
+
+	reader := NewReader(conn)
+	for _, expect := range []string{"OK", "v", "v", "1", "ERR Protocol error"} {
+		value, err := reader.ReadValue()
+		if err != nil || replyText(value) != expect {
+			t.Fatalf("reply expect %s, but %s %v", expect, replyText(value), err)
+		}
+	}
+	// the connection is closed after a protocol error
+	if _, err := reader.ReadValue(); err == nil {
+		t.Fatalf("read after a protocol error expect error, but nil")
+	}
+}
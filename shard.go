@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"sync"
+)
+
+// a shard owns the keys hashed to it, with its own map, lock, skiplist and skiplist routine
+type cache_shard struct {
+	sync_map   sync.Map
+	skip_list  *skiplist
+	lock       sync.Mutex
+	sl_channel chan func()
+	//
+	element_count int32 //element number of this shard
+	element_bytes int64 //element bytes of this shard
+	stats         shard_stats
+	//tag index, guarded by lock
+	tags map[string]map[string]struct{} //tag => keys of this shard carrying it
+	//expire index of the keys of each namespace, guarded by lock
+	ns_index map[*Namespace]*skiplist
+	//keys sorted by hash for Scan, kept while a scan is going through the shard
+	scan_lock sync.Mutex
+	scan_keys []scan_entry
+}
+
+func makeShard(sl_buffer_size int) *cache_shard {
+	return &cache_shard{
+		skip_list:  makeSkiplist(),
+		sl_channel: make(chan func(), sl_buffer_size),
+	}
+}
+
+// add key to the keys of every tag, must be called with the shard lock held
+func (shard *cache_shard) tag(key string, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+	if shard.tags == nil {
+		shard.tags = make(map[string]map[string]struct{})
+	}
+	for _, tag := range tags {
+		keys, exist := shard.tags[tag]
+		if !exist {
+			keys = make(map[string]struct{})
+			shard.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+// remove key from the keys of every tag, a tag left without keys is dropped. must be called with the shard lock held
+func (shard *cache_shard) untag(key string, tags []string) {
+	for _, tag := range tags {
+		keys := shard.tags[tag]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(shard.tags, tag)
+		}
+	}
+}
+
+// add key of ns expiring at score to the expire index of ns, must be called with the shard lock held. ns may be nil
+func (shard *cache_shard) indexNamespace(ns *Namespace, key string, score int64) {
+	if ns == nil {
+		return
+	}
+	if shard.ns_index == nil {
+		shard.ns_index = make(map[*Namespace]*skiplist)
+	}
+	index, exist := shard.ns_index[ns]
+	if !exist {
+		index = makeSkiplist()
+		shard.ns_index[ns] = index
+	}
+	index.insert(key, score)
+}
+
+// remove key of ns from the expire index of ns, must be called with the shard lock held. ns may be nil
+func (shard *cache_shard) unindexNamespace(ns *Namespace, key string, score int64) {
+	if index := shard.ns_index[ns]; index != nil {
+		index.remove(key, score)
+		if index.length == 0 {
+			delete(shard.ns_index, ns)
+		}
+	}
+}
+
+// process the commands transfered from sl_channel for the skiplist until close_chan is closed
+func (shard *cache_shard) run(close_chan <-chan struct{}) {
+	for {
+		select {
+		case f := <-shard.sl_channel:
+			f()
+		case <-close_chan:
+			// no more commands can be sent once closed, drain the pending ones
+			for {
+				select {
+				case f := <-shard.sl_channel:
+					f()
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// an update of the skiplist for one key, the previous score is removed before the new one is inserted
+type sl_op struct {
+	key          string
+	remove       bool
+	remove_score int64
+	insert       bool
+	insert_score int64
+}
+
+func (op sl_op) apply(sl *skiplist) {
+	if op.remove {
+		sl.remove(op.key, op.remove_score)
+	}
+	if op.insert {
+		sl.insert(op.key, op.insert_score)
+	}
+}
+
+// append op to batch, or send it to the skiplist routine if batch is nil. must be called with the shard lock held
+func (shard *cache_shard) dispatch(op sl_op, batch *[]sl_op) {
+	if batch != nil {
+		*batch = append(*batch, op)
+		return
+	}
+	shard.sl_channel <- func() {
+		op.apply(shard.skip_list)
+	}
+}
+
+// send all the ops of batch to the skiplist routine as one command. must be called with the shard lock held
+func (shard *cache_shard) dispatchBatch(batch []sl_op) {
+	if len(batch) == 0 {
+		return
+	}
+	shard.sl_channel <- func() {
+		for i := range batch {
+			batch[i].apply(shard.skip_list)
+		}
+	}
+}
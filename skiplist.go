@@ -2,6 +2,7 @@ package cache
 
 import (
 	"math/rand"
+	"sync/atomic"
 )
 
 const (
@@ -24,7 +25,7 @@ type node struct {
 type skiplist struct {
 	header *node
 	tail   *node
-	length int32
+	length int32 // only changed by the skiplist routine or under the lock of the shard owning it, atomic so it can be read by others
 	level  int16
 }
 
@@ -120,7 +121,7 @@ func (skiplist *skiplist) insert(member string, score int64) {
 	} else {
 		skiplist.tail = node
 	}
-	skiplist.length++
+	atomic.AddInt32(&skiplist.length, 1)
 }
 
 /*
@@ -144,7 +145,7 @@ func (skiplist *skiplist) removeNode(node *node, update []*node) {
 	for skiplist.level > 1 && skiplist.header.level[skiplist.level-1].forward == nil {
 		skiplist.level--
 	}
-	skiplist.length--
+	atomic.AddInt32(&skiplist.length, -1)
 }
 
 /*
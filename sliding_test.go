@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"bytes"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_Cache_SetSliding(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	cache, err := New(&CacheConfig{Clock: clock, RecycleCheckIntervalSecs: 1})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	jack := &Person{"Jack", 18, "London"}
+	cache.SetSliding("session", jack, 10)
+	cache.SetTTL("fixed", jack, 10)
+
+	// read every 5s, the session stays alive long after its first ttl
+	for i := 0; i < 10; i++ {
+		clock.Advance(5 * time.Second)
+		if v, ttl := cache.Get("session"); v != jack || ttl != 10 {
+			t.Fatalf("get 'session' after %ds expect ttl 10, but %v %d", (i+1)*5, v, ttl)
+		}
+	}
+	if v, _ := cache.Get("fixed"); v != nil {
+		t.Fatalf("get 'fixed' expect expired, but %v", v)
+	}
+	if cache.Items() != 1 {
+		t.Fatalf("items expect only the session left, but %d", cache.Items())
+	}
+
+	// TTL is not an access
+	clock.Advance(5 * time.Second)
+	if ttl, _ := cache.TTL("session"); ttl != 5 {
+		t.Fatalf("TTL expect 5, but %d", ttl)
+	}
+	clock.Advance(6 * time.Second)
+	if v, _ := cache.Get("session"); v != nil {
+		t.Fatalf("get 'session' expect expired once not read, but %v", v)
+	}
+	if cache.Items() != 0 {
+		t.Fatalf("items expect 0 after recycling, but %d", cache.Items())
+	}
+
+	cache.Close()
+	if cache.shards[0].skip_list.length != 0 {
+		t.Fatalf("skiplist length expect 0 after drain, but %d", cache.shards[0].skip_list.length)
+	}
+}
+
+func Test_Cache_SlidingTTLConfig(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	cache, err := New(&CacheConfig{Clock: clock, SlidingTTL: true, RecycleCheckIntervalSecs: 1})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	jack := &Person{"Jack", 18, "London"}
+	cache.SetTTL("a", jack, 10)
+	clock.Advance(8 * time.Second)
+	cache.Get("a")
+
+	// Keep keeps the sliding ttl
+	cache.Keep("a", &Person{"Tom", 20, "Paris"})
+	clock.Advance(8 * time.Second)
+	if v, ttl := cache.Get("a"); v == nil || ttl != 10 {
+		t.Fatalf("get 'a' expect ttl 10, but %v %d", v, ttl)
+	}
+
+	// the recycler repositions the skiplist entry instead of removing the key
+	clock.Advance(8 * time.Second)
+	if cache.Items() != 1 {
+		t.Fatalf("items expect 1, but %d", cache.Items())
+	}
+	var score int64
+	cache.sl_sync(cache.shards[0], func() {
+		score = cache.shards[0].skip_list.header.level[0].forward.Score
+	})
+	if score != (1700000000+16+10)*1000 {
+		t.Fatalf("skiplist score expect %d, but %d", (1700000000+16+10)*1000, score)
+	}
+}
+
+func Test_Cache_SlidingGetAllocs(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	cache, _ := New(&CacheConfig{Clock: clock, SlidingTTL: true})
+	defer cache.Close()
+
+	cache.SetTTL("a", &Person{"Jack", 18, "London"}, 60)
+	allocs := testing.AllocsPerRun(1000, func() {
+		cache.Get("a")
+	})
+	if allocs != 0 {
+		t.Fatalf("sliding Get expect 0 allocs, but %v", allocs)
+	}
+}
+
+func Test_Cache_SlidingCapacity(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	jack := &Person{"Jack", 18, "London"}
+	cache, err := New(&CacheConfig{
+		Clock:           clock,
+		CacheBytesLimit: int64(jack.CacheBytes()) * 100,
+	})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	// positioned at 1000s, read at 600s it expires at 1600s
+	cache.SetSliding("hot", jack, 1000)
+	clock.Advance(600 * time.Second)
+	if v, _ := cache.Get("hot"); v == nil {
+		t.Fatalf("get 'hot' expect jack, but nil")
+	}
+
+	// over capacity with keys expiring at 1300s, sooner than the hot key
+	for i := 0; i < 100; i++ {
+		cache.SetTTL(strconv.Itoa(i), jack, 700)
+	}
+	clock.Advance(5 * time.Second)
+	if cache.Items() == 101 {
+		t.Fatalf("items expect some recycled, but 101")
+	}
+	if v, _ := cache.Get("hot"); v == nil {
+		t.Fatalf("get 'hot' expect to outlive the keys expiring sooner, but nil")
+	}
+}
+
+func Test_Cache_SlidingPersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+
+	cache := newAOFCache(t, clock, path, AOFFsyncEverySecond)
+	cache.SetSliding("session", &Person{"Jack", 18, "London"}, 100)
+	var buf bytes.Buffer
+	if err := cache.SaveSnapshot(&buf, cache.aof.codec); err != nil {
+		t.Fatalf("SaveSnapshot expect nil, but %v", err)
+	}
+	cache.Close()
+
+	// restarted 50s later, a Get pushes the expire time by the sliding ttl again
+	clock.Advance(50 * time.Second)
+	cache = newAOFCache(t, clock, path, AOFFsyncEverySecond)
+	defer cache.Close()
+	if ttl, _ := cache.TTL("session"); ttl != 50 {
+		t.Fatalf("TTL of 'session' after the replay expect 50, but %d", ttl)
+	}
+	if v, ttl := cache.Get("session"); v == nil || ttl != 100 {
+		t.Fatalf("get 'session' after the replay expect ttl 100, but %v %d", v, ttl)
+	}
+
+	restored, err := New(&CacheConfig{Clock: clock})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer restored.Close()
+	if _, err := restored.LoadSnapshot(&buf, cache.aof.codec); err != nil {
+		t.Fatalf("LoadSnapshot expect nil, but %v", err)
+	}
+	if v, ttl := restored.Get("session"); v == nil || ttl != 100 {
+		t.Fatalf("get 'session' after LoadSnapshot expect ttl 100, but %v %d", v, ttl)
+	}
+}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"errors"
+	"io"
+
+	"github.com/xlander-io/cache/snapshot"
+)
+
+// SaveSnapshot writes every live key with its value encoded by codec and its expire time.
+// Keys are read shard by shard without blocking the writers, so a key set or deleted meanwhile may or may not be saved.
+func (cache *Cache) SaveSnapshot(w io.Writer, codec Codec) error {
+	if cache.Closed() {
+		return ErrClosed
+	}
+
+	now := cache.now()
+	writer, err := snapshot.NewWriter(w, snapshot.Header{SavedAt: now, Codec: codec.Name()})
+	if err != nil {
+		return err
+	}
+
+	for _, shard := range cache.shards {
+		shard.sync_map.Range(func(key, value interface{}) bool {
+			ele := value.(*cache_element)
+			if ele.expire() <= now {
+				return true
+			}
+			var data []byte
+			data, err = codec.Encode(ele.Value.(CacheItem))
+			if err != nil {
+				return false
+			}
+			err = writer.Write(&snapshot.Record{Key: key.(string), Expire: ele.expire(), Sliding: ele.Sliding, Tags: ele.Tags, Value: data})
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// LoadSnapshot sets the keys saved by SaveSnapshot with their tags and remaining ttl, capped by MaxTtlSecs.
+// Keys expired by the time they are read are skipped, the number of keys set is returned.
+// Nothing is rolled back on error, the keys read before it stay in the cache.
+func (cache *Cache) LoadSnapshot(r io.Reader, codec Codec) (int, error) {
+	reader, err := snapshot.NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+	if reader.Header.Codec != codec.Name() {
+		return 0, errors.New("snapshot encoded by codec " + reader.Header.Codec + ", not " + codec.Name())
+	}
+
+	loaded := 0
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return loaded, nil
+		}
+		if err != nil {
+			return loaded, err
+		}
+
+		ttl := cache.capTtl(record.Expire - cache.now())
+		if ttl <= 0 {
+			continue
+		}
+
+		value, err := codec.Decode(record.Value)
+		if err != nil {
+			return loaded, err
+		}
+		if _, _, err := cache.setIf(record.Key, value, ttl, record.Sliding, record.Tags, false, nil); err != nil {
+			return loaded, err
+		}
+		loaded++
+	}
+}
@@ -0,0 +1,276 @@
+// Package snapshot reads and writes the snapshot file format of the cache.
+//
+// A snapshot is a header followed by records and a trailer:
+//
+//	header:  magic "XCSNAP2\n", varint saved_at (unix millis), uvarint codec name length, codec name
+//	record:  byte 1, uvarint key length, key, varint expire (unix millis), uvarint value length, value
+//	or byte 2 for a record with tags, with uvarint tag count, uvarint length and bytes of every tag before the value length
+//	or byte 3 for a sliding record, with uvarint sliding millis before the tags of a record with tags
+//	trailer: byte 0, uint32 big endian crc32 (IEEE) of all the records
+//
+// Values are kept as encoded by the codec of the cache, so a snapshot can be inspected without decoding them.
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+const magic = "XCSNAP2\n"
+
+const (
+	tag_end            byte = 0
+	tag_record         byte = 1
+	tag_record_tags    byte = 2
+	tag_record_sliding byte = 3
+)
+
+// limits of a single record, a corrupted length must not cause a huge allocation
+const (
+	MaxKeyLength   = 1 << 20
+	MaxValueLength = 1 << 30
+	MaxTags        = 1 << 16
+)
+
+// lengths up to this are allocated at once, a longer value grows as its bytes are read
+const read_prealloc = 64 << 10
+
+var (
+	ErrBadMagic = errors.New("snapshot: bad magic, not a snapshot file")
+	ErrChecksum = errors.New("snapshot: checksum mismatch")
+	ErrCorrupt  = errors.New("snapshot: corrupted record")
+)
+
+type Header struct {
+	SavedAt int64  // unix millis when the snapshot was taken
+	Codec   string // name of the codec encoding the values
+}
+
+type Record struct {
+	Key     string
+	Expire  int64    // unix millis
+	Sliding int64    // millis a Get pushes the expire time by, 0 for a fixed expire time
+	Tags    []string // tags of the key in the cache, nil if it has none
+	Value   []byte
+}
+
+type Writer struct {
+	w   *bufio.Writer
+	crc hash.Hash32
+	buf [binary.MaxVarintLen64]byte
+}
+
+// write the header to w, records are written by Write and the trailer by Close
+func NewWriter(w io.Writer, header Header) (*Writer, error) {
+	writer := &Writer{
+		w:   bufio.NewWriter(w),
+		crc: crc32.NewIEEE(),
+	}
+	writer.w.WriteString(magic)
+	writer.w.Write(binary.AppendVarint(writer.buf[:0], header.SavedAt))
+	writer.w.Write(binary.AppendUvarint(writer.buf[:0], uint64(len(header.Codec))))
+	if _, err := writer.w.WriteString(header.Codec); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (writer *Writer) Write(record *Record) error {
+	if len(record.Key) > MaxKeyLength || len(record.Value) > MaxValueLength || len(record.Tags) > MaxTags {
+		return errors.New("snapshot: record too large")
+	}
+	for _, tag := range record.Tags {
+		if len(tag) > MaxKeyLength {
+			return errors.New("snapshot: record too large")
+		}
+	}
+	out := io.MultiWriter(writer.w, writer.crc)
+	switch {
+	case record.Sliding > 0:
+		out.Write([]byte{tag_record_sliding})
+	case len(record.Tags) > 0:
+		out.Write([]byte{tag_record_tags})
+	default:
+		out.Write([]byte{tag_record})
+	}
+	out.Write(binary.AppendUvarint(writer.buf[:0], uint64(len(record.Key))))
+	io.WriteString(out, record.Key)
+	out.Write(binary.AppendVarint(writer.buf[:0], record.Expire))
+	if record.Sliding > 0 {
+		out.Write(binary.AppendUvarint(writer.buf[:0], uint64(record.Sliding)))
+	}
+	if record.Sliding > 0 || len(record.Tags) > 0 {
+		out.Write(binary.AppendUvarint(writer.buf[:0], uint64(len(record.Tags))))
+		for _, tag := range record.Tags {
+			out.Write(binary.AppendUvarint(writer.buf[:0], uint64(len(tag))))
+			io.WriteString(out, tag)
+		}
+	}
+	out.Write(binary.AppendUvarint(writer.buf[:0], uint64(len(record.Value))))
+	_, err := out.Write(record.Value)
+	return err
+}
+
+// write the trailer and flush, the underlying writer is not closed
+func (writer *Writer) Close() error {
+	writer.w.WriteByte(tag_end)
+	binary.BigEndian.PutUint32(writer.buf[:4], writer.crc.Sum32())
+	writer.w.Write(writer.buf[:4])
+	return writer.w.Flush()
+}
+
+type Reader struct {
+	Header Header
+	r      *bufio.Reader
+	crc    hash.Hash32
+}
+
+// read the header from r
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{
+		r:   bufio.NewReader(r),
+		crc: crc32.NewIEEE(),
+	}
+
+	head := make([]byte, len(magic))
+	if _, err := io.ReadFull(reader.r, head); err != nil || string(head) != magic {
+		return nil, ErrBadMagic
+	}
+
+	saved_at, err := binary.ReadVarint(reader.r)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	codec, err := reader.readBytes(reader.r, MaxKeyLength)
+	if err != nil {
+		return nil, err
+	}
+	reader.Header = Header{SavedAt: saved_at, Codec: string(codec)}
+	return reader, nil
+}
+
+// the next record, io.EOF once the trailer is read and the checksum verified
+func (reader *Reader) Next() (*Record, error) {
+	tag, err := reader.r.ReadByte()
+	if err != nil {
+		return nil, unexpected(err)
+	}
+
+	if tag == tag_end {
+		sum := make([]byte, 4)
+		if _, err := io.ReadFull(reader.r, sum); err != nil {
+			return nil, unexpected(err)
+		}
+		if binary.BigEndian.Uint32(sum) != reader.crc.Sum32() {
+			return nil, ErrChecksum
+		}
+		return nil, io.EOF
+	}
+	if tag != tag_record && tag != tag_record_tags && tag != tag_record_sliding {
+		return nil, ErrCorrupt
+	}
+
+	//everything read from now on is part of the checksum
+	reader.crc.Write([]byte{tag})
+	in := &crc_reader{r: reader.r, crc: reader.crc}
+
+	key, err := reader.readBytes(in, MaxKeyLength)
+	if err != nil {
+		return nil, err
+	}
+	expire, err := binary.ReadVarint(in)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	var sliding uint64
+	if tag == tag_record_sliding {
+		if sliding, err = binary.ReadUvarint(in); err != nil {
+			return nil, unexpected(err)
+		}
+		if sliding == 0 || sliding > math.MaxInt64 {
+			return nil, ErrCorrupt
+		}
+	}
+	var tags []string
+	if tag == tag_record_tags || tag == tag_record_sliding {
+		count, err := binary.ReadUvarint(in)
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		if count > MaxTags {
+			return nil, ErrCorrupt
+		}
+		if count > 0 {
+			tags = make([]string, count)
+		}
+		for i := range tags {
+			data, err := reader.readBytes(in, MaxKeyLength)
+			if err != nil {
+				return nil, err
+			}
+			tags[i] = string(data)
+		}
+	}
+	value, err := reader.readBytes(in, MaxValueLength)
+	if err != nil {
+		return nil, err
+	}
+	return &Record{Key: string(key), Expire: expire, Sliding: int64(sliding), Tags: tags, Value: value}, nil
+}
+
+// read a uvarint length followed by as many bytes, a large length is not trusted until its bytes are there
+func (reader *Reader) readBytes(in io.ByteReader, max uint64) ([]byte, error) {
+	length, err := binary.ReadUvarint(in)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	if length > max {
+		return nil, ErrCorrupt
+	}
+	if length <= read_prealloc {
+		data := make([]byte, length)
+		if _, err := io.ReadFull(in.(io.Reader), data); err != nil {
+			return nil, unexpected(err)
+		}
+		return data, nil
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, in.(io.Reader), int64(length)); err != nil {
+		return nil, unexpected(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// a truncated snapshot is never a clean end
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// feeds the checksum with what is read
+type crc_reader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+}
+
+func (cr *crc_reader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.crc.Write(p[:n])
+	return n, err
+}
+
+func (cr *crc_reader) ReadByte() (byte, error) {
+	b, err := cr.r.ReadByte()
+	if err == nil {
+		cr.crc.Write([]byte{b})
+	}
+	return b, err
+}
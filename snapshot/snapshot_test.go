@@ -0,0 +1,108 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func write(t *testing.T, records []Record) []byte {
+	var buf bytes.Buffer
+	writer, err := NewWriter(&buf, Header{SavedAt: 1700000000, Codec: "json"})
+	if err != nil {
+		t.Fatalf("NewWriter expect nil, but %v", err)
+	}
+	for i := range records {
+		if err := writer.Write(&records[i]); err != nil {
+			t.Fatalf("Write expect nil, but %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close expect nil, but %v", err)
+	}
+	return buf.Bytes()
+}
+
+func Test_Snapshot_RoundTrip(t *testing.T) {
+	records := []Record{
+		{Key: "a", Expire: 1700000010, Value: []byte(`{"Name":"Jack"}`)},
+		{Key: "", Expire: 1700000020, Value: []byte{}},
+		{Key: "c", Expire: 1700000030, Value: bytes.Repeat([]byte{7}, 1000)},
+		{Key: "big", Expire: 1700000035, Value: bytes.Repeat([]byte{8}, 200<<10)},
+		{Key: "d", Expire: 1700000040, Tags: []string{"user:1", ""}, Value: []byte(`{"Name":"Rose"}`)},
+		{Key: "e", Expire: 1700000050, Sliding: 60000, Value: []byte(`{"Name":"Ann"}`)},
+		{Key: "f", Expire: 1700000060, Sliding: 60000, Tags: []string{"user:2"}, Value: []byte(`{"Name":"Bob"}`)},
+	}
+	data := write(t, records)
+
+	reader, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader expect nil, but %v", err)
+	}
+	if reader.Header != (Header{SavedAt: 1700000000, Codec: "json"}) {
+		t.Fatalf("header expect 1700000000 json, but %v", reader.Header)
+	}
+	for _, expect := range records {
+		record, err := reader.Next()
+		if err != nil || record.Key != expect.Key || record.Expire != expect.Expire || record.Sliding != expect.Sliding || !bytes.Equal(record.Value, expect.Value) ||
+			strings.Join(record.Tags, ",") != strings.Join(expect.Tags, ",") || len(record.Tags) != len(expect.Tags) {
+			t.Fatalf("Next expect %v, but %v %v", expect, record, err)
+		}
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Fatalf("Next at the end expect io.EOF, but %v", err)
+	}
+}
+
+func Test_Snapshot_Corrupted(t *testing.T) {
+	data := write(t, []Record{{Key: "a", Expire: 1700000010, Value: []byte("value")}})
+
+	readAll := func(data []byte) error {
+		reader, err := NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		for {
+			if _, err := reader.Next(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := readAll(data); err != io.EOF {
+		t.Fatalf("read expect io.EOF, but %v", err)
+	}
+	if err := readAll(data[:len(data)-3]); err != io.ErrUnexpectedEOF {
+		t.Fatalf("truncated read expect io.ErrUnexpectedEOF, but %v", err)
+	}
+
+	flipped := append([]byte{}, data...)
+	flipped[len(flipped)-8] ^= 0xff //inside the value
+	if err := readAll(flipped); err != ErrChecksum {
+		t.Fatalf("corrupted read expect ErrChecksum, but %v", err)
+	}
+
+	//a value length near MaxValueLength with a few bytes only allocates for the bytes present
+	empty := write(t, nil)
+	huge := append([]byte{}, empty[:len(empty)-5]...)
+	huge = append(huge, tag_record, 1, 'a', 0)
+	huge = binary.AppendUvarint(huge, MaxValueLength-1)
+	huge = append(huge, "abc"...)
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	before := stats.TotalAlloc
+	if err := readAll(huge); err != io.ErrUnexpectedEOF {
+		t.Fatalf("read of a truncated huge value expect io.ErrUnexpectedEOF, but %v", err)
+	}
+	runtime.ReadMemStats(&stats)
+	if allocated := stats.TotalAlloc - before; allocated > 1<<20 {
+		t.Fatalf("read of a truncated huge value expect a small allocation, but %d bytes", allocated)
+	}
+
+	if _, err := NewReader(bytes.NewReader([]byte("not a snapshot"))); err != ErrBadMagic {
+		t.Fatalf("NewReader expect ErrBadMagic, but %v", err)
+	}
+}
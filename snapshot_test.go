@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func Test_Cache_Snapshot(t *testing.T) {
+	codecs := []Codec{
+		NewGobCodec(func() CacheItem { return &Person{} }),
+		NewJSONCodec(func() CacheItem { return &Person{} }),
+	}
+
+	for _, codec := range codecs {
+		clock := NewFakeClock(time.Unix(1700000000, 0))
+		cache, err := New(&CacheConfig{Clock: clock, ShardCount: 4})
+		if nil != err {
+			t.Fatalf("New cache instance failed! err=%v", err)
+		}
+		cache.SetTTL("a", &Person{"Jack", 18, "London"}, 10)
+		cache.SetTTL("b", &Person{"Tom", 20, "Paris"}, 100)
+		cache.SetTTL("c", &Person{"Bob", 30, "Rome"}, 1000)
+
+		var buf bytes.Buffer
+		if err := cache.SaveSnapshot(&buf, codec); err != nil {
+			t.Fatalf("%s SaveSnapshot expect nil, but %v", codec.Name(), err)
+		}
+		cache.Close()
+
+		// restarted 50s later, 'a' has expired meanwhile
+		clock.Advance(50 * time.Second)
+		restored, err := New(&CacheConfig{Clock: clock})
+		if nil != err {
+			t.Fatalf("New cache instance failed! err=%v", err)
+		}
+		loaded, err := restored.LoadSnapshot(bytes.NewReader(buf.Bytes()), codec)
+		if err != nil || loaded != 2 {
+			t.Fatalf("%s LoadSnapshot expect 2 nil, but %d %v", codec.Name(), loaded, err)
+		}
+		if v, _ := restored.Get("a"); v != nil {
+			t.Fatalf("%s expired 'a' expect to be skipped, but %v", codec.Name(), v)
+		}
+		if v, ttl := restored.Get("b"); v == nil || *v.(*Person) != (Person{"Tom", 20, "Paris"}) || ttl != 50 {
+			t.Fatalf("%s get 'b' expect Tom 50, but %v %d", codec.Name(), v, ttl)
+		}
+		if v, ttl := restored.Get("c"); v == nil || v.(*Person).Name != "Bob" || ttl != 950 {
+			t.Fatalf("%s get 'c' expect Bob 950, but %v %d", codec.Name(), v, ttl)
+		}
+		restored.Close()
+	}
+}
+
+func Test_Cache_SnapshotCodecMismatch(t *testing.T) {
+	cache, err := New(nil)
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+	cache.Set("a", &Person{"Jack", 18, "London"})
+
+	var buf bytes.Buffer
+	if err := cache.SaveSnapshot(&buf, NewGobCodec(func() CacheItem { return &Person{} })); err != nil {
+		t.Fatalf("SaveSnapshot expect nil, but %v", err)
+	}
+	if _, err := cache.LoadSnapshot(&buf, NewJSONCodec(func() CacheItem { return &Person{} })); err == nil {
+		t.Fatalf("LoadSnapshot with another codec expect error, but nil")
+	}
+}
+
+func Test_Cache_SnapshotBytes(t *testing.T) {
+	cache, _ := New(nil)
+	defer cache.Close()
+	cache.SetTTL("a", Bytes("hello"), 100)
+	cache.SetTTL("b", &Person{"Jack", 18, "London"}, 100)
+
+	codec := NewBytesCodec()
+	var buf bytes.Buffer
+	if err := cache.SaveSnapshot(&buf, codec); err == nil {
+		t.Fatalf("SaveSnapshot of a value which is not Bytes expect error, but nil")
+	}
+	cache.Delete("b")
+	buf.Reset()
+	if err := cache.SaveSnapshot(&buf, codec); err != nil {
+		t.Fatalf("SaveSnapshot expect nil, but %v", err)
+	}
+
+	restored, _ := New(nil)
+	defer restored.Close()
+	if loaded, err := restored.LoadSnapshot(&buf, codec); loaded != 1 || err != nil {
+		t.Fatalf("LoadSnapshot expect 1 nil, but %d %v", loaded, err)
+	}
+	if v, _ := restored.Get("a"); v == nil || string(v.(Bytes)) != "hello" {
+		t.Fatalf("get 'a' expect hello, but %v", v)
+	}
+}
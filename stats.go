@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// CacheStats is a snapshot of the counters of a cache, all counters start from New
+type CacheStats struct {
+	Items                int32                 // current items
+	Bytes                int32                 // current bytes
+	Hits                 int64                 // Get found a live item
+	Misses               int64                 // Get found nothing, ExpiredOnRead included
+	ExpiredOnRead        int64                 // Get found an expired item not recycled yet
+	Sets                 int64                 // items stored by any write
+	Deletes              int64                 // items removed by Delete
+	Evictions            map[EvictReason]int64 // items which left the cache by reason, EvictDeleted included
+	LoadSuccesses        int64                 // loader calls of GetOrLoad returning a value
+	LoadFailures         int64                 // loader calls of GetOrLoad returning an error
+	SkipListLength       int64                 // items in the skiplists, lags behind Items by SkipListQueue
+	SkipListQueue        int                   // skiplist commands waiting in the chan buffers
+	RecycleRuns          int64                 // recycler runs
+	RecycleLastDuration  time.Duration         // duration of the last recycler run
+	RecycleMaxDuration   time.Duration         // longest recycler run
+	RecycleTotalDuration time.Duration         // total duration of all the recycler runs
+}
+
+// counters updated by Get and the writes of a shard, kept per shard to avoid contention
+type shard_stats struct {
+	hits            int64
+	misses          int64
+	expired_on_read int64
+	sets            int64
+	deletes         int64
+}
+
+// counters of the whole cache, updated out of the Get path
+type cache_stats struct {
+	evictions              [EvictQuota + 1]int64 //indexed by EvictReason
+	load_successes         int64
+	load_failures          int64
+	recycle_runs           int64
+	recycle_last_duration  int64
+	recycle_max_duration   int64
+	recycle_total_duration int64
+}
+
+// Stats returns a snapshot of the counters of the cache, counters are read one by one without stopping the cache
+func (cache *Cache) Stats() *CacheStats {
+	stats := &CacheStats{
+		Items:                cache.Items(),
+		Bytes:                cache.Bytes(),
+		Evictions:            make(map[EvictReason]int64, len(cache.stats.evictions)-1),
+		LoadSuccesses:        atomic.LoadInt64(&cache.stats.load_successes),
+		LoadFailures:         atomic.LoadInt64(&cache.stats.load_failures),
+		RecycleRuns:          atomic.LoadInt64(&cache.stats.recycle_runs),
+		RecycleLastDuration:  time.Duration(atomic.LoadInt64(&cache.stats.recycle_last_duration)),
+		RecycleMaxDuration:   time.Duration(atomic.LoadInt64(&cache.stats.recycle_max_duration)),
+		RecycleTotalDuration: time.Duration(atomic.LoadInt64(&cache.stats.recycle_total_duration)),
+	}
+
+	for reason := EvictExpired; reason <= EvictQuota; reason++ {
+		stats.Evictions[reason] = atomic.LoadInt64(&cache.stats.evictions[reason])
+	}
+
+	for _, shard := range cache.shards {
+		stats.Hits += atomic.LoadInt64(&shard.stats.hits)
+		stats.Misses += atomic.LoadInt64(&shard.stats.misses)
+		stats.ExpiredOnRead += atomic.LoadInt64(&shard.stats.expired_on_read)
+		stats.Sets += atomic.LoadInt64(&shard.stats.sets)
+		stats.Deletes += atomic.LoadInt64(&shard.stats.deletes)
+		stats.SkipListLength += int64(atomic.LoadInt32(&shard.skip_list.length))
+		stats.SkipListQueue += len(shard.sl_channel)
+	}
+
+	return stats
+}
+
+// record the duration of a recycler run
+func (stats *cache_stats) recycled(duration time.Duration) {
+	atomic.AddInt64(&stats.recycle_runs, 1)
+	atomic.StoreInt64(&stats.recycle_last_duration, int64(duration))
+	atomic.AddInt64(&stats.recycle_total_duration, int64(duration))
+	for {
+		max := atomic.LoadInt64(&stats.recycle_max_duration)
+		if int64(duration) <= max || atomic.CompareAndSwapInt64(&stats.recycle_max_duration, max, int64(duration)) {
+			return
+		}
+	}
+}
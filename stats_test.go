@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_Cache_Stats(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	cache, err := New(&CacheConfig{Clock: clock, ShardCount: 4})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+
+	jack := &Person{"Jack", 18, "London"}
+	rose := &Person{"Rose", 17, "Paris"}
+
+	cache.SetTTL("a", jack, 3)
+	cache.SetTTL("b", jack, 60)
+	cache.SetTTL("b", rose, 60)
+	cache.SetTTL("c", jack, 60)
+	cache.Delete("c")
+	cache.Delete("c")
+
+	cache.Get("a")
+	cache.Get("b")
+	cache.Get("c")
+
+	clock.Advance(3 * time.Second)
+	cache.Get("a") // expired, not recycled yet
+
+	cache.GetOrLoad(context.Background(), "d", func(ctx context.Context) (CacheItem, int64, error) {
+		return jack, 60, nil
+	})
+	cache.GetOrLoad(context.Background(), "e", func(ctx context.Context) (CacheItem, int64, error) {
+		return nil, 0, errors.New("not found")
+	})
+
+	clock.Advance(2 * time.Second) // recycle 'a'
+
+	// drain the skiplist commands
+	cache.Close()
+	stats := cache.Stats()
+	expect := CacheStats{
+		Items:          2,
+		Bytes:          int32(2 * jack.CacheBytes()),
+		Hits:           2,
+		Misses:         4,
+		ExpiredOnRead:  1,
+		Sets:           5,
+		Deletes:        1,
+		LoadSuccesses:  1,
+		LoadFailures:   1,
+		SkipListLength: 2,
+		RecycleRuns:    1,
+	}
+	if stats.Items != expect.Items || stats.Bytes != expect.Bytes || stats.Hits != expect.Hits || stats.Misses != expect.Misses ||
+		stats.ExpiredOnRead != expect.ExpiredOnRead || stats.Sets != expect.Sets || stats.Deletes != expect.Deletes ||
+		stats.LoadSuccesses != expect.LoadSuccesses || stats.LoadFailures != expect.LoadFailures ||
+		stats.SkipListLength != expect.SkipListLength || stats.RecycleRuns != expect.RecycleRuns {
+		t.Fatalf("stats expect %+v, but %+v", expect, *stats)
+	}
+
+	evictions := map[EvictReason]int64{EvictExpired: 1, EvictCapacity: 0, EvictDeleted: 1, EvictReplaced: 1}
+	for reason, count := range evictions {
+		if stats.Evictions[reason] != count {
+			t.Fatalf("evictions of %v expect %d, but %d", reason, count, stats.Evictions[reason])
+		}
+	}
+	if stats.RecycleTotalDuration < stats.RecycleMaxDuration || stats.RecycleMaxDuration < stats.RecycleLastDuration {
+		t.Fatalf("recycle durations inconsistent %+v", *stats)
+	}
+}
+
+func Test_Cache_StatsGetAllocs(t *testing.T) {
+	cache, _ := New(nil)
+	defer cache.Close()
+
+	cache.SetTTL("a", &Person{"Jack", 18, "London"}, 60)
+	allocs := testing.AllocsPerRun(1000, func() {
+		cache.Get("a")
+		cache.Get("b")
+	})
+	if allocs != 0 {
+		t.Fatalf("Get expect 0 allocs, but %v", allocs)
+	}
+}
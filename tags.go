@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"errors"
+)
+
+// SetWithTags is like SetTTL, and adds key to the keys of every tag so that InvalidateTag(tag) deletes it.
+// Setting key again replaces its tags and a plain set like Set or SetTTL clears them. Writes replacing the value
+// of a live key keep them: Keep, SetIfPresent, CompareAndSwap, CompareVersionAndSwap, Update and MSet,
+// as well as Expire, Touch and Persist. key leaves its tags once deleted, expired or recycled.
+func (cache *Cache) SetWithTags(key string, value CacheItem, ttlSecond int64, tags ...string) error {
+	if ttlSecond <= 0 {
+		return errors.New("ttl <=0 err")
+	}
+	//deduplicated into a new slice, the one of the caller may change
+	key_tags := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag == "" {
+			return errors.New("tag can not be empty")
+		}
+		duplicated := false
+		for _, t := range key_tags {
+			if t == tag {
+				duplicated = true
+				break
+			}
+		}
+		if !duplicated {
+			key_tags = append(key_tags, tag)
+		}
+	}
+	if len(key_tags) == 0 {
+		key_tags = nil
+	}
+	_, _, err := cache.setIf(key, value, secsToMillis(ttlSecond), 0, key_tags, false, nil)
+	return err
+}
+
+// InvalidateTag deletes every key carrying tag and returns how many were deleted.
+// The lock of each shard is taken once and its skiplist gets one command for the whole batch,
+// a key tagged in another shard meanwhile may or may not be deleted.
+func (cache *Cache) InvalidateTag(tag string) (int, error) {
+	deleted := 0
+	var aof_err error
+	for _, shard := range cache.shards {
+		shard := shard
+		//copied, remove untags the keys
+		count, err := cache.deleteInShard(shard, EvictDeleted, func() []string { return tagKeys(shard.tags[tag]) })
+		deleted += count
+		if err == ErrClosed {
+			return deleted, err
+		}
+		if err != nil && aof_err == nil {
+			aof_err = err
+		}
+	}
+	return deleted, aof_err
+}
+
+func tagKeys(keys map[string]struct{}) []string {
+	list := make([]string, 0, len(keys))
+	for key := range keys {
+		list = append(list, key)
+	}
+	return list
+}
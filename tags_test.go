@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"bytes"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// number of keys carrying tag in the tag index of all the shards
+func taggedKeys(cache *Cache, tag string) int {
+	count := 0
+	for _, shard := range cache.shards {
+		shard.lock.Lock()
+		count += len(shard.tags[tag])
+		shard.lock.Unlock()
+	}
+	return count
+}
+
+func Test_Cache_InvalidateTag(t *testing.T) {
+	deleted := map[string]EvictReason{}
+	cache, err := New(&CacheConfig{ShardCount: 4, OnEvict: func(key string, value CacheItem, reason EvictReason) {
+		deleted[key] = reason
+	}})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	jack := &Person{"Jack", 18, "London"}
+	for i := 0; i < 10; i++ {
+		if err := cache.SetWithTags("view:"+strconv.Itoa(i), jack, 60, "user:1", "all", "user:1"); err != nil {
+			t.Fatalf("SetWithTags expect nil, but %v", err)
+		}
+	}
+	cache.SetWithTags("view:10", jack, 60, "user:2", "all")
+	cache.SetTTL("other", jack, 60)
+
+	if err := cache.SetWithTags("bad", jack, 60, ""); err == nil {
+		t.Fatalf("SetWithTags with an empty tag expect error, but nil")
+	}
+	if err := cache.SetWithTags("bad", jack, 0, "user:1"); err == nil {
+		t.Fatalf("SetWithTags with ttl 0 expect error, but nil")
+	}
+
+	if count, err := cache.InvalidateTag("user:1"); count != 10 || err != nil {
+		t.Fatalf("InvalidateTag expect 10 nil, but %d %v", count, err)
+	}
+	for i := 0; i < 10; i++ {
+		key := "view:" + strconv.Itoa(i)
+		if v, _ := cache.Get(key); v != nil {
+			t.Fatalf("get '%s' expect nil, but %v", key, v)
+		}
+		if deleted[key] != EvictDeleted {
+			t.Fatalf("'%s' expect to be evicted as deleted, but %v", key, deleted[key])
+		}
+	}
+	if v, _ := cache.Get("view:10"); v != jack {
+		t.Fatalf("get 'view:10' expect %v, but %v", jack, v)
+	}
+	if v, _ := cache.Get("other"); v != jack {
+		t.Fatalf("get 'other' expect %v, but %v", jack, v)
+	}
+
+	// the deleted keys left their other tags as well
+	if count := taggedKeys(cache, "all"); count != 1 {
+		t.Fatalf("keys tagged 'all' expect 1, but %d", count)
+	}
+	if count, _ := cache.InvalidateTag("user:1"); count != 0 {
+		t.Fatalf("InvalidateTag again expect 0, but %d", count)
+	}
+	if count, _ := cache.InvalidateTag("missing"); count != 0 {
+		t.Fatalf("InvalidateTag of a missing tag expect 0, but %d", count)
+	}
+	checkTagIndex(t, cache)
+}
+
+func Test_Cache_TagIndex(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	jack := &Person{"Jack", 18, "London"}
+	cache, err := New(&CacheConfig{
+		Clock:           clock,
+		ShardCount:      2,
+		CacheBytesLimit: int64(jack.CacheBytes()) * 100,
+	})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	// deleted
+	cache.SetWithTags("a", jack, 60, "t")
+	cache.Delete("a")
+	// set again without tags
+	cache.SetWithTags("b", jack, 60, "t")
+	cache.SetTTL("b", jack, 60)
+	// expired
+	cache.SetWithTags("c", jack, 3, "t")
+	// kept with a new ttl
+	cache.SetWithTags("d", jack, 3, "t")
+	cache.Expire("d", 1000)
+	if count := taggedKeys(cache, "t"); count != 2 {
+		t.Fatalf("keys tagged 't' expect 2, but %d", count)
+	}
+
+	clock.Advance(5 * time.Second)
+	if count := taggedKeys(cache, "t"); count != 1 {
+		t.Fatalf("keys tagged 't' after recycling expect 1, but %d", count)
+	}
+
+	// over capacity, the soonest expiring keys are recycled first
+	for i := 0; i < 100; i++ {
+		cache.SetWithTags(strconv.Itoa(i), jack, int64(10+i), "capacity")
+	}
+	clock.Advance(5 * time.Second)
+	if count := taggedKeys(cache, "capacity"); count == 0 || count == 100 {
+		t.Fatalf("keys tagged 'capacity' expect some recycled, but %d left", count)
+	}
+	checkTagIndex(t, cache)
+}
+
+func Test_Cache_TagsKept(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	cache := newAOFCache(t, clock, path, AOFFsyncEverySecond)
+	jack := &Person{"Jack", 18, "London"}
+	tom := &Person{"Tom", 20, "Paris"}
+
+	keys := []string{"keep", "present", "cas", "version", "update", "mset"}
+	for _, key := range keys {
+		cache.SetWithTags(key, jack, 60, "t")
+	}
+	cache.Keep("keep", tom)
+	cache.SetIfPresent("present", tom, 100)
+	cache.CompareAndSwap("cas", jack, tom, 0)
+	_, _, version := cache.GetWithVersion("version")
+	cache.CompareVersionAndSwap("version", version, tom, 0)
+	cache.Update("update", func(old CacheItem, exists bool) (CacheItem, int64, UpdateAction) {
+		return tom, 100, UpdateReplace
+	})
+	cache.MSet(map[string]CacheItem{"mset": tom, "new": tom}, 100)
+	// a plain set clears them
+	cache.SetWithTags("plain", jack, 60, "t")
+	cache.SetTTL("plain", tom, 60)
+
+	for _, key := range keys {
+		if v, _ := cache.Get(key); v != tom {
+			t.Fatalf("get '%s' expect %v, but %v", key, tom, v)
+		}
+	}
+	if count := taggedKeys(cache, "t"); count != len(keys) {
+		t.Fatalf("keys tagged 't' expect %d, but %d", len(keys), count)
+	}
+	checkTagIndex(t, cache)
+	cache.Close()
+
+	// and logged with them
+	replayed := newAOFCache(t, clock, path, AOFFsyncEverySecond)
+	defer replayed.Close()
+	if count, _ := replayed.InvalidateTag("t"); count != len(keys) {
+		t.Fatalf("replayed InvalidateTag 't' expect %d, but %d", len(keys), count)
+	}
+	if v, _ := replayed.Get("plain"); v == nil {
+		t.Fatalf("replayed get 'plain' expect Tom, but nil")
+	}
+}
+
+// every key of the tag index exists with the tag, and every tag of a key is in the index
+func checkTagIndex(t *testing.T, cache *Cache) {
+	for _, shard := range cache.shards {
+		shard.lock.Lock()
+		for tag, keys := range shard.tags {
+			for key := range keys {
+				ele_, exist := shard.sync_map.Load(key)
+				if !exist {
+					t.Fatalf("'%s' of tag '%s' expect to exist, but missing", key, tag)
+				}
+				found := false
+				for _, ele_tag := range ele_.(*cache_element).Tags {
+					found = found || ele_tag == tag
+				}
+				if !found {
+					t.Fatalf("'%s' expect to carry tag '%s', but %v", key, tag, ele_.(*cache_element).Tags)
+				}
+			}
+		}
+		shard.sync_map.Range(func(key, value interface{}) bool {
+			for _, tag := range value.(*cache_element).Tags {
+				if _, exist := shard.tags[tag][key.(string)]; !exist {
+					t.Fatalf("'%s' expect to be in the index of tag '%s', but missing", key, tag)
+				}
+			}
+			return true
+		})
+		shard.lock.Unlock()
+	}
+}
+
+func Test_Cache_TagsPersistence(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	cache := newAOFCache(t, clock, path, AOFFsyncEverySecond)
+	cache.SetWithTags("a", &Person{"Jack", 18, "London"}, 60, "user:1", "all")
+	cache.SetWithTags("b", &Person{"Tom", 20, "Paris"}, 60, "all")
+	cache.SetTTL("c", &Person{"Bob", 30, "Rome"}, 60)
+
+	codec := NewJSONCodec(func() CacheItem { return &Person{} })
+	var buf bytes.Buffer
+	if err := cache.SaveSnapshot(&buf, codec); err != nil {
+		t.Fatalf("SaveSnapshot expect nil, but %v", err)
+	}
+	cache.Close()
+
+	replayed := newAOFCache(t, clock, path, AOFFsyncEverySecond)
+	defer replayed.Close()
+	restored, _ := New(&CacheConfig{Clock: clock})
+	defer restored.Close()
+	if _, err := restored.LoadSnapshot(&buf, codec); err != nil {
+		t.Fatalf("LoadSnapshot expect nil, but %v", err)
+	}
+
+	for name, c := range map[string]*Cache{"replayed": replayed, "restored": restored} {
+		if count, _ := c.InvalidateTag("user:1"); count != 1 {
+			t.Fatalf("%s InvalidateTag 'user:1' expect 1, but %d", name, count)
+		}
+		if count, _ := c.InvalidateTag("all"); count != 1 {
+			t.Fatalf("%s InvalidateTag 'all' expect 1, but %d", name, count)
+		}
+		if v, _ := c.Get("c"); v == nil {
+			t.Fatalf("%s get 'c' expect Bob, but nil", name)
+		}
+	}
+}
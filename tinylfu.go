@@ -0,0 +1,296 @@
+package cache
+
+import (
+	"container/list"
+	"hash/maphash"
+	"sync"
+)
+
+const (
+	tinylfu_window_percent    = 1  // window lru takes 1% of the keys
+	tinylfu_protected_percent = 80 // protected segment takes 80% of the main lru
+	cm_sketch_depth           = 4
+	cm_sketch_max_count       = 15 // 4-bit counters
+)
+
+type tinylfu_segment int8
+
+const (
+	segment_window tinylfu_segment = iota
+	segment_probation
+	segment_protected
+)
+
+type tinylfu_entry struct {
+	key     string
+	segment tinylfu_segment
+	element *list.Element
+}
+
+type tinylfu_policy struct {
+	lock      sync.Mutex
+	entries   map[string]*tinylfu_entry
+	window    *list.List // front is the most recent
+	probation *list.List
+	protected *list.List
+	sketch    *cm_sketch
+}
+
+// W-TinyLFU policy (as in Caffeine) for skewed workloads:
+// new keys enter a small window lru, keys leaving the window go to the probation segment of the main lru
+// and keys used again in probation are promoted to the protected segment.
+// When items must be recycled the least recent window key competes with the main lru victim,
+// the one with the lower frequency estimated by a count-min sketch with a doorkeeper is evicted.
+// The policy only chooses the victims of recycling, a Set is never rejected: a new key is stored even over
+// the limit and the admission of the window keys is decided by the next recycling.
+// expectedItems sizes the sketch, if <= 0 then 10000 is used.
+func NewTinyLFUPolicy(expectedItems int) EvictionPolicy {
+	if expectedItems <= 0 {
+		expectedItems = 10000
+	}
+	return &tinylfu_policy{
+		entries:   make(map[string]*tinylfu_entry),
+		window:    list.New(),
+		probation: list.New(),
+		protected: list.New(),
+		sketch:    makeCMSketch(expectedItems),
+	}
+}
+
+func (p *tinylfu_policy) OnSet(key string, replaced bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.sketch.increment(key)
+
+	if entry, exist := p.entries[key]; exist {
+		p.touch(entry)
+		return
+	}
+
+	entry := &tinylfu_entry{key: key, segment: segment_window}
+	entry.element = p.window.PushFront(entry)
+	p.entries[key] = entry
+
+	//window overflow goes to probation
+	window_max := len(p.entries) * tinylfu_window_percent / 100
+	if window_max < 1 {
+		window_max = 1
+	}
+	for p.window.Len() > window_max {
+		p.move(p.window.Back().Value.(*tinylfu_entry), segment_probation)
+	}
+}
+
+func (p *tinylfu_policy) OnAccess(key string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.sketch.increment(key)
+
+	if entry, exist := p.entries[key]; exist {
+		p.touch(entry)
+	}
+}
+
+func (p *tinylfu_policy) OnDelete(key string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if entry, exist := p.entries[key]; exist {
+		p.segmentList(entry.segment).Remove(entry.element)
+		delete(p.entries, key)
+	}
+}
+
+func (p *tinylfu_policy) Victims(n int) []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	keys := make([]string, 0, n)
+	chosen := make(map[*tinylfu_entry]bool, n)
+
+	// candidates are the keys recently admitted: window from its tail, then probation from its head.
+	// victims are the keys of the main lru: probation from its tail, then protected from its tail.
+	candidates := p.window
+	candidate := p.window.Back()
+	victims := p.probation
+	victim := p.probation.Back()
+
+	next := func() {
+		for candidate == nil || chosen[candidate.Value.(*tinylfu_entry)] {
+			if candidate != nil {
+				if candidates == p.window {
+					candidate = candidate.Prev()
+				} else {
+					candidate = candidate.Next()
+				}
+			} else if candidates == p.window {
+				candidates = p.probation
+				candidate = p.probation.Front()
+			} else {
+				break
+			}
+		}
+		for victim == nil || chosen[victim.Value.(*tinylfu_entry)] {
+			if victim != nil {
+				victim = victim.Prev()
+			} else if victims == p.probation {
+				victims = p.protected
+				victim = p.protected.Back()
+			} else {
+				break
+			}
+		}
+	}
+
+	for next(); len(keys) < n && (candidate != nil || victim != nil); next() {
+		var evict *tinylfu_entry
+		if victim == nil {
+			evict = candidate.Value.(*tinylfu_entry)
+		} else if candidate == nil {
+			evict = victim.Value.(*tinylfu_entry)
+		} else {
+			c := candidate.Value.(*tinylfu_entry)
+			v := victim.Value.(*tinylfu_entry)
+			//the candidate displaces the victim only if it is more popular
+			if p.sketch.estimate(c.key) > p.sketch.estimate(v.key) {
+				evict = v
+			} else {
+				evict = c
+			}
+		}
+		chosen[evict] = true
+		keys = append(keys, evict.key)
+	}
+	return keys
+}
+
+// key is used again
+func (p *tinylfu_policy) touch(entry *tinylfu_entry) {
+	switch entry.segment {
+	case segment_window:
+		p.window.MoveToFront(entry.element)
+	case segment_probation:
+		p.move(entry, segment_protected)
+		protected_max := (len(p.entries) - p.window.Len()) * tinylfu_protected_percent / 100
+		if protected_max < 1 {
+			protected_max = 1
+		}
+		for p.protected.Len() > protected_max {
+			p.move(p.protected.Back().Value.(*tinylfu_entry), segment_probation)
+		}
+	case segment_protected:
+		p.protected.MoveToFront(entry.element)
+	}
+}
+
+// move the entry to the front of segment
+func (p *tinylfu_policy) move(entry *tinylfu_entry, segment tinylfu_segment) {
+	p.segmentList(entry.segment).Remove(entry.element)
+	entry.segment = segment
+	entry.element = p.segmentList(segment).PushFront(entry)
+}
+
+func (p *tinylfu_policy) segmentList(segment tinylfu_segment) *list.List {
+	switch segment {
+	case segment_window:
+		return p.window
+	case segment_probation:
+		return p.probation
+	default:
+		return p.protected
+	}
+}
+
+// count-min sketch with 4-bit counters and a doorkeeper bloom filter.
+// A key is only counted in the sketch from its second occurrence, all counters are halved
+// once the number of additions reaches the sample size so that old popularity fades out.
+type cm_sketch struct {
+	seed        maphash.Seed
+	counters    [cm_sketch_depth][]uint8
+	doorkeeper  []uint64 //bitset
+	mask        uint64   //width - 1
+	additions   int
+	sample_size int
+}
+
+func makeCMSketch(expectedItems int) *cm_sketch {
+	//4 counters per expected item in each row keeps collisions low
+	width := 16
+	for width < 4*expectedItems {
+		width <<= 1
+	}
+
+	sketch := &cm_sketch{
+		seed:        maphash.MakeSeed(),
+		doorkeeper:  make([]uint64, width/64+1),
+		mask:        uint64(width - 1),
+		sample_size: 10 * width,
+	}
+	for i := range sketch.counters {
+		sketch.counters[i] = make([]uint8, width)
+	}
+	return sketch
+}
+
+// the index of key in row i, every row remixes the whole hash so that
+// two keys colliding in one row are unlikely to collide in the others
+func (sketch *cm_sketch) index(hash uint64, i int) uint64 {
+	h := hash + uint64(i+1)*0x9e3779b97f4a7c15
+	h = (h ^ (h >> 30)) * 0xbf58476d1ce4e5b9
+	h = (h ^ (h >> 27)) * 0x94d049bb133111eb
+	h ^= h >> 31
+	return h & sketch.mask
+}
+
+func (sketch *cm_sketch) increment(key string) {
+	hash := maphash.String(sketch.seed, key)
+
+	//first occurrence only enters the doorkeeper
+	bit := hash & sketch.mask
+	if sketch.doorkeeper[bit/64]&(1<<(bit%64)) == 0 {
+		sketch.doorkeeper[bit/64] |= 1 << (bit % 64)
+	} else {
+		for i := 0; i < cm_sketch_depth; i++ {
+			idx := sketch.index(hash, i)
+			if sketch.counters[i][idx] < cm_sketch_max_count {
+				sketch.counters[i][idx]++
+			}
+		}
+	}
+
+	sketch.additions++
+	if sketch.additions >= sketch.sample_size {
+		sketch.reset()
+	}
+}
+
+func (sketch *cm_sketch) estimate(key string) int {
+	hash := maphash.String(sketch.seed, key)
+
+	min := uint8(cm_sketch_max_count)
+	for i := 0; i < cm_sketch_depth; i++ {
+		if c := sketch.counters[i][sketch.index(hash, i)]; c < min {
+			min = c
+		}
+	}
+
+	bit := hash & sketch.mask
+	if sketch.doorkeeper[bit/64]&(1<<(bit%64)) != 0 {
+		return int(min) + 1
+	}
+	return int(min)
+}
+
+func (sketch *cm_sketch) reset() {
+	sketch.additions /= 2
+	for i := range sketch.counters {
+		for j := range sketch.counters[i] {
+			sketch.counters[i][j] >>= 1
+		}
+	}
+	for i := range sketch.doorkeeper {
+		sketch.doorkeeper[i] = 0
+	}
+}
@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"log"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// simulate a cache of capacity keys driven by the policy only, return the hit ratio
+func simulateHitRatio(policy EvictionPolicy, capacity int, keys []string) float64 {
+	exist := map[string]bool{}
+	hits := 0
+	for _, key := range keys {
+		if exist[key] {
+			hits++
+			policy.OnAccess(key)
+			continue
+		}
+		exist[key] = true
+		policy.OnSet(key, false)
+		if len(exist) > capacity {
+			for _, victim := range policy.Victims(len(exist) - capacity) {
+				delete(exist, victim)
+				policy.OnDelete(victim)
+			}
+		}
+	}
+	return float64(hits) / float64(len(keys))
+}
+
+func Test_TinyLFU_HitRatio(t *testing.T) {
+	zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.01, 1, 100000)
+	keys := make([]string, 200000)
+	for i := range keys {
+		keys[i] = strconv.FormatUint(zipf.Uint64(), 10)
+	}
+
+	tinylfu := simulateHitRatio(NewTinyLFUPolicy(1000), 1000, keys)
+	lru := simulateHitRatio(NewLRUPolicy(), 1000, keys)
+	fifo := simulateHitRatio(NewFIFOPolicy(), 1000, keys)
+	log.Printf("hit ratio tinylfu: %.4f lru: %.4f fifo: %.4f", tinylfu, lru, fifo)
+
+	if tinylfu <= lru || tinylfu <= fifo {
+		t.Fatalf("tinylfu hit ratio %.4f expect greater than lru %.4f and fifo %.4f", tinylfu, lru, fifo)
+	}
+}
+
+func Test_TinyLFU_ScanResistance(t *testing.T) {
+	// the sketch is sized for the scanned keys, a smaller one lets some of them collide with the popular keys
+	policy := NewTinyLFUPolicy(1000)
+
+	// popular keys
+	keys := []string{}
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 50; i++ {
+			keys = append(keys, "hot"+strconv.Itoa(i))
+		}
+	}
+	// one-hit wonders
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, "scan"+strconv.Itoa(i))
+	}
+	simulateHitRatio(policy, 100, keys)
+
+	// all the popular keys survive the scan
+	for i := 0; i < 50; i++ {
+		if _, exist := policy.(*tinylfu_policy).entries["hot"+strconv.Itoa(i)]; !exist {
+			t.Fatalf("hot key %d should be kept after scan", i)
+		}
+	}
+}
+
+func Test_Cache_TinyLFU(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	jack := &Person{"Jack", 18, "America"}
+
+	cache, err := New(&CacheConfig{
+		CacheBytesLimit:  int64(jack.CacheBytes()) * 100,
+		RecycleBatchSize: 10,
+		Clock:            clock,
+		EvictionPolicy:   NewTinyLFUPolicy(1000),
+	})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	for round := 0; round < 3; round++ {
+		for j := 0; j < 20; j++ {
+			cache.SetTTL("hot"+strconv.Itoa(j), jack, 60)
+			cache.Get("hot" + strconv.Itoa(j))
+		}
+	}
+	for j := 0; j < 200; j++ {
+		cache.SetTTL("cold"+strconv.Itoa(j), jack, 3600)
+	}
+
+	clock.Advance(5 * time.Second)
+	if int64(cache.Bytes()) >= cache.recycle_bytes_threshold {
+		t.Fatalf("total bytes expect < %d after recycling, but %d", cache.recycle_bytes_threshold, cache.Bytes())
+	}
+	for j := 0; j < 20; j++ {
+		if v, _ := cache.Get("hot" + strconv.Itoa(j)); v != jack {
+			t.Fatalf("hot key %d should be kept, but %v", j, v)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+)
+
+// TypedCache is a generic cache built on the same engine as Cache.
+// Values are stored as they are, the size of each value is given by the size function
+// so there is no need to implement the CacheItem interface.
+type TypedCache[K comparable, V any] struct {
+	cache    *Cache
+	size     func(V) int
+	key_func func(K) string
+	on_evict atomic.Value //func(key K, value V, reason EvictReason)
+}
+
+type typed_item[K comparable, V any] struct {
+	key   K
+	value V
+	bytes int //size of the value when it was set
+}
+
+func (item *typed_item[K, V]) CacheBytes() int {
+	return item.bytes
+}
+
+// items wrapping the same value are the same, so setting a value again is not a replacement
+func (item *typed_item[K, V]) Equal(other CacheItem) bool {
+	other_item, ok := other.(*typed_item[K, V])
+	if !ok {
+		return false
+	}
+	a, b := any(item.value), any(other_item.value)
+	if equaler, ok := a.(Equaler); ok {
+		b_item, ok := b.(CacheItem)
+		return ok && equaler.Equal(b_item)
+	}
+	type_a := reflect.TypeOf(a)
+	if type_a != reflect.TypeOf(b) || (type_a != nil && !type_a.Comparable()) {
+		return false
+	}
+	return a == b
+}
+
+// size returns the bytes of a value used for the CacheBytesLimit accounting.
+// if passed config is nil, then use the default cache_config.
+func NewTyped[K comparable, V any](size func(V) int, config *CacheConfig) (*TypedCache[K, V], error) {
+	return NewTypedWithKeyFunc[K, V](size, nil, config)
+}
+
+// keyFunc maps a key to the internal string key, distinct keys must be mapped to distinct strings.
+// if passed keyFunc is nil, keys are formatted with strconv for the basic types and with %#v for structs and arrays.
+// %#v formats what a pointer points to, so keyFunc is required for pointer, chan and interface keys
+// and for structs and arrays holding any of them.
+// config.OnEvict must be nil, evictions are notified with the typed keys and values through OnEvict.
+func NewTypedWithKeyFunc[K comparable, V any](size func(V) int, keyFunc func(K) string, config *CacheConfig) (*TypedCache[K, V], error) {
+	if size == nil {
+		return nil, errors.New("size func can not be nil")
+	}
+
+	typed_config := CacheConfig{}
+	if config != nil {
+		if config.OnEvict != nil {
+			return nil, errors.New("config OnEvict can not be set for a typed cache, use OnEvict of the typed cache")
+		}
+		typed_config = *config
+	}
+
+	if keyFunc == nil {
+		if key_type := reflect.TypeOf((*K)(nil)).Elem(); !formattable(key_type) {
+			return nil, fmt.Errorf("keyFunc is required for key type %v", key_type)
+		}
+		keyFunc = formatKey[K]
+	}
+
+	tc := &TypedCache[K, V]{
+		size:     size,
+		key_func: keyFunc,
+	}
+	typed_config.OnEvict = func(key string, value CacheItem, reason EvictReason) {
+		if on_evict, _ := tc.on_evict.Load().(func(K, V, EvictReason)); on_evict != nil {
+			item := value.(*typed_item[K, V])
+			on_evict(item.key, item.value, reason)
+		}
+	}
+
+	cache, err := New(&typed_config)
+	if err != nil {
+		return nil, err
+	}
+	tc.cache = cache
+	return tc, nil
+}
+
+// whether distinct keys of type t have distinct %#v, which is not the case once a key holds a pointer,
+// as equal values pointed to by distinct pointers are formatted alike
+func formattable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.UnsafePointer, reflect.Chan, reflect.Interface:
+		return false
+	case reflect.Array:
+		return formattable(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !formattable(t.Field(i).Type) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func formatKey[K comparable](key K) string {
+	switch k := any(key).(type) {
+	case string:
+		return k
+	case int:
+		return strconv.Itoa(k)
+	case int8:
+		return strconv.FormatInt(int64(k), 10)
+	case int16:
+		return strconv.FormatInt(int64(k), 10)
+	case int32:
+		return strconv.FormatInt(int64(k), 10)
+	case int64:
+		return strconv.FormatInt(k, 10)
+	case uint:
+		return strconv.FormatUint(uint64(k), 10)
+	case uint8:
+		return strconv.FormatUint(uint64(k), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(k), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(k), 10)
+	case uint64:
+		return strconv.FormatUint(k, 10)
+	case bool:
+		return strconv.FormatBool(k)
+	default:
+		return fmt.Sprintf("%#v", key)
+	}
+}
+
+// the underlying untyped cache, values stored in it are internal wrappers
+func (tc *TypedCache[K, V]) Cache() *Cache {
+	return tc.cache
+}
+
+// ok is false if the key does not exist or has expired
+func (tc *TypedCache[K, V]) Get(key K) (value V, ttl int64, ok bool) {
+	item, ttl := tc.cache.Get(tc.key_func(key))
+	if item == nil {
+		return value, 0, false
+	}
+	return item.(*typed_item[K, V]).value, ttl, true
+}
+
+// like Cache.GetOrLoad, the loader is only called for a missing key and once at a time
+func (tc *TypedCache[K, V]) GetOrLoad(ctx context.Context, key K, loader func(ctx context.Context) (value V, ttl int64, err error)) (value V, ttl int64, err error) {
+	item, ttl, err := tc.cache.GetOrLoad(ctx, tc.key_func(key), func(ctx context.Context) (CacheItem, int64, error) {
+		value, ttl, err := loader(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+		return tc.wrap(key, value), ttl, nil
+	})
+	if err != nil {
+		return value, 0, err
+	}
+	return item.(*typed_item[K, V]).value, ttl, nil
+}
+
+// set with the default ttl
+func (tc *TypedCache[K, V]) Set(key K, value V) error {
+	return tc.cache.Set(tc.key_func(key), tc.wrap(key, value))
+}
+
+func (tc *TypedCache[K, V]) SetTTL(key K, value V, ttlSecond int64) error {
+	return tc.cache.SetTTL(tc.key_func(key), tc.wrap(key, value), ttlSecond)
+}
+
+// replace the value and keep the ttl, nothing happens if the key does not exist
+func (tc *TypedCache[K, V]) Keep(key K, value V) error {
+	return tc.cache.Keep(tc.key_func(key), tc.wrap(key, value))
+}
+
+func (tc *TypedCache[K, V]) Delete(key K) error {
+	return tc.cache.Delete(tc.key_func(key))
+}
+
+// like Cache.Range, with the keys and values as they were set
+func (tc *TypedCache[K, V]) Range(f func(key K, value V, ttl int64) bool) {
+	tc.cache.Range(func(key string, value CacheItem, ttl int64) bool {
+		item := value.(*typed_item[K, V])
+		return f(item.key, item.value, ttl)
+	})
+}
+
+// f is notified like CacheConfig.OnEvict, with the key and the value as they were set
+func (tc *TypedCache[K, V]) OnEvict(f func(key K, value V, reason EvictReason)) {
+	tc.on_evict.Store(f)
+}
+
+func (tc *TypedCache[K, V]) Items() int32 {
+	return tc.cache.Items()
+}
+
+func (tc *TypedCache[K, V]) Bytes() int32 {
+	return tc.cache.Bytes()
+}
+
+func (tc *TypedCache[K, V]) Stats() *CacheStats {
+	return tc.cache.Stats()
+}
+
+func (tc *TypedCache[K, V]) GetConfig() *CacheConfig {
+	return tc.cache.GetConfig()
+}
+
+func (tc *TypedCache[K, V]) Close() error {
+	return tc.cache.Close()
+}
+
+func (tc *TypedCache[K, V]) wrap(key K, value V) *typed_item[K, V] {
+	return &typed_item[K, V]{
+		key:   key,
+		value: value,
+		bytes: tc.size(value),
+	}
+}
@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+type point struct {
+	X, Y int
+}
+
+func Test_TypedCache_Simple(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	cache, err := NewTyped[int, Person](func(p Person) int { return len(p.Name) + len(p.Location) + 8 }, &CacheConfig{Clock: clock})
+	if nil != err {
+		t.Fatalf("New typed cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	jack := Person{"Jack", 18, "London"}
+	cache.SetTTL(1, jack, 5)
+	cache.Set(2, Person{"Rose", 17, "Paris"})
+
+	if int32(2) != cache.Items() {
+		t.Fatalf("cache's total items count should be 2, but %d", cache.Items())
+	}
+	if int32((4+6+8)+(4+5+8)) != cache.Bytes() {
+		t.Fatalf("cache's total bytes should be %d, but %d", (4+6+8)+(4+5+8), cache.Bytes())
+	}
+
+	v, ttl, ok := cache.Get(1)
+	if !ok || v != jack || ttl != 5 {
+		t.Fatalf("get 1 expect %v 5 true, but %v %d %v", jack, v, ttl, ok)
+	}
+
+	clock.Advance(5 * time.Second)
+	if v, ttl, ok := cache.Get(1); ok || v != (Person{}) || ttl != 0 {
+		t.Fatalf("get expired 1 expect zero value, but %v %d %v", v, ttl, ok)
+	}
+
+	cache.Delete(2)
+	if _, _, ok := cache.Get(2); ok {
+		t.Fatalf("get deleted 2 expect miss")
+	}
+}
+
+func Test_TypedCache_Keys(t *testing.T) {
+	cache, err := NewTyped[point, string](func(s string) int { return len(s) }, nil)
+	if nil != err {
+		t.Fatalf("New typed cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	cache.Set(point{1, 2}, "a")
+	cache.Set(point{2, 1}, "b")
+
+	if v, _, _ := cache.Get(point{1, 2}); v != "a" {
+		t.Fatalf("get {1 2} expect a, but %s", v)
+	}
+	if v, _, _ := cache.Get(point{2, 1}); v != "b" {
+		t.Fatalf("get {2 1} expect b, but %s", v)
+	}
+
+	if _, err := NewTyped[string, string](nil, nil); err == nil {
+		t.Fatalf("nil size func expect error")
+	}
+}
+
+func Test_TypedCache_PointerKeys(t *testing.T) {
+	size := func(s string) int { return len(s) }
+	//equal values behind distinct pointers would share a %#v key
+	if _, err := NewTyped[*point, string](size, nil); err == nil {
+		t.Fatalf("pointer keys without keyFunc expect error")
+	}
+	if _, err := NewTyped[struct{ p *point }, string](size, nil); err == nil {
+		t.Fatalf("struct keys holding a pointer without keyFunc expect error")
+	}
+
+	ids := map[*point]string{}
+	cache, err := NewTypedWithKeyFunc[*point, string](size, func(p *point) string {
+		if _, exist := ids[p]; !exist {
+			ids[p] = strconv.Itoa(len(ids))
+		}
+		return ids[p]
+	}, nil)
+	if nil != err {
+		t.Fatalf("New typed cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	a, b := &point{1, 2}, &point{1, 2}
+	cache.Set(a, "a")
+	cache.Set(b, "b")
+	if v, _, _ := cache.Get(a); v != "a" {
+		t.Fatalf("get a expect a, but %s", v)
+	}
+}
+
+func Test_TypedCache_OnEvict(t *testing.T) {
+	type evicted struct {
+		key    int
+		value  string
+		reason EvictReason
+	}
+	var evictions []evicted
+
+	if _, err := NewTyped[int, string](func(v string) int { return len(v) }, &CacheConfig{OnEvict: func(key string, value CacheItem, reason EvictReason) {}}); err == nil {
+		t.Fatalf("New typed cache with config OnEvict expect error, but nil")
+	}
+
+	cache, err := NewTyped[int, string](func(v string) int { return len(v) }, nil)
+	if nil != err {
+		t.Fatalf("New typed cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+	cache.OnEvict(func(key int, value string, reason EvictReason) {
+		evictions = append(evictions, evicted{key, value, reason})
+	})
+
+	// the same value set again is not a replacement
+	cache.Set(1, "a")
+	cache.Set(1, "a")
+	if len(evictions) != 0 {
+		t.Fatalf("evictions after setting the same value expect none, but %v", evictions)
+	}
+
+	cache.Set(1, "b")
+	cache.Delete(1)
+	expect := []evicted{{1, "a", EvictReplaced}, {1, "b", EvictDeleted}}
+	if len(evictions) != len(expect) || evictions[0] != expect[0] || evictions[1] != expect[1] {
+		t.Fatalf("evictions expect %v, but %v", expect, evictions)
+	}
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// what Update does with the result of its func
+type UpdateAction int
+
+const (
+	UpdateKeep    UpdateAction = iota // leave key as it is
+	UpdateReplace                     // set the returned value with the returned ttl, 0 keeps the ttl like Keep. The tags are kept
+	UpdateDelete                      // delete key
+)
+
+// Update runs fn with the live value of key (exists is false if it is missing or expired) and applies its action,
+// all with the lock of the shard of key held so no other write of the key can happen in between.
+// fn must be quick and must not use the cache, other keys of the same shard wait for it.
+// The value and ttl of key after the update are returned, nil if it does not exist.
+func (cache *Cache) Update(key string, fn func(old CacheItem, exists bool) (value CacheItem, ttlSecond int64, action UpdateAction)) (CacheItem, int64, error) {
+	shard := cache.shard(key)
+	shard.lock.Lock()
+	if cache.Closed() {
+		shard.lock.Unlock()
+		return nil, 0, ErrClosed
+	}
+
+	now := cache.now()
+	var live *cache_element
+	if ele_, exist := shard.sync_map.Load(key); exist {
+		if ele := ele_.(*cache_element); ele.expire() > now {
+			live = ele
+		}
+	}
+	var old CacheItem
+	if live != nil {
+		old = live.Value.(CacheItem)
+	}
+
+	//a panic of fn must not leave the shard locked
+	locked := true
+	defer func() {
+		if locked {
+			shard.lock.Unlock()
+		}
+	}()
+	value, ttlSecond, action := fn(old, live != nil)
+
+	var result *cache_element
+	var evicted *cache_element
+	var reason EvictReason
+	var err error
+	switch action {
+	case UpdateKeep:
+		result = live
+
+	case UpdateReplace:
+		if value == nil {
+			err = errors.New("value can not be nil")
+			break
+		}
+		if ttlSecond < 0 {
+			err = errors.New("ttl < 0 error")
+			break
+		}
+		ttl := cache.capTtl(secsToMillis(ttlSecond))
+		//an expired element is replaced like a missing one, keeping its ttl would store an expired value
+		if live == nil && ttl == 0 {
+			break
+		}
+		//encoded before storing, so a value which can not be logged is not stored either
+		var data []byte
+		if cache.aof != nil {
+			if data, err = cache.aof.codec.Encode(value); err != nil {
+				result = live
+				break
+			}
+		}
+		var tags []string
+		if live != nil {
+			tags = live.Tags
+		}
+		evicted = cache.store(shard, key, value, ttl, 0, tags, nil)
+		if evicted != nil {
+			var ok bool
+			if reason, ok = overwriteReason(evicted, value, now); !ok {
+				evicted = nil
+			}
+		}
+		ele_, _ := shard.sync_map.Load(key)
+		result = ele_.(*cache_element)
+		if cache.aof != nil {
+			err = cache.aof.append(aofSetEntry(key, result.Score, result.Sliding, result.Tags, data))
+		}
+
+	case UpdateDelete:
+		if live == nil {
+			break
+		}
+		evicted = cache.remove(shard, key, live.expire(), nil)
+		reason = EvictDeleted
+		if evicted != nil && cache.aof != nil {
+			err = cache.aof.append(aofDeleteEntry(key))
+		}
+
+	default:
+		err = errors.New("unknown update action")
+	}
+	locked = false
+	shard.lock.Unlock()
+
+	if evicted != nil {
+		if reason == EvictDeleted {
+			atomic.AddInt64(&shard.stats.deletes, 1)
+		}
+		cache.evicted(key, evicted.Value.(CacheItem), reason)
+	}
+	if result == nil {
+		return nil, 0, err
+	}
+	return result.Value.(CacheItem), millisToSecs(result.expire() - now), err
+}
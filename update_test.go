@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_Cache_Update(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	var evictions []EvictReason
+	cache, err := New(&CacheConfig{Clock: clock, OnEvict: func(key string, value CacheItem, reason EvictReason) {
+		evictions = append(evictions, reason)
+	}})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	// missing key, ttl 0 stores nothing
+	v, ttl, err := cache.Update("a", func(old CacheItem, exists bool) (CacheItem, int64, UpdateAction) {
+		return &Person{"Jack", 1, "London"}, 0, UpdateReplace
+	})
+	if v != nil || ttl != 0 || err != nil || cache.Items() != 0 {
+		t.Fatalf("Update with ttl 0 on missing key expect nil 0 nil, but %v %d %v", v, ttl, err)
+	}
+
+	v, ttl, _ = cache.Update("a", func(old CacheItem, exists bool) (CacheItem, int64, UpdateAction) {
+		if exists {
+			t.Fatalf("Update on missing key expect exists false, but true")
+		}
+		return &Person{"Jack", 1, "London"}, 100, UpdateReplace
+	})
+	if v.(*Person).Age != 1 || ttl != 100 {
+		t.Fatalf("Update expect age 1 ttl 100, but %v %d", v, ttl)
+	}
+
+	// read-modify-write keeping the ttl
+	clock.Advance(10 * time.Second)
+	v, ttl, _ = cache.Update("a", func(old CacheItem, exists bool) (CacheItem, int64, UpdateAction) {
+		p := *old.(*Person)
+		p.Age++
+		return &p, 0, UpdateReplace
+	})
+	if v.(*Person).Age != 2 || ttl != 90 {
+		t.Fatalf("Update expect age 2 ttl 90, but %v %d", v, ttl)
+	}
+
+	v, ttl, _ = cache.Update("a", func(old CacheItem, exists bool) (CacheItem, int64, UpdateAction) {
+		return nil, 0, UpdateKeep
+	})
+	if v.(*Person).Age != 2 || ttl != 90 {
+		t.Fatalf("Update keep expect age 2 ttl 90, but %v %d", v, ttl)
+	}
+
+	v, _, _ = cache.Update("a", func(old CacheItem, exists bool) (CacheItem, int64, UpdateAction) {
+		return nil, 0, UpdateDelete
+	})
+	if v != nil || cache.Items() != 0 || cache.Bytes() != 0 {
+		t.Fatalf("Update delete expect nothing left, but %v %d items %d bytes", v, cache.Items(), cache.Bytes())
+	}
+	if len(evictions) != 2 || evictions[0] != EvictReplaced || evictions[1] != EvictDeleted {
+		t.Fatalf("evictions expect [replaced deleted], but %v", evictions)
+	}
+}
+
+func Test_Cache_UpdateConcurrent(t *testing.T) {
+	cache, err := New(&CacheConfig{ShardCount: 4})
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				cache.Update("counter", func(old CacheItem, exists bool) (CacheItem, int64, UpdateAction) {
+					if !exists {
+						return &Person{"counter", 1, ""}, 100, UpdateReplace
+					}
+					return &Person{"counter", old.(*Person).Age + 1, ""}, 0, UpdateReplace
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	if v, _ := cache.Get("counter"); v.(*Person).Age != 800 {
+		t.Fatalf("counter expect 800, but %d", v.(*Person).Age)
+	}
+}
+
+func Test_Cache_UpdatePanic(t *testing.T) {
+	cache, err := New(nil)
+	if nil != err {
+		t.Fatalf("New cache instance failed! err=%v", err)
+	}
+	defer cache.Close()
+
+	cache.Set("a", &Person{"a", 1, ""})
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("Update expect the panic of fn, but none")
+			}
+		}()
+		cache.Update("a", func(old CacheItem, exists bool) (CacheItem, int64, UpdateAction) {
+			panic("fn failed")
+		})
+	}()
+
+	//the shard is not left locked
+	done := make(chan error, 1)
+	go func() { done <- cache.SetTTL("a", &Person{"a", 2, ""}, 10) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("SetTTL after a panic expect nil, but %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("SetTTL after a panic expect to return, but it hangs")
+	}
+	if v, _ := cache.Get("a"); v.(*Person).Age != 2 {
+		t.Fatalf("a expect age 2, but %v", v)
+	}
+}
+
+type unencodable struct {
+	C chan int
+}
+
+func (u *unencodable) CacheBytes() int {
+	return 8
+}
+
+func Test_Cache_UpdateEncodeError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	cache := newAOFCache(t, clock, path, AOFFsyncEverySecond)
+	defer cache.Close()
+
+	cache.SetTTL("a", &Person{"Jack", 18, "London"}, 100)
+	v, ttl, err := cache.Update("a", func(old CacheItem, exists bool) (CacheItem, int64, UpdateAction) {
+		return &unencodable{make(chan int)}, 10, UpdateReplace
+	})
+	if err == nil || v.(*Person).Name != "Jack" || ttl != 100 {
+		t.Fatalf("Update with an unencodable value expect Jack 100 and an error, but %v %d %v", v, ttl, err)
+	}
+
+	// neither stored nor logged
+	if v, _ := cache.Get("a"); v.(*Person).Name != "Jack" {
+		t.Fatalf("get 'a' expect Jack, but %v", v)
+	}
+	cache.Close()
+	replayed := newAOFCache(t, clock, path, AOFFsyncEverySecond)
+	defer replayed.Close()
+	if v, _ := replayed.Get("a"); v == nil || v.(*Person).Name != "Jack" {
+		t.Fatalf("get 'a' after the replay expect Jack, but %v", v)
+	}
+}